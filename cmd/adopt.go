@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// AdoptOptions controls optional behaviour of Adopt.
+type AdoptOptions struct {
+	// ReplaceSamples also replaces a text, console or bare fenced block
+	// directly below a code block that is run, taking it to be sample
+	// output written by hand. Otherwise only an existing output block is
+	// replaced and every other block is left alone.
+	ReplaceSamples bool
+}
+
+// Adopt runs every fenced code block in file whose language is one of langs
+// and records its output in an ```output block directly below it, replacing
+// an output block that is already there. All other bytes of the file are
+// left as they are, so an existing README can be made verifiable without
+// being rewritten. Only fences at the start of a line that use backticks are
+// considered, as those are the ones verify reads.
+//
+// Returns the number of code blocks that were run.
+func Adopt(file string, langs []string, workdir string) (int, error) {
+	return AdoptWithOptions(file, langs, workdir, AdoptOptions{})
+}
+
+// AdoptWithOptions is Adopt with optional behaviour controlled by opts.
+//
+// Like exec, it runs the code before taking the document lock, then reads
+// the file again under the lock and records the outputs there. If the code
+// blocks changed in between it returns an error and changes nothing. The
+// change is journaled.
+func AdoptWithOptions(file string, langs []string, workdir string, opts AdoptOptions) (int, error) {
+	chosen := make(map[string]bool)
+	for _, l := range langs {
+		chosen[l] = true
+	}
+	samples := map[string]bool{"output": true}
+	if opts.ReplaceSamples {
+		samples = sampleOutput
+	}
+
+	draft, err := readAdoptable(file)
+	if err != nil {
+		return 0, err
+	}
+	type ran struct{ lang, code, output string }
+	var runs []ran
+	_, n, err := adoptText(draft, chosen, samples, func(lang, code string) (string, error) {
+		output, _, err := execpkg.Run(lang, code, workdir)
+		runs = append(runs, ran{lang, code, output})
+		return output, err
+	})
+	if err != nil {
+		return n, err
+	}
+
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	data, err := readAdoptable(file)
+	if err != nil {
+		return 0, err
+	}
+	out, n, err := adoptText(data, chosen, samples, func(lang, code string) (string, error) {
+		if len(runs) == 0 || runs[0].lang != lang || runs[0].code != code {
+			return "", fmt.Errorf("file changed while adopting; run adopt again")
+		}
+		r := runs[0]
+		runs = runs[1:]
+		return r.output, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(runs) > 0 {
+		return 0, fmt.Errorf("file changed while adopting; run adopt again")
+	}
+
+	if out == string(data) {
+		return n, nil
+	}
+	if err := lockedfile.WriteFile(file, []byte(out), 0644); err != nil {
+		return n, err
+	}
+	return n, journalRewrite(file, "adopt", []string{"--lang", strings.Join(langs, ",")}, data, []byte(out))
+}
+
+// readAdoptable reads file for Adopt, refusing a sealed document.
+func readAdoptable(file string) ([]byte, error) {
+	data, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading file: %w", err)
+	}
+	blocks, err := markdown.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+	if err := ensureUnsealed(blocks); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// adoptText returns data with the output of every fenced code block whose
+// language is in chosen, as returned by run, recorded below it. An existing
+// block below it whose info string is in samples is replaced. It also
+// returns the number of blocks run.
+func adoptText(data []byte, chosen, samples map[string]bool, run func(lang, code string) (string, error)) (string, int, error) {
+	lines := strings.SplitAfter(string(data), "\n")
+	var out strings.Builder
+	adopted := 0
+	for i := 0; i < len(lines); {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			out.WriteString(lines[i])
+			i++
+			continue
+		}
+		end := closingFence(lines, i+1, fence)
+		for _, l := range lines[i:min(end+1, len(lines))] {
+			out.WriteString(l)
+		}
+		next := end + 1
+
+		if end == len(lines) || !chosen[info] || strings.HasPrefix(fence, "~") {
+			i = next
+			continue
+		}
+
+		var code []string
+		for _, l := range lines[i+1 : end] {
+			code = append(code, trimEOL(l))
+		}
+		output, err := run(info, strings.Join(code, "\n"))
+		if err != nil {
+			return "", adopted, fmt.Errorf("running block on line %d: %w", i+1, err)
+		}
+		adopted++
+
+		// Replace an output block separated from the code by at most one
+		// blank line, which is how the parser pairs them.
+		j := next
+		if j < len(lines) && trimEOL(lines[j]) == "" {
+			j++
+		}
+		if j < len(lines) {
+			if f, info, ok := openingFence(lines[j]); ok && samples[info] && !strings.HasPrefix(f, "~") {
+				next = min(closingFence(lines, j+1, f)+1, len(lines))
+			}
+		}
+
+		// Match the line endings of the code block.
+		eol := "\n"
+		if strings.HasSuffix(lines[end], "\r\n") {
+			eol = "\r\n"
+		}
+		if !strings.HasSuffix(lines[end], "\n") {
+			out.WriteString(eol)
+		}
+		var block strings.Builder
+		if err := markdown.Write(&block, []markdown.Block{markdown.OutputBlock{Content: output}}); err != nil {
+			return "", adopted, err
+		}
+		out.WriteString(eol + strings.ReplaceAll(block.String(), "\n", eol))
+		i = next
+	}
+	return out.String(), adopted, nil
+}
+
+// sampleOutput holds the info strings of the blocks Adopt replaces with
+// AdoptOptions.ReplaceSamples when they follow a code block it runs: an
+// output block, or output written by hand in a text, console or bare block.
+var sampleOutput = map[string]bool{"output": true, "text": true, "console": true, "": true}
+
+// openingFence reports whether line opens a fenced block, returning the
+// fence and the info string after it. As in markdown.Parse, the info
+// string is the fence language as written, such as "bash".
+func openingFence(line string) (fence, info string, ok bool) {
+	line = trimEOL(line)
+	for _, ch := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, ch))
+		if n >= 3 {
+			return line[:n], line[n:], true
+		}
+	}
+	return "", "", false
+}
+
+// closingFence returns the index of the line that closes fence, searching
+// from start, or len(lines) if the block is never closed. Backtick fences
+// close on an exact match, as in markdown.Parse.
+func closingFence(lines []string, start int, fence string) int {
+	for i := start; i < len(lines); i++ {
+		l := trimEOL(lines[i])
+		if l == fence || (strings.HasPrefix(fence, "~") && strings.HasPrefix(l, fence) && strings.Trim(l, "~") == "") {
+			return i
+		}
+	}
+	return len(lines)
+}
+
+func trimEOL(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdopt(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "README.md")
+	input := "# Project\n\nSome intro.\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n" +
+		"```bash\necho hello\n```\n\n" +
+		"- a list\n- of things\n\n" +
+		"```bash\necho updated\n```\n\n```output\nold\n```\n\n" +
+		"```json\n{\"not\": \"run\"}\n```\n\n" +
+		"~~~bash\necho skipped\n~~~\n\n" +
+		"```bash\necho sample\n```\n\n```text\nsample output\n```\n\n" +
+		"```python3\nprint(1 + 1)\n```"
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := Adopt(file, []string{"bash", "python3"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("expected 4 blocks run, got %d", n)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# Project\n\nSome intro.\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n" +
+		"```bash\necho hello\n```\n\n```output\nhello\n```\n\n" +
+		"- a list\n- of things\n\n" +
+		"```bash\necho updated\n```\n\n```output\nupdated\n```\n\n" +
+		"```json\n{\"not\": \"run\"}\n```\n\n" +
+		"~~~bash\necho skipped\n~~~\n\n" +
+		"```bash\necho sample\n```\n\n```output\nsample\n```\n\n```text\nsample output\n```\n\n" +
+		"```python3\nprint(1 + 1)\n```\n\n```output\n2\n```\n"
+	if string(content) != want {
+		t.Errorf("unexpected result:\n%s\nwant:\n%s", content, want)
+	}
+
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected adopted file to verify, got %v", diffs)
+	}
+
+	// Adopting again changes nothing.
+	if _, err := Adopt(file, []string{"bash", "python3"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	again, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != want {
+		t.Errorf("expected second adopt to leave the file alone, got:\n%s", again)
+	}
+
+	// Adopting is journaled and can be undone.
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	undone, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(undone) != input {
+		t.Errorf("expected undo to restore the original file, got:\n%s", undone)
+	}
+}
+
+func TestAdoptCRLF(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "README.md")
+	input := "Intro\r\n\r\n```bash\r\necho hi\r\n```\r\n\r\nOutro\r\n"
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Adopt(file, []string{"bash"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "Intro\r\n\r\n```bash\r\necho hi\r\n```\r\n\r\n```output\r\nhi\r\n```\r\n") || !strings.HasSuffix(string(content), "\r\n\r\nOutro\r\n") {
+		t.Errorf("expected surrounding bytes to be kept, got %q", content)
+	}
+}
+
+func TestAdoptReplaceSamples(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "README.md")
+	input := "```bash\necho hi\n```\n\n```console\nhello\n```\n\n```bash\necho bye\n```\n\n```\nbye\n```\n"
+	if err := os.WriteFile(file, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AdoptWithOptions(file, []string{"bash"}, "", AdoptOptions{ReplaceSamples: true}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "```bash\necho hi\n```\n\n```output\nhi\n```\n\n```bash\necho bye\n```\n\n```output\nbye\n```\n"
+	if string(content) != want {
+		t.Errorf("expected the samples to be replaced, got:\n%s", content)
+	}
+}
+
+func TestAdoptSealed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Seal(file); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, append(before, "\n```bash\necho hi\n```\n"...), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Adopt(file, []string{"bash"}, ""); err == nil || !strings.Contains(err.Error(), "sealed") {
+		t.Errorf("expected a sealed document to be refused, got %v", err)
+	}
+}
+
+func TestAdoptDoesNotHoldLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "README.md")
+	if err := os.WriteFile(file, []byte("# Project\n\n```bash\nsleep 2; echo slow\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := Adopt(file, []string{"bash"}, "")
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	if err := Note(file, "quick"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected note not to wait for the running adopt, took %v", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "```output\nslow\n```") || !strings.Contains(string(content), "quick") {
+		t.Errorf("expected both the output and the note, got:\n%s", content)
+	}
+}
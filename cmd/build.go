@@ -1,67 +1,115 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 
-	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/internal/lockedfile"
 	"github.com/simonw/showboat/markdown"
 )
 
+// openDocument opens file, or one region of it, for a command that changes
+// it. Changes are posted to SHOWBOAT_REMOTE_URL when it is set.
+func openDocument(file, workdir, region string) (*document.Document, error) {
+	return document.Open(file, document.Options{Sink: remoteSink{}, Workdir: workdir, Region: region})
+}
+
 // Note appends a commentary block to an existing showboat document.
 func Note(file, text string) error {
-	blocks, err := readBlocks(file)
+	return NoteWithOptions(file, text, EntryOptions{})
+}
+
+// NoteWithOptions is Note with optional behaviour controlled by opts.
+func NoteWithOptions(file, text string, opts EntryOptions) error {
+	unlock, err := lockDocument(file)
 	if err != nil {
 		return err
 	}
+	defer unlock()
+	doc, err := openDocument(file, "", opts.Region)
+	if err != nil {
+		return err
+	}
+	before := doc.Blocks()
+	if err := ensureUnsealed(before); err != nil {
+		return err
+	}
 
-	newBlock := markdown.CommentaryBlock{Text: text}
-	blocks = append(blocks, newBlock)
-
-	if err := writeBlocks(file, blocks); err != nil {
+	if _, err := doc.AppendNote(context.Background(), text); err != nil {
 		return err
 	}
+	return saveChange(doc, "note", []string{text}, before)
+}
+
+// EntryOptions controls optional behaviour of Note, Exec, Image and Pop.
+type EntryOptions struct {
+	// Provenance records the start time, duration, exit code, hostname,
+	// working directory and interpreter version in the entry marker of an
+	// Exec or Image entry.
+	Provenance bool
+
+	// Region is the ID of the showboat region of a larger markdown file to
+	// change, instead of the whole file. Changes to a region are journaled
+	// as a rewrite of the whole file.
+	Region string
+
+	// Role marks an Exec entry as a setup ("setup") or teardown
+	// ("teardown") block, which verify runs before or after all others.
+	Role string
 
-	docID := documentID(blocks)
-	if docID != "" {
-		postSection(docID, "note", []markdown.Block{newBlock})
+	// Needs lists the IDs of earlier code entries that an Exec entry
+	// depends on. Verify skips the entry if one of them fails.
+	Needs []string
+
+	// ID is the entry ID to give a new Exec, Image, Env or GitState entry,
+	// as printed by Extract for entries that others need. Empty means a
+	// new random ID.
+	ID string
+}
+
+// idArgs returns the journal arguments recording an explicit entry ID.
+func (opts EntryOptions) idArgs() []string {
+	if opts.ID == "" {
+		return nil
 	}
-	return nil
+	return []string{"--id", opts.ID}
 }
 
 // Exec appends a code block, executes it, and appends the output.
 // It returns the captured output, the process exit code, and any error.
 func Exec(file, lang, code, workdir string) (string, int, error) {
+	return ExecWithOptions(file, lang, code, workdir, EntryOptions{})
+}
+
+// ExecWithOptions is Exec with optional behaviour controlled by opts.
+func ExecWithOptions(file, lang, code, workdir string, opts EntryOptions) (string, int, error) {
 	if _, err := os.Stat(file); err != nil {
 		return "", 1, fmt.Errorf("file not found: %s", file)
 	}
-
-	output, exitCode, err := execpkg.Run(lang, code, workdir)
-	if err != nil {
-		return "", exitCode, fmt.Errorf("running code: %w", err)
+	args := []string{lang, code}
+	if opts.Role != "" {
+		args = append(args, "--"+opts.Role)
 	}
-
-	blocks, err := readBlocks(file)
-	if err != nil {
-		return "", exitCode, err
-	}
-
-	codeBlock := markdown.CodeBlock{Lang: lang, Code: code}
-	outputBlock := markdown.OutputBlock{Content: output}
-	blocks = append(blocks, codeBlock, outputBlock)
-
-	if err := writeBlocks(file, blocks); err != nil {
-		return output, exitCode, err
+	if len(opts.Needs) > 0 {
+		args = append(args, "--needs", strings.Join(opts.Needs, ","))
 	}
+	args = append(args, opts.idArgs()...)
 
-	docID := documentID(blocks)
-	if docID != "" {
-		postSection(docID, "exec", []markdown.Block{codeBlock, outputBlock})
+	res := document.ExecResult{ExitCode: 1}
+	err := addEntry(file, workdir, opts.Region, "exec", args, func(doc *document.Document) error {
+		var err error
+		res, err = doc.Exec(context.Background(), lang, code, document.EntryOptions{Provenance: opts.Provenance, Role: opts.Role, Needs: opts.Needs, ID: opts.ID})
+		return err
+	})
+	if err != nil {
+		return "", res.ExitCode, err
 	}
-
-	return output, exitCode, nil
+	return res.Output, res.ExitCode, nil
 }
 
 // Image appends an image reference to a showboat document. The input is either
@@ -69,76 +117,122 @@ func Exec(file, lang, code, workdir string) (string, int, error) {
 // ![alt text](path). When a markdown reference is provided the alt text is
 // preserved; otherwise it is derived from the generated filename.
 func Image(file, input, workdir string) error {
+	return ImageWithOptions(file, input, workdir, EntryOptions{})
+}
+
+// ImageWithOptions is Image with optional behaviour controlled by opts.
+func ImageWithOptions(file, input, workdir string, opts EntryOptions) error {
 	if _, err := os.Stat(file); err != nil {
 		return fmt.Errorf("file not found: %s", file)
 	}
+	args := append([]string{input}, opts.idArgs()...)
+	return addEntry(file, workdir, opts.Region, "image", args, func(doc *document.Document) error {
+		_, err := doc.Image(context.Background(), input, document.EntryOptions{Provenance: opts.Provenance, ID: opts.ID})
+		return err
+	})
+}
 
-	imgPath, altText := parseImageInput(input)
-
-	destDir := filepath.Dir(file)
-	filename, err := execpkg.CopyImage(imgPath, destDir)
+// addEntry adds an entry to file, or one region of it, and journals the
+// change as op with args. add makes the entry on a copy of the document
+// read without locking the file, so that the code it runs does not hold up
+// other commands. Only then is the file locked, read again and the entry
+// appended to it. If that fails, the images add copied are removed.
+func addEntry(file, workdir, region, op string, args []string, add func(*document.Document) error) error {
+	draft, err := document.Open(file, document.Options{Workdir: workdir, Region: region})
 	if err != nil {
 		return err
 	}
+	if err := ensureUnsealed(draft.Blocks()); err != nil {
+		return err
+	}
+	n := len(draft.Blocks())
+	if err := add(draft); err != nil {
+		return err
+	}
+	entry := draft.Blocks()[n:]
 
-	blocks, err := readBlocks(file)
+	unlock, err := lockDocument(file)
 	if err != nil {
+		removeUnsavedImages(file, entry)
 		return err
 	}
-
-	if altText == "" {
-		// Derive alt text from the filename without UUID prefix and date
-		altText = strings.TrimSuffix(filename, filepath.Ext(filename))
+	defer unlock()
+	if err := appendEntry(file, workdir, region, op, args, entry); err != nil {
+		removeUnsavedImages(file, entry)
+		return err
 	}
+	return nil
+}
 
-	codeBlock := markdown.CodeBlock{Lang: "bash", Code: input, IsImage: true}
-	imgBlock := markdown.ImageOutputBlock{AltText: altText, Filename: filename}
-	blocks = append(blocks, codeBlock, imgBlock)
-
-	if err := writeBlocks(file, blocks); err != nil {
+// appendEntry appends entry to file, or one region of it, which must be
+// locked, and journals the change as op with args.
+func appendEntry(file, workdir, region, op string, args []string, entry []markdown.Block) error {
+	doc, err := openDocument(file, workdir, region)
+	if err != nil {
 		return err
 	}
-
-	docID := documentID(blocks)
-	if docID != "" {
-		copiedImagePath := filepath.Join(destDir, filename)
-		postImage(docID, []markdown.Block{codeBlock, imgBlock}, copiedImagePath)
+	before := doc.Blocks()
+	if err := ensureUnsealed(before); err != nil {
+		return err
 	}
-	return nil
+	if err := doc.AppendEntry(context.Background(), entry); err != nil {
+		return err
+	}
+	return saveChange(doc, op, args, before)
 }
 
-// parseImageInput checks whether input is a markdown image reference
-// (![alt](path)) or a plain file path. It returns the image path and any
-// extracted alt text (empty when the input is a plain path).
-// It also handles the common case where the shell escapes "!" to "\!".
-func parseImageInput(input string) (path, altText string) {
-	trimmed := strings.TrimSpace(input)
-	// Some shells escape "!" to "\!", so strip the leading backslash.
-	if strings.HasPrefix(trimmed, `\![`) {
-		trimmed = trimmed[1:]
-	}
-	if strings.HasPrefix(trimmed, "![") && strings.HasSuffix(trimmed, ")") {
-		// Extract alt text between ![ and ]
-		rest := trimmed[2:]
-		closeBracket := strings.Index(rest, "](")
-		if closeBracket != -1 {
-			altText = rest[:closeBracket]
-			path = rest[closeBracket+2 : len(rest)-1]
-			return path, altText
+// removeUnsavedImages removes the image files of entry that file does not
+// refer to, as when appending the entry failed after its images were copied
+// next to the document.
+func removeUnsavedImages(file string, entry []markdown.Block) {
+	data, _ := lockedfile.ReadFile(file)
+	for _, b := range entry {
+		if ib, ok := b.(markdown.ImageOutputBlock); ok && !bytes.Contains(data, []byte(ib.Filename)) {
+			os.Remove(filepath.Join(filepath.Dir(file), ib.Filename))
 		}
 	}
-	return trimmed, ""
+}
+
+// saveChange saves a document that has had an entry appended since it held
+// before, and journals the change.
+func saveChange(doc *document.Document, op string, args []string, before []markdown.Block) error {
+	if doc.Region() != "" {
+		return saveRegionChange(doc, op, args)
+	}
+	if err := doc.Save(); err != nil {
+		return err
+	}
+	after := doc.Blocks()
+	return journalChange(doc.Path(), op, args, before, after, after[len(before):], nil)
+}
+
+// saveRegionChange saves a change to a region of a file and journals it as
+// a rewrite of the whole file, since the journal's blocks describe whole
+// documents.
+func saveRegionChange(doc *document.Document, op string, args []string) error {
+	before, err := lockedfile.ReadFile(doc.Path())
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if err := doc.Save(); err != nil {
+		return err
+	}
+	after, err := lockedfile.ReadFile(doc.Path())
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	args = append(append([]string{}, args...), "--region", doc.Region())
+	return journalRewrite(doc.Path(), op, args, before, after)
 }
 
 // readBlocks opens a file and parses its blocks.
 func readBlocks(file string) ([]markdown.Block, error) {
-	f, err := os.Open(file)
+	data, err := lockedfile.ReadFile(file)
 	if err != nil {
 		return nil, fmt.Errorf("opening file: %w", err)
 	}
-	defer f.Close()
 
-	blocks, err := markdown.Parse(f)
+	blocks, err := markdown.Parse(bytes.NewReader(data))
 	if err != nil {
 		return nil, fmt.Errorf("parsing file: %w", err)
 	}
@@ -146,13 +240,24 @@ func readBlocks(file string) ([]markdown.Block, error) {
 	return blocks, nil
 }
 
-// writeBlocks creates/truncates a file and writes blocks to it.
+// writeBlocks writes blocks to file, replacing it atomically so that a crash
+// never leaves a partly written document.
 func writeBlocks(file string, blocks []markdown.Block) error {
-	f, err := os.Create(file)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+	var buf bytes.Buffer
+	if err := markdown.Write(&buf, blocks); err != nil {
+		return err
 	}
-	defer f.Close()
+	return lockedfile.WriteFile(file, buf.Bytes(), 0644)
+}
 
-	return markdown.Write(f, blocks)
+// lockDocument waits for the advisory lock on an existing document. Every
+// command that changes a document holds it from reading the document until
+// the change is written and journaled, so concurrent commands take turns
+// rather than overwriting each other's entries.
+func lockDocument(file string) (unlock func(), err error) {
+	unlock, err = lockedfile.Lock(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	return unlock, nil
 }
@@ -1,13 +1,19 @@
 package cmd
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
 )
 
 func TestNote(t *testing.T) {
@@ -61,6 +67,36 @@ func TestNoteMultiple(t *testing.T) {
 	}
 }
 
+func TestNoteRecordsEntryID(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "First"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := markdown.Entries(blocks)
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].ID() == "" || entries[1].ID() == "" {
+		t.Errorf("expected every entry to have an ID, got %q and %q", entries[0].ID(), entries[1].ID())
+	}
+	if entries[0].ID() == entries[1].ID() {
+		t.Errorf("expected distinct entry IDs, got %q twice", entries[0].ID())
+	}
+}
+
 func TestNoteNoFile(t *testing.T) {
 	err := Note("/nonexistent/path/demo.md", "Hello")
 	if err == nil {
@@ -164,6 +200,52 @@ func TestImage(t *testing.T) {
 	}
 }
 
+func TestImageFailedAppendRemovesCopy(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "test.png")
+	if err := os.WriteFile(src, minimalPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the lock so that the image is copied but not yet appended, and
+	// seal the document in the meantime.
+	unlock, err := lockDocument(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() { done <- Image(file, src, "") }()
+	pngs := func() []string {
+		found, _ := filepath.Glob(filepath.Join(dir, "*.png"))
+		return found
+	}
+	for deadline := time.Now().Add(5 * time.Second); len(pngs()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the image to be copied")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBlocks(file, append(blocks, markdown.SealBlock{Hash: stateHash(blocks)})); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+
+	if err := <-done; err == nil || !strings.Contains(err.Error(), "sealed") {
+		t.Errorf("expected the append to a sealed document to fail, got %v", err)
+	}
+	if found := pngs(); len(found) != 0 {
+		t.Errorf("expected the copied image to be removed, got %v", found)
+	}
+}
+
 func TestImageMarkdownRef(t *testing.T) {
 	dir := t.TempDir()
 	file := filepath.Join(dir, "demo.md")
@@ -292,32 +374,6 @@ func TestImageCallsRemotePost(t *testing.T) {
 	}
 }
 
-func TestParseImageInput(t *testing.T) {
-	tests := []struct {
-		input   string
-		path    string
-		altText string
-	}{
-		{"/path/to/img.png", "/path/to/img.png", ""},
-		{"![alt text](/path/to/img.png)", "/path/to/img.png", "alt text"},
-		{"![](file.jpg)", "file.jpg", ""},
-		{"![Screenshot of homepage](shot.png)", "shot.png", "Screenshot of homepage"},
-		{"  ![padded](file.png)  ", "file.png", "padded"},
-		{"not-markdown.png", "not-markdown.png", ""},
-		{`\![escaped](file.png)`, "file.png", "escaped"},
-		{`\![alt text](/path/to/img.png)`, "/path/to/img.png", "alt text"},
-	}
-	for _, tt := range tests {
-		path, alt := parseImageInput(tt.input)
-		if path != tt.path {
-			t.Errorf("parseImageInput(%q): path = %q, want %q", tt.input, path, tt.path)
-		}
-		if alt != tt.altText {
-			t.Errorf("parseImageInput(%q): altText = %q, want %q", tt.input, alt, tt.altText)
-		}
-	}
-}
-
 func TestImageMarkdownRefEscapedBang(t *testing.T) {
 	dir := t.TempDir()
 	file := filepath.Join(dir, "demo.md")
@@ -362,3 +418,80 @@ func TestImageMarkdownRefBadPath(t *testing.T) {
 		t.Error("expected error for nonexistent image path in markdown ref")
 	}
 }
+
+func TestConcurrentExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("advisory locks are not taken on windows")
+	}
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Concurrent", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 8
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, _, err := Exec(file, "bash", fmt.Sprintf("echo %d", i), ""); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(markdown.Entries(blocks)); got != n {
+		t.Errorf("expected %d entries, got %d", n, got)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+	records, err := readJournal(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != n+1 {
+		t.Errorf("expected %d journal records, got %d", n+1, len(records))
+	}
+}
+
+func TestExecDoesNotHoldLock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	if err := Init(file, "Slow", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, _, err := Exec(file, "bash", "sleep 2; echo slow", "")
+		done <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	start := time.Now()
+	if err := Note(file, "quick"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected note not to wait for the running exec, took %v", elapsed)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := markdown.Entries(blocks)
+	if len(entries) != 2 || entries[0].Blocks[0].(markdown.CommentaryBlock).Text != "quick" {
+		t.Fatalf("expected the note and then the exec entry, got %+v", entries)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+}
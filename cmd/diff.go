@@ -0,0 +1,410 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// DocumentChange describes one difference between two showboat documents.
+// Change is "added", "removed" or "changed" and Kind is "title", "note",
+// "code" or "image". OldEntry and NewEntry are the 1-based positions of the
+// entry in each document, or 0 where it is absent. Fields lists the values
+// that differ; for an added or removed entry, all of its values.
+type DocumentChange struct {
+	Change   string        `json:"change"`
+	Kind     string        `json:"kind"`
+	EntryID  string        `json:"entry_id,omitempty"`
+	OldEntry int           `json:"old_entry,omitempty"`
+	NewEntry int           `json:"new_entry,omitempty"`
+	Fields   []FieldChange `json:"fields"`
+}
+
+// FieldChange is one value of an entry before and after. Field is "text",
+// "lang", "code", "role", "needs", "service", "ready", "output", "alt" or
+// "image". "service" and "ready" are the name and readiness check of a
+// service, and an image is compared by the SHA-256 hash of the file rather
+// than its generated filename. Role, needs and service fields are only
+// present when set. For the title, Field is "title" or a metadata key such
+// as "author".
+type FieldChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// String returns a human-readable description of the change, with a line
+// diff of each field.
+func (c DocumentChange) String() string {
+	var sb strings.Builder
+	sb.WriteString(c.Change + " " + c.Kind)
+	if c.Kind != "title" {
+		sb.WriteString(" entry")
+		if c.EntryID != "" {
+			sb.WriteString(" " + c.EntryID)
+		}
+		switch {
+		case c.NewEntry != 0:
+			fmt.Fprintf(&sb, " (#%d)", c.NewEntry)
+		case c.OldEntry != 0:
+			fmt.Fprintf(&sb, " (#%d in old)", c.OldEntry)
+		}
+	}
+	sb.WriteString(":")
+	for _, f := range c.Fields {
+		sb.WriteString("\n  " + f.Field + ":")
+		for _, l := range lineDiff(f.Old, f.New) {
+			sb.WriteString("\n    " + l)
+		}
+	}
+	return sb.String()
+}
+
+// DiffDocuments compares two showboat documents block by block. Entries are
+// paired by entry ID when both documents have it, and otherwise by content:
+// the same note text, the same code, or the same image reference. Changes
+// are returned in the order of the new document, with removed entries where
+// they were in the old one. Timestamps, hashes and provenance are ignored.
+func DiffDocuments(oldFile, newFile string) ([]DocumentChange, error) {
+	oldBlocks, err := readBlocks(oldFile)
+	if err != nil {
+		return nil, err
+	}
+	newBlocks, err := readBlocks(newFile)
+	if err != nil {
+		return nil, err
+	}
+	olds := diffEntries(oldBlocks, filepath.Dir(oldFile))
+	news := diffEntries(newBlocks, filepath.Dir(newFile))
+
+	var changes []DocumentChange
+	if fields := changedFields(titleFields(oldBlocks), titleFields(newBlocks)); len(fields) > 0 {
+		changes = append(changes, DocumentChange{Change: "changed", Kind: "title", Fields: fields})
+	}
+
+	match := matchEntries(olds, news)
+	emitted := 0
+	emitNew := func(upTo int) {
+		for ; emitted <= upTo; emitted++ {
+			n := news[emitted]
+			oi, ok := match.newToOld[emitted]
+			if !ok {
+				changes = append(changes, entryChange("added", n, 0, emitted+1))
+				continue
+			}
+			if fields := changedFields(olds[oi].fields, n.fields); len(fields) > 0 {
+				changes = append(changes, DocumentChange{
+					Change: "changed", Kind: n.kind, EntryID: n.id,
+					OldEntry: oi + 1, NewEntry: emitted + 1, Fields: fields,
+				})
+			}
+		}
+	}
+	for i, o := range olds {
+		ni, ok := match.oldToNew[i]
+		if !ok {
+			changes = append(changes, entryChange("removed", o, i+1, 0))
+			continue
+		}
+		emitNew(ni)
+	}
+	emitNew(len(news) - 1)
+	return changes, nil
+}
+
+// WriteDiffJSON writes changes as a JSON object naming both documents.
+func WriteDiffJSON(w io.Writer, oldFile, newFile string, changes []DocumentChange) error {
+	if changes == nil {
+		changes = []DocumentChange{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Old     string           `json:"old"`
+		New     string           `json:"new"`
+		Changes []DocumentChange `json:"changes"`
+	}{oldFile, newFile, changes})
+}
+
+// diffEntry is an entry reduced to the values that are compared. key is
+// what entries without a shared ID are paired by.
+type diffEntry struct {
+	id     string
+	kind   string
+	key    string
+	fields []entryField
+}
+
+type entryField struct {
+	name, value string
+}
+
+// diffEntries returns the comparable values of each entry in blocks.
+// Images are hashed relative to dir.
+func diffEntries(blocks []markdown.Block, dir string) []diffEntry {
+	var entries []diffEntry
+	for _, e := range markdown.Entries(blocks) {
+		d := diffEntry{id: e.ID()}
+		field := func(name, value string) {
+			d.fields = append(d.fields, entryField{name, value})
+		}
+		switch b := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			d.kind = "note"
+			d.key = b.Text
+			field("text", b.Text)
+		case markdown.CodeBlock:
+			if b.IsImage {
+				d.kind = "image"
+				field("code", b.Code)
+			} else {
+				d.kind = "code"
+				field("lang", b.Lang)
+				field("code", b.Code)
+				if b.Role != "" {
+					field("role", b.Role)
+				}
+				if b.Needs != "" {
+					field("needs", b.Needs)
+				}
+				if b.Service != nil {
+					field("service", b.Service.Name)
+					field("ready", b.Service.Ready)
+				}
+			}
+			d.key = b.Lang + "\x00" + b.Code
+			for _, ob := range e.Blocks[1:] {
+				switch o := ob.(type) {
+				case markdown.OutputBlock:
+					field("output", o.Content)
+				case markdown.ImageOutputBlock:
+					field("alt", o.AltText)
+					field("image", imageHash(filepath.Join(dir, o.Filename)))
+				}
+			}
+		}
+		d.key = d.kind + "\x00" + d.key
+		entries = append(entries, d)
+	}
+	return entries
+}
+
+// imageHash returns the content hash of an image file, or a note that it is
+// missing.
+func imageHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "missing " + filepath.Base(path)
+	}
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+type entryMatch struct {
+	oldToNew map[int]int
+	newToOld map[int]int
+}
+
+// matchEntries pairs entries by ID, then pairs the remaining entries with
+// identical content in document order.
+func matchEntries(olds, news []diffEntry) entryMatch {
+	m := entryMatch{oldToNew: map[int]int{}, newToOld: map[int]int{}}
+	byID := map[string]int{}
+	for i, n := range news {
+		if n.id != "" {
+			byID[n.id] = i
+		}
+	}
+	for i, o := range olds {
+		if ni, ok := byID[o.id]; ok && o.id != "" {
+			m.oldToNew[i] = ni
+			m.newToOld[ni] = i
+		}
+	}
+	for i, o := range olds {
+		if _, ok := m.oldToNew[i]; ok {
+			continue
+		}
+		for ni, n := range news {
+			if _, taken := m.newToOld[ni]; taken || n.key != o.key {
+				continue
+			}
+			m.oldToNew[i] = ni
+			m.newToOld[ni] = i
+			break
+		}
+	}
+	return m
+}
+
+// entryChange describes an added or removed entry by its non-empty values.
+func entryChange(change string, e diffEntry, oldEntry, newEntry int) DocumentChange {
+	c := DocumentChange{Change: change, Kind: e.kind, EntryID: e.id, OldEntry: oldEntry, NewEntry: newEntry}
+	for _, f := range e.fields {
+		if f.value == "" {
+			continue
+		}
+		if change == "added" {
+			c.Fields = append(c.Fields, FieldChange{Field: f.name, New: f.value})
+		} else {
+			c.Fields = append(c.Fields, FieldChange{Field: f.name, Old: f.value})
+		}
+	}
+	return c
+}
+
+// changedFields compares the values of two paired entries. A note paired
+// with code by ID reports every field of both.
+func changedFields(old, new []entryField) []FieldChange {
+	values := map[string]string{}
+	for _, f := range old {
+		values[f.name] = f.value
+	}
+	var changed []FieldChange
+	seen := map[string]bool{}
+	for _, f := range new {
+		seen[f.name] = true
+		if values[f.name] != f.value {
+			changed = append(changed, FieldChange{Field: f.name, Old: values[f.name], New: f.value})
+		}
+	}
+	for _, f := range old {
+		if !seen[f.name] {
+			changed = append(changed, FieldChange{Field: f.name, Old: f.value})
+		}
+	}
+	return changed
+}
+
+// titleFields returns the title and metadata of a document as fields, with
+// the metadata in the order of markdown.MetadataKeys. Empty metadata values
+// are left out.
+func titleFields(blocks []markdown.Block) []entryField {
+	var tb markdown.TitleBlock
+	if len(blocks) > 0 {
+		tb, _ = blocks[0].(markdown.TitleBlock)
+	}
+	fields := []entryField{{"title", tb.Title}}
+	for _, key := range markdown.MetadataKeys {
+		if v, _ := tb.Metadata.Get(key); v != "" {
+			fields = append(fields, entryField{key, v})
+		}
+	}
+	return fields
+}
+
+// maxDiffCells caps the size of the table lineDiff builds to find the
+// longest common subsequence of the changed lines. Outputs with more
+// changed lines than that are reported as removed and added in full.
+const maxDiffCells = 1 << 20
+
+// lineDiff returns a line diff of old and new, with removed lines prefixed
+// "- ", added lines "+ " and unchanged lines "  ".
+func lineDiff(old, new string) []string {
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// Lines shared at the start and end need no table.
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var lines []string
+	for _, l := range a[:prefix] {
+		lines = append(lines, "  "+l)
+	}
+	lines = append(lines, diffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, l := range a[len(a)-suffix:] {
+		lines = append(lines, "  "+l)
+	}
+
+	// Keep unchanged lines only near a change.
+	const context = 2
+	var out []string
+	skipped := false
+	for k, l := range lines {
+		near := !strings.HasPrefix(l, "  ")
+		for d := max(0, k-context); !near && d <= min(len(lines)-1, k+context); d++ {
+			near = !strings.HasPrefix(lines[d], "  ")
+		}
+		if !near {
+			skipped = true
+			continue
+		}
+		if skipped {
+			out = append(out, "  ...")
+			skipped = false
+		}
+		out = append(out, l)
+	}
+	if skipped {
+		out = append(out, "  ...")
+	}
+	return out
+}
+
+// diffMiddle diffs the lines between the common prefix and suffix.
+func diffMiddle(a, b []string) []string {
+	var lines []string
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, l := range a {
+			lines = append(lines, "- "+l)
+		}
+		for _, l := range b {
+			lines = append(lines, "+ "+l)
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] > lcs[i+1][j]):
+			lines = append(lines, "+ "+b[j])
+			j++
+		default:
+			lines = append(lines, "- "+a[i])
+			i++
+		}
+	}
+	return lines
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
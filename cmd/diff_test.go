@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestDiffDocuments(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.md")
+	if err := Init(oldFile, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(oldFile, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(oldFile, "bash", "echo 3 passed", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(oldFile, "bash", "echo removed", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	// The new document shares IDs with the old one for the first two
+	// entries, as a regenerated copy would.
+	newFile := filepath.Join(dir, "new.md")
+	data, err := os.ReadFile(oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pop(newFile); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks[3] = markdown.OutputBlock{Content: "4 passed\n"}
+	if err := writeBlocks(newFile, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(newFile, "Now with the new test."); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := DiffDocuments(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %d: %+v", len(changes), changes)
+	}
+	if c := changes[0]; c.Change != "changed" || c.Kind != "code" || c.NewEntry != 2 || len(c.Fields) != 1 || c.Fields[0].Field != "output" {
+		t.Errorf("expected changed output of entry 2, got %+v", c)
+	}
+	if !strings.Contains(changes[0].String(), "- 3 passed\n    + 4 passed") {
+		t.Errorf("expected a line diff, got:\n%s", changes[0].String())
+	}
+	if c := changes[1]; c.Change != "removed" || c.Kind != "code" || c.OldEntry != 3 || c.Fields[1].Old != "echo removed" {
+		t.Errorf("expected removed code entry, got %+v", c)
+	}
+	if c := changes[2]; c.Change != "added" || c.Kind != "note" || c.Fields[0].New != "Now with the new test." {
+		t.Errorf("expected added note, got %+v", c)
+	}
+
+	same, err := DiffDocuments(oldFile, oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(same) != 0 {
+		t.Errorf("expected no changes comparing a document with itself, got %+v", same)
+	}
+
+	var js strings.Builder
+	if err := WriteDiffJSON(&js, oldFile, newFile, changes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"change": "removed"`, `"field": "output"`, `"new": "4 passed\n"`} {
+		if !strings.Contains(js.String(), want) {
+			t.Errorf("expected JSON to contain %s, got:\n%s", want, js.String())
+		}
+	}
+}
+
+func TestDiffDocumentsByContent(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.md")
+	newFile := filepath.Join(dir, "new.md")
+	png := []byte("\x89PNG fake")
+	for name, content := range map[string][]byte{"a.png": png, "b.png": png, "c.png": []byte("\x89PNG other")} {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Entries without IDs, as written by older versions.
+	old := "# Demo\n\n*2026-01-01T00:00:00Z*\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n```bash {image}\nshot.png\n```\n\n![shot](a.png)\n"
+	renamed := "# Demo\n\n*2026-02-01T00:00:00Z*\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n```bash {image}\nshot.png\n```\n\n![shot](b.png)\n"
+	if err := os.WriteFile(oldFile, []byte(old), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, []byte(renamed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := DiffDocuments(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("expected an image with the same content to be unchanged, got %+v", changes)
+	}
+
+	if err := os.WriteFile(newFile, []byte(strings.Replace(renamed, "b.png", "c.png", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changes, err = DiffDocuments(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != "image" || changes[0].Fields[0].Field != "image" {
+		t.Errorf("expected a changed image, got %+v", changes)
+	}
+}
+
+func TestDiffDocumentsMetadata(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.md")
+	newFile := filepath.Join(dir, "new.md")
+	if err := Init(oldFile, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(oldFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(newFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := MetaSet(newFile, "author", "Ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := DiffDocuments(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Kind != "title" || len(changes[0].Fields) != 1 || changes[0].Fields[0] != (FieldChange{Field: "author", New: "Ada"}) {
+		t.Errorf("expected the added author, got %+v", changes)
+	}
+}
+
+func TestDiffDocumentsRoles(t *testing.T) {
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.md")
+	newFile := filepath.Join(dir, "new.md")
+	title := markdown.TitleBlock{Title: "Demo", DocumentID: "doc-uuid"}
+	oldBlocks := []markdown.Block{
+		title,
+		markdown.CodeBlock{Lang: "bash", Code: "sleep 60", ID: "web", Role: markdown.RoleService, Service: &markdown.Service{Name: "web", Ready: "port:8080"}},
+		markdown.OutputBlock{Content: "web listening on 8080\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo prep", ID: "prep", Role: markdown.RoleSetup},
+		markdown.OutputBlock{Content: "prep\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo step", ID: "step", Needs: "prep"},
+		markdown.OutputBlock{Content: "step\n"},
+	}
+	newBlocks := []markdown.Block{
+		title,
+		markdown.CodeBlock{Lang: "bash", Code: "sleep 60", ID: "web", Role: markdown.RoleService, Service: &markdown.Service{Name: "web", Ready: "port:9090"}},
+		markdown.OutputBlock{Content: "web listening on 8080\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo prep", ID: "prep"},
+		markdown.OutputBlock{Content: "prep\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo step", ID: "step"},
+		markdown.OutputBlock{Content: "step\n"},
+	}
+	if err := writeBlocks(oldFile, oldBlocks); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeBlocks(newFile, newBlocks); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := DiffDocuments(oldFile, newFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		for _, f := range c.Fields {
+			got = append(got, fmt.Sprintf("%s %s: %q -> %q", c.EntryID, f.Field, f.Old, f.New))
+		}
+	}
+	want := []string{
+		`web ready: "port:8080" -> "port:9090"`,
+		`prep role: "setup" -> ""`,
+		`step needs: "prep" -> ""`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected changes:\n%s\ngot:\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestLineDiffLarge(t *testing.T) {
+	// Past maxDiffCells the changed lines are reported in full; lines
+	// shared at the start and end are still kept out of it.
+	var old, new strings.Builder
+	old.WriteString("start\n")
+	new.WriteString("start\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&old, "old %d\n", i)
+		fmt.Fprintf(&new, "new %d\n", i)
+	}
+	old.WriteString("end\n")
+	new.WriteString("end\n")
+
+	lines := lineDiff(old.String(), new.String())
+	if len(lines) != 4002 || lines[0] != "  start" || lines[1] != "- old 0" || lines[2001] != "+ new 0" || lines[4001] != "  end" {
+		t.Errorf("expected every changed line removed then added, got %d lines starting %q", len(lines), lines[:3])
+	}
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+// Env appends an entry recording the OS, the kernel and the version of the
+// interpreter of each language used by the document's code blocks.
+func Env(file, workdir string) error {
+	return EnvWithOptions(file, workdir, EntryOptions{})
+}
+
+// EnvWithOptions is Env with optional behaviour controlled by opts.
+func EnvWithOptions(file, workdir string, opts EntryOptions) error {
+	return addEntry(file, workdir, opts.Region, "env", opts.idArgs(), func(doc *document.Document) error {
+		_, err := doc.AppendEnv(context.Background(), document.EntryOptions{ID: opts.ID})
+		return err
+	})
+}
+
+// EnvDrift is an item of a document's recorded environment fingerprint
+// that differs in the current environment.
+type EnvDrift struct {
+	EntryID  string
+	Name     string
+	Recorded string
+	Current  string
+}
+
+// String returns a human-readable description of the drift.
+func (d EnvDrift) String() string {
+	label := d.Name
+	if d.EntryID != "" {
+		label += fmt.Sprintf(" (entry %s)", d.EntryID)
+	}
+	return fmt.Sprintf("drift: %s: recorded %s, now %s", label, orUnknown(d.Recorded), orUnknown(d.Current))
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return fmt.Sprintf("%q", s)
+}
+
+// CheckEnv compares the most recent env entry of a document with the
+// current environment and returns the items that differ, in the order they
+// were recorded. It returns nil for a document without an env entry.
+func CheckEnv(file string, opts VerifyOptions) ([]EnvDrift, error) {
+	blocks, err := readBlocksIn(file, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded document.Fingerprint
+	var entryID string
+	for i, b := range blocks {
+		cb, ok := b.(markdown.CodeBlock)
+		if !ok || cb.Role != markdown.RoleEnv || i+1 >= len(blocks) {
+			continue
+		}
+		if ob, ok := blocks[i+1].(markdown.OutputBlock); ok {
+			recorded, entryID = document.ParseFingerprint(ob.Content), cb.ID
+		}
+	}
+	if recorded == nil {
+		return nil, nil
+	}
+
+	var langs []string
+	for _, item := range recorded {
+		if item.Name != "os" && item.Name != "kernel" {
+			langs = append(langs, item.Name)
+		}
+	}
+	current := document.CaptureFingerprint(context.Background(), langs)
+
+	var drift []EnvDrift
+	for _, item := range recorded {
+		value, _ := current.Get(item.Name)
+		if value != item.Value {
+			drift = append(drift, EnvDrift{EntryID: entryID, Name: item.Name, Recorded: item.Value, Current: value})
+		}
+	}
+	return drift, nil
+}
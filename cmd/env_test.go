@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnv(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Env", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Env(file, dir); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	for _, want := range []string{"```bash {env}\nshowboat env\n```", "os: ", "\nbash: "} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in document, got:\n%s", want, content)
+		}
+	}
+
+	drift, err := CheckEnv(file, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 0 {
+		t.Errorf("expected no drift in the same environment, got %v", drift)
+	}
+	diffs, err := Verify(file, "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected the env entry not to be re-run as code, got %v", diffs)
+	}
+
+	// Pretend the document was recorded with another version of bash.
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "bash: ") {
+			lines[i] = "bash: GNU bash, version 1.0"
+		}
+	}
+	if err := os.WriteFile(file, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	drift, err = CheckEnv(file, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drift) != 1 || drift[0].Name != "bash" || drift[0].Recorded != "GNU bash, version 1.0" {
+		t.Fatalf("expected drift in bash, got %v", drift)
+	}
+	if s := drift[0].String(); !strings.HasPrefix(s, `drift: bash (entry `) || !strings.Contains(s, `recorded "GNU bash, version 1.0", now "GNU bash`) {
+		t.Errorf("unexpected drift message %q", s)
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/simonw/showboat/convert"
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// ExportOptions controls Export.
+type ExportOptions struct {
+	// Verify re-runs every code block first and records in the export
+	// whether its output still matches. Workdir is where they run.
+	Verify  bool
+	Workdir string
+
+	// Package is the package name for "go-test" exports. Empty means a
+	// name derived from the document's directory.
+	Package string
+
+	// Fixtures is how "html" and "ipynb" exports show setup and teardown
+	// entries: "show" (the default), "collapse" or "hide".
+	Fixtures string
+}
+
+// Export writes a document to w in another format: "html" for a standalone
+// page with images embedded, "ipynb" for a Jupyter notebook, "json" for the
+// JSON document model, or "go-test" for a Go test file that verifies the
+// document when saved next to it.
+func Export(w io.Writer, file, format string, opts ExportOptions) error {
+	data, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	blocks, lines, err := markdown.ParseWithLines(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("parsing file: %w", err)
+	}
+	fixtures := convert.FixturesShow
+	if opts.Fixtures != "" {
+		if fixtures, err = convert.ParseFixtures(opts.Fixtures); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case "html":
+		htmlOpts := convert.HTMLOptions{BaseDir: filepath.Dir(file), Fixtures: fixtures}
+		if opts.Verify {
+			doc, err := document.Open(file, document.Options{Workdir: opts.Workdir})
+			if err != nil {
+				return err
+			}
+			results, err := doc.Verify(context.Background(), document.VerifyOptions{})
+			if err != nil {
+				return err
+			}
+			htmlOpts.Verified = true
+			htmlOpts.Ran = make(map[int]bool)
+			htmlOpts.Mismatches = make(map[int]string)
+			htmlOpts.Skipped = make(map[int]string)
+			for _, r := range results {
+				if r.Skipped != "" {
+					htmlOpts.Skipped[r.BlockIndex] = r.Skipped
+					continue
+				}
+				htmlOpts.Ran[r.BlockIndex] = true
+				if !r.Passed() {
+					htmlOpts.Mismatches[r.BlockIndex] = r.Actual
+				}
+			}
+		}
+		return convert.WriteHTML(w, blocks, htmlOpts)
+	case "ipynb":
+		return convert.WriteNotebook(w, blocks, convert.NotebookOptions{BaseDir: filepath.Dir(file), Fixtures: fixtures})
+	case "json":
+		return convert.WriteJSON(w, blocks, lines)
+	case "go-test":
+		pkg := opts.Package
+		if pkg == "" {
+			abs, err := filepath.Abs(filepath.Dir(file))
+			if err != nil {
+				return err
+			}
+			pkg = convert.GoPackageName(abs)
+		}
+		return convert.WriteGoTest(w, convert.GoTestOptions{Package: pkg, Document: filepath.Base(file)})
+	}
+	return fmt.Errorf("unknown export format: %s", format)
+}
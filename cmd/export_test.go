@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExportHTMLVerify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Export", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "A note"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := Export(&buf, file, "html", ExportOptions{Verify: true}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "<title>Export</title>") {
+		t.Errorf("expected document title, got:\n%s", out)
+	}
+	if !strings.Contains(out, "output verified") {
+		t.Errorf("expected verified status, got:\n%s", out)
+	}
+
+	if err := Export(&buf, file, "pdf", ExportOptions{}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
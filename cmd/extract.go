@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"fmt"
+	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/simonw/showboat/markdown"
@@ -11,7 +13,8 @@ import (
 // that would recreate it. OutputBlock and ImageOutputBlock are skipped since
 // they are generated by running code blocks. If outputFile is non-empty it is
 // used as the filename in the emitted commands; otherwise the input file path
-// is used.
+// is used. Entries that a later block needs are recreated with their
+// original ID (--id), so that the --needs of that block still refer to them.
 func Extract(file, outputFile string) ([]string, error) {
 	blocks, err := readBlocks(file)
 	if err != nil {
@@ -24,20 +27,62 @@ func Extract(file, outputFile string) ([]string, error) {
 	}
 	quotedTarget := shellQuote(target)
 
+	needed := map[string]bool{}
+	for _, block := range blocks {
+		if b, ok := block.(markdown.CodeBlock); ok {
+			for _, id := range b.NeedsList() {
+				needed[id] = true
+			}
+		}
+	}
+
 	var commands []string
 
 	for _, block := range blocks {
 		switch b := block.(type) {
 		case markdown.TitleBlock:
-			commands = append(commands, fmt.Sprintf("showboat init %s %s", quotedTarget, shellQuote(b.Title)))
+			commands = append(commands, withText("showboat init "+quotedTarget, b.Title, ""))
+			for _, key := range markdown.MetadataKeys {
+				if v, _ := b.Metadata.Get(key); v != "" {
+					commands = append(commands, withText(fmt.Sprintf("showboat meta set %s %s", quotedTarget, key), v, ""))
+				}
+			}
 		case markdown.CommentaryBlock:
-			commands = append(commands, fmt.Sprintf("showboat note %s %s", quotedTarget, shellQuote(b.Text)))
+			commands = append(commands, withText("showboat note "+quotedTarget, b.Text, ""))
 		case markdown.CodeBlock:
+			// The code is added last by withText, as it goes after the
+			// flags when it starts with "-".
+			var command, flags string
+			hasCode := true
 			if b.IsImage {
-				commands = append(commands, fmt.Sprintf("showboat image %s %s", quotedTarget, shellQuote(b.Code)))
+				command = "showboat image " + quotedTarget
+			} else if b.Role == markdown.RoleGitState {
+				command = "showboat git-state " + quotedTarget
+				hasCode = false
+			} else if b.Role == markdown.RoleEnv {
+				command = "showboat env " + quotedTarget
+				hasCode = false
+			} else if b.Role == markdown.RoleService && b.Service != nil {
+				command = fmt.Sprintf("showboat service start %s %s", quotedTarget, shellQuote(b.Service.Name))
+				flags = readyFlag(b.Service.Ready)
 			} else {
-				commands = append(commands, fmt.Sprintf("showboat exec %s %s %s", quotedTarget, b.Lang, shellQuote(b.Code)))
+				command = fmt.Sprintf("showboat exec %s %s", quotedTarget, b.Lang)
+				if b.IsFixture() {
+					flags += " --" + b.Role
+				}
+				if b.Needs != "" {
+					flags += " --needs " + shellQuote(b.Needs)
+				}
+			}
+			if b.ID != "" && needed[b.ID] {
+				flags += " --id " + shellQuote(b.ID)
 			}
+			if hasCode {
+				command = withText(command, b.Code, flags)
+			} else {
+				command += flags
+			}
+			commands = append(commands, command)
 		case markdown.OutputBlock:
 			// Skip: generated by running code blocks
 		case markdown.ImageOutputBlock:
@@ -48,6 +93,168 @@ func Extract(file, outputFile string) ([]string, error) {
 	return commands, nil
 }
 
+// withText returns command followed by text, quoted, and flags, which start
+// with a space. Text starting with "-" is put after "--", with the flags
+// before it, so that showboat does not take it for a flag.
+func withText(command, text, flags string) string {
+	if strings.HasPrefix(text, "-") {
+		return command + flags + " -- " + shellQuote(text)
+	}
+	return command + " " + shellQuote(text) + flags
+}
+
+// readyFlag returns the "service start" flag for a readiness check, with a
+// leading space, or "" for none.
+func readyFlag(ready string) string {
+	kind, value, ok := strings.Cut(ready, ":")
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf(" --%s %s", kind, shellQuote(value))
+}
+
+// scriptPrelude defines the check function used by ExtractScript. Command
+// substitution strips trailing newlines, so a sentinel is appended to the
+// output and removed again to compare it exactly, as verify does.
+const scriptPrelude = `set -u
+
+failures=0
+checked=0
+
+# check <label> <lang> <code> <expected output>
+check() {
+  local label=$1 lang=$2 code=$3 expected=$4 actual
+  actual=$("$lang" -c "$code" 2>&1 </dev/null; printf x)
+  actual=${actual%x}
+  checked=$((checked + 1))
+  if [ "$actual" == "$expected" ]; then
+    echo "ok: $label"
+  else
+    echo "FAIL: $label"
+    diff -u --label expected --label actual <(printf '%s' "$expected") <(printf '%s' "$actual")
+    failures=$((failures + 1))
+  fi
+}
+`
+
+// scriptServicePrelude defines start_service, which starts a service in the
+// background in a process group of its own and waits up to 30 seconds for
+// its readiness check. Every service is killed when the script exits.
+const scriptServicePrelude = `
+services=()
+trap 'for pid in ${services[@]+"${services[@]}"}; do kill -- "-$pid" 2>/dev/null; done' EXIT
+
+# start_service <label> <lang> <code> <readiness check>
+start_service() {
+  local label=$1 lang=$2 code=$3 ready=$4 log tries=0
+  log=$(mktemp)
+  set -m
+  "$lang" -c "$code" >"$log" 2>&1 </dev/null &
+  set +m
+  services+=("$!")
+  checked=$((checked + 1))
+  until case $ready in
+    port:*) (exec 3<>"/dev/tcp/localhost/${ready#port:}") 2>/dev/null ;;
+    log:*) grep -qF -- "${ready#log:}" "$log" ;;
+    http:*) curl -fs -o /dev/null "${ready#http:}" ;;
+    *) true ;;
+  esac; do
+    tries=$((tries + 1))
+    if [ "$tries" -ge 300 ]; then
+      echo "FAIL: $label: not ready after 30s"
+      cat "$log"
+      failures=$((failures + 1))
+      return
+    fi
+    sleep 0.1
+  done
+  echo "ok: $label"
+}
+`
+
+// ExtractScript returns a standalone bash script that re-runs the code
+// blocks of a document that verify re-runs (see markdown.RunOrder) and
+// compares their output with the recorded output, printing a diff for each
+// mismatch. Setup blocks run first and
+// teardown blocks last, as in verify. Services are started in the
+// background with the setup blocks and killed when the script exits. The
+// script exits with status 1 if any output differs. It does not need
+// showboat to run. Commentary is kept as comments; image blocks and git
+// state and env entries are skipped.
+func ExtractScript(file string) (string, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#!/usr/bin/env bash\n")
+	fmt.Fprintf(&sb, "# Checks the recorded outputs of %s.\n", filepath.Base(file))
+	sb.WriteString("# Generated by \"showboat extract --format script\"; showboat is not needed\n")
+	sb.WriteString("# to run it. Run it from the directory the commands expect.\n\n")
+	sb.WriteString(scriptPrelude)
+	for _, block := range blocks {
+		if b, ok := block.(markdown.CodeBlock); ok && b.Role == markdown.RoleService && b.Service != nil {
+			sb.WriteString(scriptServicePrelude)
+			break
+		}
+	}
+
+	run := map[int]bool{}
+	for _, i := range markdown.RunOrder(blocks) {
+		run[i] = true
+	}
+	check := func(i int, b markdown.CodeBlock) {
+		expected := blocks[i+1].(markdown.OutputBlock).Content
+		label := fmt.Sprintf("block %d", i)
+		if b.ID != "" {
+			label += fmt.Sprintf(" (entry %s)", b.ID)
+		}
+		if b.Role == markdown.RoleService && b.Service != nil {
+			fmt.Fprintf(&sb, "\nstart_service %s %s \\\n  %s \\\n  %s\n",
+				shellQuote(label), shellQuote(b.Lang), shellQuote(b.Code), shellQuote(b.Service.Ready))
+			return
+		}
+		fmt.Fprintf(&sb, "\ncheck %s %s \\\n  %s \\\n  %s\n",
+			shellQuote(label), shellQuote(b.Lang), shellQuote(b.Code), shellQuote(expected))
+	}
+	// Like verify, run setup and service blocks first and teardown blocks
+	// last.
+	fixtures := func(roles ...string) {
+		for i, block := range blocks {
+			if b, ok := block.(markdown.CodeBlock); ok && run[i] && slices.Contains(roles, b.Role) {
+				check(i, b)
+			}
+		}
+	}
+
+	fixtures(markdown.RoleSetup, markdown.RoleService)
+	for i, block := range blocks {
+		switch b := block.(type) {
+		case markdown.CommentaryBlock:
+			sb.WriteString("\n")
+			for _, line := range strings.Split(b.Text, "\n") {
+				sb.WriteString(strings.TrimRight("# "+line, " ") + "\n")
+			}
+		case markdown.CodeBlock:
+			if !run[i] || b.IsFixture() || b.Role == markdown.RoleService {
+				continue
+			}
+			check(i, b)
+		}
+	}
+	fixtures(markdown.RoleTeardown)
+
+	sb.WriteString(`
+echo
+echo "$((checked - failures)) of $checked blocks match"
+if [ "$failures" -gt 0 ]; then
+  exit 1
+fi
+`)
+	return sb.String(), nil
+}
+
 // shellQuote wraps a string in single quotes if it contains spaces, special
 // characters, or is empty. Otherwise it returns the string as-is.
 func shellQuote(s string) string {
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -88,3 +90,98 @@ func TestExtractShellQuote(t *testing.T) {
 		}
 	}
 }
+
+func TestExtractScript(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Say hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello\necho 'it''s'", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo oops >&2; exit 3", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	script, err := ExtractScript(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(script, "# Say hello") {
+		t.Errorf("expected commentary as a comment, got:\n%s", script)
+	}
+	scriptFile := filepath.Join(dir, "check.sh")
+	if err := os.WriteFile(scriptFile, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := exec.Command("bash", scriptFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("expected script to pass, got %v:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "2 of 2 blocks match") {
+		t.Errorf("expected summary, got:\n%s", out)
+	}
+
+	// Change a recorded output: the script should report it and fail.
+	content, _ := os.ReadFile(file)
+	if err := os.WriteFile(file, []byte(strings.Replace(string(content), "```output\nhello\n", "```output\ngoodbye\n", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	script, err = ExtractScript(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(scriptFile, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	out, err = exec.Command("bash", scriptFile).CombinedOutput()
+	if err == nil {
+		t.Fatalf("expected script to fail, got:\n%s", out)
+	}
+	if !strings.Contains(string(out), "-goodbye") || !strings.Contains(string(out), "+hello") {
+		t.Errorf("expected a diff, got:\n%s", out)
+	}
+}
+
+func TestExtractScriptMatchesVerify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	// Hand-written code blocks with no recorded output, including fixtures,
+	// are not run by verify, so the script must not check them either.
+	doc := "# Demo\n\n```bash {setup}\ntouch ready\n```\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n" +
+		"```bash\necho not recorded\n```\n\n```bash {teardown}\nrm -f ready\n```\n"
+	if err := os.WriteFile(file, []byte(doc), 0644); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := Verify(file, "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Fatalf("expected verify to pass, got %v", diffs)
+	}
+
+	script, err := ExtractScript(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scriptFile := filepath.Join(dir, "check.sh")
+	if err := os.WriteFile(scriptFile, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	c := exec.Command("bash", scriptFile)
+	c.Dir = dir
+	out, err := c.CombinedOutput()
+	if err != nil {
+		t.Fatalf("expected the script to pass like verify, got %v:\n%s", err, out)
+	}
+	if !strings.Contains(string(out), "1 of 1 blocks match") {
+		t.Errorf("expected only the recorded block to be checked, got:\n%s", out)
+	}
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+// GitState appends an entry recording the commit, branch and uncommitted
+// changes of the git working tree in workdir, or the current directory.
+func GitState(file, workdir string) error {
+	return GitStateWithOptions(file, workdir, EntryOptions{})
+}
+
+// GitStateWithOptions is GitState with optional behaviour controlled by opts.
+func GitStateWithOptions(file, workdir string, opts EntryOptions) error {
+	return addEntry(file, workdir, opts.Region, "git-state", opts.idArgs(), func(doc *document.Document) error {
+		_, err := doc.AppendGitState(context.Background(), document.EntryOptions{ID: opts.ID})
+		return err
+	})
+}
+
+// GitWarning describes a way in which the working tree a document is
+// verified in differs from the git state recorded in it. Files lists the
+// files that differ, where known.
+type GitWarning struct {
+	EntryID string
+	Reason  string
+	Files   []string
+}
+
+// String returns a human-readable description of the warning.
+func (w GitWarning) String() string {
+	label := "git state"
+	if w.EntryID != "" {
+		label += fmt.Sprintf(" (entry %s)", w.EntryID)
+	}
+	s := fmt.Sprintf("warning: %s: %s", label, w.Reason)
+	for _, f := range w.Files {
+		s += "\n  " + f
+	}
+	return s
+}
+
+// CheckGitState compares the most recent git state entry of a document with
+// the working tree in workdir, or the current directory. It warns if the
+// working tree is at a different commit or has uncommitted changes, naming
+// the files that differ from the recorded commit, and if the state was
+// recorded with uncommitted changes. The document's own files, such as its
+// journal, are not counted as changes (see document.OwnFiles). It returns nil for a document without a git state
+// entry.
+func CheckGitState(file, workdir string, opts VerifyOptions) ([]GitWarning, error) {
+	blocks, err := readBlocksIn(file, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded document.GitState
+	var entryID string
+	found := false
+	for i, b := range blocks {
+		cb, ok := b.(markdown.CodeBlock)
+		if !ok || cb.Role != markdown.RoleGitState || i+1 >= len(blocks) {
+			continue
+		}
+		if ob, ok := blocks[i+1].(markdown.OutputBlock); ok {
+			if g, ok := document.ParseGitState(ob.Content); ok {
+				recorded, entryID, found = g, cb.ID, true
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	var warnings []GitWarning
+	warn := func(reason string, files []string) {
+		warnings = append(warnings, GitWarning{EntryID: entryID, Reason: reason, Files: files})
+	}
+	if recorded.Dirty {
+		warn("recorded from a working tree with uncommitted changes", nil)
+	}
+	ctx := context.Background()
+	ignore := document.OwnFiles(file)
+	current, err := document.CaptureGitState(ctx, workdir, ignore...)
+	if err != nil {
+		warn(fmt.Sprintf("recorded at commit %s, but the working tree is not a git repository", shortCommit(recorded.Commit)), nil)
+		return warnings, nil
+	}
+	if current.Commit != recorded.Commit {
+		reason := fmt.Sprintf("recorded at commit %s, working tree is at %s", shortCommit(recorded.Commit), shortCommit(current.Commit))
+		files, err := document.GitChangedFiles(ctx, workdir, recorded.Commit, ignore...)
+		if err != nil {
+			reason += " (recorded commit not found in this repository)"
+		}
+		warn(reason, files)
+	} else if current.Dirty {
+		files, _ := document.GitChangedFiles(ctx, workdir, "", ignore...)
+		warn("working tree has uncommitted changes", files)
+	}
+	return warnings, nil
+}
+
+func shortCommit(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository with one commit in a temporary directory.
+func gitRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	run := func(args ...string) {
+		c := exec.Command("git", args...)
+		c.Dir = dir
+		c.Env = append(os.Environ(), "GIT_AUTHOR_NAME=t", "GIT_AUTHOR_EMAIL=t@example.com",
+			"GIT_COMMITTER_NAME=t", "GIT_COMMITTER_EMAIL=t@example.com")
+		if out, err := c.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	run("init", "-q", "-b", "main")
+	if err := os.WriteFile(filepath.Join(dir, "app.txt"), []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run("add", "app.txt")
+	run("commit", "-q", "-m", "first")
+	return dir
+}
+
+func TestGitState(t *testing.T) {
+	dir := gitRepo(t)
+	file := filepath.Join(dir, "demo.md")
+
+	if err := InitWithOptions(file, "Demo", "dev", InitOptions{Workdir: dir, GitState: true}); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	for _, want := range []string{"```bash {git-state}\nshowboat git-state\n```", "branch: main\ndirty: no\n"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in document, got:\n%s", want, content)
+		}
+	}
+
+	// The document and its journal are untracked but do not count, and
+	// neither are the logs of its running services.
+	if err := os.MkdirAll(filepath.Join(dir, "demo.md.services"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "demo.md.services", "web.log"), []byte("listening\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err := CheckGitState(file, dir, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("expected no warnings for an unchanged tree, got %v", warnings)
+	}
+	diffs, err := Verify(file, "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected the git state entry not to be re-run as code, got %v", diffs)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "app.txt"), []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	warnings, err = CheckGitState(file, dir, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Reason, "uncommitted changes") ||
+		strings.Join(warnings[0].Files, ",") != "app.txt" {
+		t.Errorf("expected a warning naming app.txt, got %v", warnings)
+	}
+
+	if err := GitState(file, dir); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = os.ReadFile(file)
+	if !strings.Contains(string(content), "dirty: yes\n app.txt | 2 +-\n") {
+		t.Errorf("expected the second entry to record the diffstat, got:\n%s", content)
+	}
+	warnings, _ = CheckGitState(file, dir, VerifyOptions{})
+	if len(warnings) == 0 || !strings.Contains(warnings[0].String(), "recorded from a working tree with uncommitted changes") {
+		t.Errorf("expected a warning about the dirty recording, got %v", warnings)
+	}
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/simonw/showboat/convert"
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+// ImportOptions controls optional behaviour of Import.
+type ImportOptions struct {
+	// Execute re-runs each command of a transcript in Workdir and records
+	// the new output instead of the output in the transcript.
+	Execute bool
+	Workdir string
+}
+
+// Import creates a new showboat document at file from src, which is in
+// format "ipynb", "json" or "transcript".
+//
+// A JSON document model is written back exactly as it was exported. For a
+// notebook or a transcript, images are written next to file, and entries are
+// given IDs and chained as if they had been added one at a time, so the
+// result can be extended and verified like any other document.
+//
+// Returns an error if file already exists.
+func Import(src, file, format, version string) error {
+	return ImportWithOptions(src, file, format, version, ImportOptions{})
+}
+
+// ImportWithOptions is like Import with additional options.
+func ImportWithOptions(src, file, format, version string, opts ImportOptions) error {
+	if _, err := os.Stat(file); err == nil {
+		return fmt.Errorf("file already exists: %s", file)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", src, err)
+	}
+	defer in.Close()
+
+	destDir := filepath.Dir(file)
+	saveImage := func(ext string, data []byte) (string, error) {
+		name := fmt.Sprintf("%s-%s%s", uuid.New().String()[:8], time.Now().UTC().Format("2006-01-02"), ext)
+		if err := os.WriteFile(filepath.Join(destDir, name), data, 0644); err != nil {
+			return "", fmt.Errorf("writing image: %w", err)
+		}
+		return name, nil
+	}
+
+	var blocks []markdown.Block
+	switch format {
+	case "ipynb":
+		imported, err := convert.ReadNotebook(in, saveImage)
+		if err != nil {
+			return err
+		}
+		blocks = chainImported(src, version, imported)
+	case "json":
+		blocks, err = convert.ReadJSON(in)
+		if err != nil {
+			return err
+		}
+	case "transcript":
+		imported, err := convert.ReadTranscript(in)
+		if err != nil {
+			return err
+		}
+		if opts.Execute {
+			return rerunTranscript(src, file, version, imported, opts.Workdir)
+		}
+		blocks = chainImported(src, version, imported)
+	default:
+		return fmt.Errorf("unknown import format: %s", format)
+	}
+
+	if err := writeBlocks(file, blocks); err != nil {
+		return err
+	}
+	if err := journalImport(src, file, blocks); err != nil {
+		return err
+	}
+
+	if docID := documentID(blocks); docID != "" {
+		postSection(docID, "init", blocks[:1])
+		postEntries(file, docID, blocks)
+	}
+	return nil
+}
+
+// rerunTranscript builds a document from a transcript's commentary and
+// commands, running each command afresh rather than trusting its recorded
+// output.
+func rerunTranscript(src, file, version string, imported []markdown.Block, workdir string) error {
+	ctx := context.Background()
+	title := imported[0].(markdown.TitleBlock).Title
+	if title == "" {
+		base := filepath.Base(src)
+		title = base[:len(base)-len(filepath.Ext(base))]
+	}
+	doc, err := document.Create(ctx, file, title, document.Options{Sink: remoteSink{}, Version: version, Workdir: workdir})
+	if err != nil {
+		return err
+	}
+
+	for _, e := range markdown.Entries(imported) {
+		switch b := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			_, err = doc.AppendNote(ctx, b.Text)
+		case markdown.CodeBlock:
+			_, err = doc.Exec(ctx, b.Lang, b.Code, document.EntryOptions{})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := doc.Save(); err != nil {
+		return err
+	}
+	return journalImport(src, file, doc.Blocks())
+}
+
+// journalImport starts a fresh journal for an imported document.
+func journalImport(src, file string, blocks []markdown.Block) error {
+	if err := removeStale(file); err != nil {
+		return err
+	}
+	return journalChange(file, "import", []string{src}, nil, blocks, blocks, nil)
+}
+
+// chainImported fills in missing title fields, then gives every entry an ID
+// and a hash that chains it to the entry before.
+func chainImported(src, version string, imported []markdown.Block) []markdown.Block {
+	title := imported[0].(markdown.TitleBlock)
+	if title.Title == "" {
+		base := filepath.Base(src)
+		title.Title = base[:len(base)-len(filepath.Ext(base))]
+	}
+	if title.Timestamp == "" {
+		title.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	}
+	if title.Version == "" {
+		title.Version = version
+	}
+	if title.DocumentID == "" {
+		title.DocumentID = uuid.New().String()
+	}
+
+	blocks := []markdown.Block{title}
+	for _, e := range markdown.Entries(imported) {
+		entry := append([]markdown.Block{}, e.Blocks...)
+		switch b := entry[0].(type) {
+		case markdown.CommentaryBlock:
+			if b.ID == "" {
+				b.ID = document.NewEntryID()
+			}
+			entry[0] = b
+		case markdown.CodeBlock:
+			if b.ID == "" {
+				b.ID = document.NewEntryID()
+			}
+			entry[0] = b
+		}
+		blocks = append(blocks, markdown.ChainEntry(blocks, entry)...)
+	}
+	return blocks
+}
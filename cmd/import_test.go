@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestImportNotebook(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "analysis.ipynb")
+	nb := `{"nbformat": 4, "nbformat_minor": 4,
+ "metadata": {"kernelspec": {"name": "bash", "display_name": "Bash", "language": "bash"}},
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": "Check the greeting"},
+  {"cell_type": "code", "metadata": {}, "source": "echo hello", "outputs": [{"output_type": "stream", "name": "stdout", "text": "hello\n"}]}
+ ]}`
+	if err := os.WriteFile(src, []byte(nb), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "analysis.md")
+
+	if err := Import(src, file, "ipynb", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	if !strings.HasPrefix(s, "# analysis\n") {
+		t.Errorf("expected title from the notebook filename, got:\n%s", s)
+	}
+	if !strings.Contains(s, "```bash\necho hello\n```") {
+		t.Errorf("expected bash code block, got:\n%s", s)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected imported document to verify, got %v", diffs)
+	}
+
+	if err := Import(src, file, "ipynb", "dev"); err == nil {
+		t.Error("expected error when the destination exists")
+	}
+}
+
+func TestExportNotebook(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf strings.Builder
+	if err := Export(&buf, file, "ipynb", ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"nbformat": 4`) || !strings.Contains(buf.String(), `"echo hi"`) {
+		t.Errorf("expected a notebook with the code cell, got:\n%s", buf.String())
+	}
+}
+
+func TestJSONExportImportRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "A note"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(file, "bash", "echo hi", "", EntryOptions{Provenance: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	jsonFile := filepath.Join(dir, "demo.json")
+	f, err := os.Create(jsonFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Export(f, file, "json", ExportOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	copied := filepath.Join(dir, "copy.md")
+	if err := Import(jsonFile, copied, "json", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(file)
+	imported, _ := os.ReadFile(copied)
+	if string(original) != string(imported) {
+		t.Errorf("expected identical markdown.\noriginal:\n%s\nimported:\n%s", original, imported)
+	}
+}
+
+func TestImportTranscript(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "session.txt")
+	transcript := "Check the greeting.\n\n$ echo hello\nhello\n$ echo changed\nstale output\n"
+	if err := os.WriteFile(src, []byte(transcript), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "session.md")
+	if err := Import(src, file, "transcript", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	if !strings.HasPrefix(s, "# session\n") {
+		t.Errorf("expected title from the transcript filename, got:\n%s", s)
+	}
+	if !strings.Contains(s, "Check the greeting.") || !strings.Contains(s, "```output\nstale output\n```") {
+		t.Errorf("expected commentary and recorded output, got:\n%s", s)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+
+	rerun := filepath.Join(dir, "rerun.md")
+	if err := ImportWithOptions(src, rerun, "transcript", "dev", ImportOptions{Execute: true}); err != nil {
+		t.Fatal(err)
+	}
+	content, err = os.ReadFile(rerun)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "stale output") || !strings.Contains(string(content), "```output\nchanged\n```") {
+		t.Errorf("expected output from re-running the commands, got:\n%s", content)
+	}
+	diffs, err := Verify(rerun, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected re-run document to verify, got %v", diffs)
+	}
+	if _, err := os.Stat(journalPath(rerun)); err != nil {
+		t.Errorf("expected a journal for the re-run document: %v", err)
+	}
+}
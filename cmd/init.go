@@ -1,37 +1,85 @@
 package cmd
 
 import (
-	"fmt"
-	"os"
+	"context"
+	"path/filepath"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/simonw/showboat/document"
 	"github.com/simonw/showboat/markdown"
 )
 
 // Init creates a new showboat document with a title and timestamp.
 // Returns an error if the file already exists.
 func Init(file, title, version string) error {
-	if _, err := os.Stat(file); err == nil {
-		return fmt.Errorf("file already exists: %s", file)
-	}
+	return InitWithOptions(file, title, version, InitOptions{})
+}
+
+// InitOptions controls optional behaviour of InitWithOptions.
+type InitOptions struct {
+	// Template is the name of a template in a .showboat/templates
+	// directory, or the path to a template file. See Templates.
+	Template string
+
+	// Workdir is the directory the template's code runs in.
+	Workdir string
+
+	// Metadata is recorded in the title block.
+	Metadata markdown.Metadata
+
+	// GitState records the state of the git working tree in Workdir as
+	// the first entry. See GitState.
+	GitState bool
+}
 
-	timestamp := time.Now().UTC().Format(time.RFC3339)
-	docID := uuid.New().String()
-	blocks := []markdown.Block{
-		markdown.TitleBlock{Title: title, Timestamp: timestamp, Version: version, DocumentID: docID},
+// InitWithOptions is Init with optional behaviour controlled by opts. With a
+// template, the document starts with the template's notes and code, with
+// {{title}}, {{date}}, {{author}} and {{branch}} replaced, and the code is
+// run so that its output is recorded. A heading at the top of the template
+// is used as the title.
+func InitWithOptions(file, title, version string, opts InitOptions) error {
+	ctx := context.Background()
+	args := []string{title}
+	var template []markdown.Block
+	if opts.Template != "" {
+		path, err := findTemplate(opts.Template, filepath.Dir(file))
+		if err != nil {
+			return err
+		}
+		dir := opts.Workdir
+		if dir == "" {
+			dir = filepath.Dir(file)
+		}
+		template, err = readTemplate(path, templateVars(title, dir, time.Now()))
+		if err != nil {
+			return err
+		}
+		if tb := titleOf(template); tb.Title != "" {
+			title = tb.Title
+		}
+		args = append(args, "--template", opts.Template)
 	}
 
-	f, err := os.Create(file)
+	doc, err := document.Create(ctx, file, title, document.Options{Sink: remoteSink{}, Version: version, Workdir: opts.Workdir, Metadata: opts.Metadata})
 	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+		return err
 	}
-	defer f.Close()
-
-	if err := markdown.Write(f, blocks); err != nil {
+	if opts.GitState {
+		if _, err := doc.AppendGitState(ctx, document.EntryOptions{}); err != nil {
+			return err
+		}
+		args = append(args, "--git-state")
+	}
+	if err := applyTemplate(ctx, doc, template); err != nil {
+		return err
+	}
+	if err := doc.Save(); err != nil {
 		return err
 	}
 
-	postSection(docID, "init", blocks)
-	return nil
+	if err := removeStale(file); err != nil {
+		return err
+	}
+	blocks := doc.Blocks()
+	return journalChange(file, "init", args, nil, blocks, blocks, nil)
 }
@@ -1,6 +1,8 @@
 package cmd
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -96,3 +98,163 @@ func TestInitErrorsIfExists(t *testing.T) {
 		t.Error("expected error when file exists")
 	}
 }
+
+func TestInitRemovesStaleAppendRecord(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "e.md")
+	if err := Init(file, "Old doc", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	// A crash record left next to a document that is then deleted.
+	if err := os.WriteFile(file+".append", []byte("10"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Init(file, "New document title", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file + ".append"); !os.IsNotExist(err) {
+		t.Errorf("expected init to remove the stale append record, got %v", err)
+	}
+	if err := Note(file, "x"); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tb, ok := blocks[0].(markdown.TitleBlock); !ok || tb.Title != "New document title" || tb.DocumentID == "" {
+		t.Errorf("expected the new title to be intact, got %#v", blocks[0])
+	}
+}
+
+func TestInitTemplate(t *testing.T) {
+	project := t.TempDir()
+	t.Setenv("USER", "alice")
+	t.Setenv("GIT_CONFIG_GLOBAL", filepath.Join(project, "no-gitconfig"))
+	templates := filepath.Join(project, ".showboat", "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	template := "# {{title}} demo\n\nWritten by {{ author }} on {{date}}.\n\n```bash\necho 'branch={{branch}} {{.Name}}'\n```\n\n```output\nstale\n```\n"
+	if err := os.WriteFile(filepath.Join(templates, "standard.md"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	docs := filepath.Join(project, "docs")
+	if err := os.Mkdir(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	found, err := Templates(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Name != "standard" {
+		t.Errorf("expected the project template to be found, got %v", found)
+	}
+
+	file := filepath.Join(docs, "demo.md")
+	if err := InitWithOptions(file, "Parser", "dev", InitOptions{Template: "standard"}); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	for _, want := range []string{"# Parser demo\n", "Written by alice on 20", "```output\nbranch= {{.Name}}\n```"} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in document, got:\n%s", want, s)
+		}
+	}
+	if strings.Contains(s, "stale") {
+		t.Errorf("expected template output to be replaced by running the code, got:\n%s", s)
+	}
+
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) > 0 {
+		t.Errorf("expected a valid hash chain, got %v", errs)
+	}
+
+	err = InitWithOptions(filepath.Join(docs, "other.md"), "Other", "dev", InitOptions{Template: "missing"})
+	if err == nil || !strings.Contains(err.Error(), "available: standard") {
+		t.Errorf("expected an error listing the templates, got %v", err)
+	}
+}
+
+func TestInitTemplatePostsOnlyWhenSaved(t *testing.T) {
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer server.Close()
+	t.Setenv("SHOWBOAT_REMOTE_URL", server.URL)
+
+	project := t.TempDir()
+	templates := filepath.Join(project, ".showboat", "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	template := "# Broken\n\nIntro.\n\n```no-such-interpreter\nhi\n```\n"
+	if err := os.WriteFile(filepath.Join(templates, "broken.md"), []byte(template), 0644); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(project, "demo.md")
+	if err := InitWithOptions(file, "Demo", "dev", InitOptions{Template: "broken"}); err == nil {
+		t.Fatal("expected a template whose code cannot run to fail")
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("expected no document to be written, got %v", err)
+	}
+	if posts != 0 {
+		t.Errorf("expected nothing to be posted for an unsaved document, got %d posts", posts)
+	}
+}
+
+func TestInitTemplateKeepsRolesAndNeeds(t *testing.T) {
+	project := t.TempDir()
+	source := filepath.Join(project, "source.md")
+	if err := Init(source, "Source", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(source, "bash", "echo prep", "", EntryOptions{Role: "setup", ID: "prep"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(source, "bash", "echo step", "", EntryOptions{Needs: []string{"prep"}, ID: "step"}); err != nil {
+		t.Fatal(err)
+	}
+	templates := filepath.Join(project, ".showboat", "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	template, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templates, "steps.md"), template, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(project, "demo.md")
+	if err := InitWithOptions(file, "Demo", "dev", InitOptions{Template: "steps"}); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var code []markdown.CodeBlock
+	for _, b := range blocks {
+		if cb, ok := b.(markdown.CodeBlock); ok {
+			code = append(code, cb)
+		}
+	}
+	if len(code) != 2 || code[0].ID != "prep" || code[0].Role != markdown.RoleSetup || code[1].ID != "step" || code[1].Needs != "prep" {
+		t.Errorf("expected the template's IDs, role and needs to be kept, got %+v", code)
+	}
+}
@@ -0,0 +1,376 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// JournalRecord is one line of a document's journal: a sidecar file next to
+// the document that records every mutating command as JSON.
+// Added and Removed hold the markdown of the blocks the operation appended to
+// or removed from the end of the document, which is enough to reverse it. For
+// "meta" they hold the title block after and before the change, and for a
+// record with Replace set, the whole file after and before.
+type JournalRecord struct {
+	Seq     int      `json:"seq"`
+	Time    string   `json:"time"`
+	Op      string   `json:"op"`
+	Args    []string `json:"args,omitempty"`
+	Before  string   `json:"before,omitempty"`
+	After   string   `json:"after"`
+	Added   string   `json:"added,omitempty"`
+	Removed string   `json:"removed,omitempty"`
+	// Target is the sequence number of the record reversed by an undo or
+	// reapplied by a redo.
+	Target int `json:"target,omitempty"`
+	// Replace marks the record of an operation that may change any part of
+	// the file, such as "adopt", "merge" or a change to a region.
+	Replace bool `json:"replace,omitempty"`
+}
+
+// String returns a one-line summary of the record.
+func (r JournalRecord) String() string {
+	summary := r.Op
+	switch r.Op {
+	case "undo", "redo":
+		summary += fmt.Sprintf(" #%d", r.Target)
+	default:
+		for _, a := range r.Args {
+			summary += " " + shellQuote(truncateArg(a))
+		}
+	}
+	return fmt.Sprintf("#%d %s %s", r.Seq, r.Time, summary)
+}
+
+// truncateArg shortens an argument to its first line and at most 60
+// characters for display.
+func truncateArg(s string) string {
+	short := s
+	if idx := strings.Index(short, "\n"); idx != -1 {
+		short = short[:idx]
+	}
+	if len(short) > 60 {
+		short = short[:60]
+	}
+	if short != s {
+		short += "..."
+	}
+	return short
+}
+
+// journalPath returns the path of the journal for a document.
+func journalPath(file string) string {
+	return file + ".journal"
+}
+
+// removeStale removes the journal and any unfinished append record left
+// behind by a deleted document with the same name as a new one, as they do
+// not describe it.
+func removeStale(file string) error {
+	if err := os.Remove(journalPath(file)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing stale journal: %w", err)
+	}
+	if err := os.Remove(lockedfile.AppendRecord(file)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing stale append record: %w", err)
+	}
+	return nil
+}
+
+// stateHash returns a hash identifying the content of a document.
+func stateHash(blocks []markdown.Block) string {
+	return markdown.ContentHash(blocks)
+}
+
+// renderBlocks returns the markdown for blocks.
+func renderBlocks(blocks []markdown.Block) string {
+	var buf strings.Builder
+	markdown.Write(&buf, blocks)
+	return buf.String()
+}
+
+// readJournal returns the records in a document's journal. A missing journal
+// has no records.
+func readJournal(file string) ([]JournalRecord, error) {
+	f, err := os.Open(journalPath(file))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening journal: %w", err)
+	}
+	defer f.Close()
+
+	var records []JournalRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<30)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var rec JournalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("parsing journal: %w", err)
+		}
+		records = append(records, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	return records, nil
+}
+
+// journalChange appends a record of a mutating operation to the document's
+// journal. before is nil for operations that create the document.
+func journalChange(file, op string, args []string, before, after, added, removed []markdown.Block) error {
+	return appendJournal(file, JournalRecord{
+		Op:      op,
+		Args:    args,
+		Before:  hashIfPresent(before),
+		After:   stateHash(after),
+		Added:   renderBlocks(added),
+		Removed: renderBlocks(removed),
+	})
+}
+
+// journalRewrite appends a record of an operation that may have changed
+// any part of file, given the file's content before and after. Nothing is
+// recorded if the content did not change.
+func journalRewrite(file, op string, args []string, before, after []byte) error {
+	if bytes.Equal(before, after) {
+		return nil
+	}
+	beforeBlocks, err := markdown.Parse(bytes.NewReader(before))
+	if err != nil {
+		return fmt.Errorf("parsing file: %w", err)
+	}
+	afterBlocks, err := markdown.Parse(bytes.NewReader(after))
+	if err != nil {
+		return fmt.Errorf("parsing file: %w", err)
+	}
+	return appendJournal(file, JournalRecord{
+		Op:      op,
+		Args:    args,
+		Before:  stateHash(beforeBlocks),
+		After:   stateHash(afterBlocks),
+		Added:   string(after),
+		Removed: string(before),
+		Replace: true,
+	})
+}
+
+func hashIfPresent(blocks []markdown.Block) string {
+	if blocks == nil {
+		return ""
+	}
+	return stateHash(blocks)
+}
+
+// appendJournal assigns the next sequence number and the current time to rec
+// and appends it to the journal.
+func appendJournal(file string, rec JournalRecord) error {
+	records, err := readJournal(file)
+	if err != nil {
+		return err
+	}
+	rec.Seq = 1
+	if len(records) > 0 {
+		rec.Seq = records[len(records)-1].Seq + 1
+	}
+	rec.Time = time.Now().UTC().Format(time.RFC3339)
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("encoding journal record: %w", err)
+	}
+	f, err := os.OpenFile(journalPath(file), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening journal: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+	return nil
+}
+
+// Log returns the journal records for a document, oldest first.
+func Log(file string) ([]JournalRecord, error) {
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("file not found: %s", file)
+	}
+	return readJournal(file)
+}
+
+// undoStacks replays the journal and returns the operations that can be
+// undone and those that can be redone, most recent last.
+func undoStacks(records []JournalRecord) (applied, undone []JournalRecord) {
+	for _, rec := range records {
+		switch rec.Op {
+		case "init", "import":
+			applied, undone = nil, nil
+		case "undo":
+			if len(applied) > 0 {
+				undone = append(undone, applied[len(applied)-1])
+				applied = applied[:len(applied)-1]
+			}
+		case "redo":
+			if len(undone) > 0 {
+				applied = append(applied, undone[len(undone)-1])
+				undone = undone[:len(undone)-1]
+			}
+		default:
+			applied = append(applied, rec)
+			undone = nil
+		}
+	}
+	return applied, undone
+}
+
+// Undo reverses the most recent journaled operation that has not already been
+// undone, including restoring entries removed by "pop".
+func Undo(file string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	records, err := readJournal(file)
+	if err != nil {
+		return err
+	}
+	applied, _ := undoStacks(records)
+	if len(applied) == 0 {
+		return fmt.Errorf("nothing to undo")
+	}
+	target := applied[len(applied)-1]
+	return replay(file, "undo", target, target.After, target.Added, target.Removed)
+}
+
+// Redo reapplies the most recently undone operation.
+func Redo(file string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	records, err := readJournal(file)
+	if err != nil {
+		return err
+	}
+	_, undone := undoStacks(records)
+	if len(undone) == 0 {
+		return fmt.Errorf("nothing to redo")
+	}
+	target := undone[len(undone)-1]
+	return replay(file, "redo", target, target.Before, target.Removed, target.Added)
+}
+
+// replay removes the markdown in remove from the end of the document and
+// appends the blocks in add. The document must be in the state identified by
+// expect, otherwise it was changed outside showboat and the journal no longer
+// describes it.
+func replay(file, op string, target JournalRecord, expect, remove, add string) error {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+	if err := ensureUnsealed(blocks); err != nil {
+		return err
+	}
+	if stateHash(blocks) != expect {
+		return fmt.Errorf("cannot %s #%d: document has changed since it was journaled", op, target.Seq)
+	}
+	if target.Replace {
+		return replayRewrite(file, op, target, remove, add)
+	}
+	before := blocks
+
+	removed, err := markdown.Parse(strings.NewReader(remove))
+	if err != nil {
+		return fmt.Errorf("parsing journal: %w", err)
+	}
+	added, err := markdown.Parse(strings.NewReader(add))
+	if err != nil {
+		return fmt.Errorf("parsing journal: %w", err)
+	}
+	var after []markdown.Block
+	if target.Op == "meta" {
+		// A metadata change replaces the title block, not the end.
+		if len(blocks) == 0 || len(added) != 1 || renderBlocks(blocks[:1]) != remove {
+			return fmt.Errorf("cannot %s #%d: document does not start with the journaled title", op, target.Seq)
+		}
+		after = append([]markdown.Block{added[0]}, blocks[1:]...)
+		added, removed = nil, nil
+	} else {
+		if len(removed) > len(blocks) || renderBlocks(blocks[len(blocks)-len(removed):]) != remove {
+			return fmt.Errorf("cannot %s #%d: document does not end with the journaled blocks", op, target.Seq)
+		}
+		after = append(append([]markdown.Block{}, blocks[:len(blocks)-len(removed)]...), added...)
+	}
+	if err := writeBlocks(file, after); err != nil {
+		return err
+	}
+	if err := appendJournal(file, JournalRecord{
+		Op:      op,
+		Before:  stateHash(before),
+		After:   stateHash(after),
+		Added:   add,
+		Removed: remove,
+		Target:  target.Seq,
+	}); err != nil {
+		return err
+	}
+
+	if docID := documentID(after); docID != "" {
+		if target.Op == "meta" {
+			postSection(docID, "meta", after[:1])
+		}
+		entries := markdown.Entries(removed)
+		for i := len(entries) - 1; i >= 0; i-- {
+			postPop(docID, entries[i].ID())
+		}
+		postEntries(file, docID, added)
+	}
+	return nil
+}
+
+// replayRewrite replaces the whole content of file, which must be remove,
+// with add, reversing or reapplying a record with Replace set.
+func replayRewrite(file, op string, target JournalRecord, remove, add string) error {
+	data, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if string(data) != remove {
+		return fmt.Errorf("cannot %s #%d: document has changed since it was journaled", op, target.Seq)
+	}
+	if err := lockedfile.WriteFile(file, []byte(add), 0644); err != nil {
+		return err
+	}
+	before, err := markdown.Parse(strings.NewReader(remove))
+	if err != nil {
+		return fmt.Errorf("parsing journal: %w", err)
+	}
+	after, err := markdown.Parse(strings.NewReader(add))
+	if err != nil {
+		return fmt.Errorf("parsing journal: %w", err)
+	}
+	return appendJournal(file, JournalRecord{
+		Op:      op,
+		Before:  stateHash(before),
+		After:   stateHash(after),
+		Added:   add,
+		Removed: remove,
+		Target:  target.Seq,
+		Replace: true,
+	})
+}
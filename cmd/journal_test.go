@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournalRecordsOperations(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Log(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := []string{"init", "note", "exec", "pop"}
+	if len(records) != len(ops) {
+		t.Fatalf("expected %d records, got %d: %+v", len(ops), len(records), records)
+	}
+	for i, op := range ops {
+		if records[i].Op != op || records[i].Seq != i+1 {
+			t.Errorf("record %d: expected #%d %s, got #%d %s", i, i+1, op, records[i].Seq, records[i].Op)
+		}
+	}
+	if records[1].Before != records[0].After {
+		t.Error("expected note's before hash to match init's after hash")
+	}
+	if !strings.Contains(records[3].Removed, "echo hi") {
+		t.Errorf("expected pop record to hold the removed blocks, got %q", records[3].Removed)
+	}
+	if got := records[2].String(); !strings.Contains(got, "#3") || !strings.Contains(got, "exec bash 'echo hi'") {
+		t.Errorf("unexpected record summary: %s", got)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "First"); err != nil {
+		t.Fatal(err)
+	}
+	withFirst, _ := os.ReadFile(file)
+	if err := Note(file, "Second"); err != nil {
+		t.Fatal(err)
+	}
+	withBoth, _ := os.ReadFile(file)
+
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != string(withFirst) {
+		t.Errorf("expected undo to remove second note, got:\n%s", got)
+	}
+
+	if err := Redo(file); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != string(withBoth) {
+		t.Errorf("expected redo to restore second note, got:\n%s", got)
+	}
+
+	if err := Redo(file); err == nil {
+		t.Error("expected error when there is nothing to redo")
+	}
+}
+
+func TestUndoRestoresPoppedEntry(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	original, _ := os.ReadFile(file)
+	if err := Pop(file); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(file); string(got) != string(original) {
+		t.Errorf("expected undo to restore popped entry.\nexpected:\n%s\ngot:\n%s", original, got)
+	}
+
+	// Undo again removes the exec entry; the init cannot be undone.
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := Undo(file); err == nil {
+		t.Error("expected error when there is nothing to undo")
+	}
+}
+
+func TestUndoRefusesAfterExternalEdit(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	edited := strings.Replace(string(content), "Hello", "Edited by hand", 1)
+	if err := os.WriteFile(file, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Undo(file)
+	if err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Errorf("expected error about external changes, got %v", err)
+	}
+}
+
+func TestInitReplacesStaleJournal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(file)
+	if err := Init(file, "Again", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := Log(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Op != "init" {
+		t.Errorf("expected a fresh journal with one init record, got %+v", records)
+	}
+}
@@ -0,0 +1,250 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// MergeConflict describes an entry that was changed in incompatible ways on
+// the two sides of a merge. EntryID is empty for a conflict in the title.
+type MergeConflict struct {
+	EntryID string
+	Reason  string
+}
+
+// String returns a human-readable description of the conflict.
+func (c MergeConflict) String() string {
+	if c.EntryID == "" {
+		return "conflict: title: " + c.Reason
+	}
+	return fmt.Sprintf("conflict: entry %s: %s", c.EntryID, c.Reason)
+}
+
+// Merge combines two documents, ours and theirs, that were both changed from
+// base, and writes the result to outputFile. It works on entries rather than
+// lines, so fenced blocks are never split:
+//
+//   - An entry changed or removed on one side only takes that side's change.
+//   - New entries are kept from both sides. They are placed after the entry
+//     they followed in base, ours before theirs. An entry added on both sides
+//     with the same ID and content appears once.
+//   - The merged entries are chained again, and any signature is dropped as
+//     it no longer matches.
+//
+// Entries are matched by entry ID, or by content for entries without one.
+// An entry changed on both sides, or changed on one and removed on the
+// other, is a conflict: our version is kept and the conflict is returned.
+// The title block is merged the same way.
+//
+// When outputFile is oursFile, as when git runs the merge driver, the
+// change to it is journaled.
+//
+// Returns an error, writing nothing, if the documents have different
+// document IDs, if a hash chain is broken, or if a sealed document would
+// have to change.
+func Merge(baseFile, oursFile, theirsFile, outputFile string) ([]MergeConflict, error) {
+	var oursData []byte
+	if outputFile == oursFile {
+		unlock, err := lockDocument(oursFile)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if oursData, err = lockedfile.ReadFile(oursFile); err != nil {
+			return nil, fmt.Errorf("opening file: %w", err)
+		}
+	}
+	write := func(blocks []markdown.Block) error {
+		if err := writeBlocks(outputFile, blocks); err != nil {
+			return err
+		}
+		if outputFile != oursFile {
+			return nil
+		}
+		merged, err := lockedfile.ReadFile(oursFile)
+		if err != nil {
+			return fmt.Errorf("opening file: %w", err)
+		}
+		return journalRewrite(oursFile, "merge", []string{baseFile, theirsFile}, oursData, merged)
+	}
+
+	docs := map[string][]markdown.Block{}
+	for _, file := range []string{baseFile, oursFile, theirsFile} {
+		blocks, err := readBlocks(file)
+		if err != nil {
+			return nil, err
+		}
+		if errs := markdown.CheckChain(blocks); len(errs) > 0 {
+			return nil, fmt.Errorf("%s: hash chain is broken at entry %s: %s", file, errs[0].Entry.ID(), errs[0].Reason)
+		}
+		docs[file] = blocks
+	}
+	base, ours, theirs := docs[baseFile], docs[oursFile], docs[theirsFile]
+
+	baseID, oursID, theirsID := documentID(base), documentID(ours), documentID(theirs)
+	if oursID != theirsID || (baseID != "" && baseID != oursID) {
+		return nil, fmt.Errorf("%s and %s are not versions of the same document", oursFile, theirsFile)
+	}
+
+	// When only one side changed, it is the result.
+	oursSum, theirsSum, baseSum := markdown.ContentHash(ours), markdown.ContentHash(theirs), markdown.ContentHash(base)
+	switch {
+	case oursSum == theirsSum || theirsSum == baseSum:
+		return nil, write(ours)
+	case oursSum == baseSum:
+		return nil, write(theirs)
+	}
+	for _, file := range []string{oursFile, theirsFile} {
+		if document.SealIndex(docs[file]) != -1 {
+			return nil, fmt.Errorf("%s is sealed and cannot be merged with changes from the other side", file)
+		}
+	}
+
+	var conflicts []MergeConflict
+	var merged []markdown.Block
+	title, ok := mergeTitle(base, ours, theirs)
+	if !ok {
+		conflicts = append(conflicts, MergeConflict{Reason: "changed on both sides"})
+	}
+	if title != (markdown.TitleBlock{}) {
+		merged = append(merged, title)
+	}
+
+	entries, entryConflicts := mergeEntries(base, ours, theirs)
+	conflicts = append(conflicts, entryConflicts...)
+	for _, e := range entries {
+		merged = append(merged, e.blocks...)
+	}
+	if err := write(markdown.Rechain(merged)); err != nil {
+		return nil, err
+	}
+	return conflicts, nil
+}
+
+// mergeTitle merges the title blocks, reporting false on a conflict.
+func mergeTitle(base, ours, theirs []markdown.Block) (markdown.TitleBlock, bool) {
+	b, o, t := titleOf(base), titleOf(ours), titleOf(theirs)
+	switch {
+	case o == t || t == b:
+		return o, true
+	case o == b:
+		return t, true
+	}
+	return o, false
+}
+
+func titleOf(blocks []markdown.Block) markdown.TitleBlock {
+	if len(blocks) > 0 {
+		if tb, ok := blocks[0].(markdown.TitleBlock); ok {
+			return tb
+		}
+	}
+	return markdown.TitleBlock{}
+}
+
+// mergeEntry is an entry with the key it is matched by and a hash of its
+// content without its chain hash, which depends on the entries before it.
+type mergeEntry struct {
+	key    string
+	id     string
+	sum    string
+	blocks []markdown.Block
+}
+
+func entriesOf(blocks []markdown.Block) []mergeEntry {
+	var entries []mergeEntry
+	for _, e := range markdown.Entries(blocks) {
+		unchained := append([]markdown.Block{}, e.Blocks...)
+		switch b := unchained[0].(type) {
+		case markdown.CommentaryBlock:
+			b.Hash = ""
+			unchained[0] = b
+		case markdown.CodeBlock:
+			b.Hash = ""
+			unchained[0] = b
+		}
+		me := mergeEntry{id: e.ID(), sum: markdown.ContentHash(unchained), blocks: e.Blocks}
+		me.key = "id:" + me.id
+		if me.id == "" {
+			me.key = "content:" + me.sum
+		}
+		entries = append(entries, me)
+	}
+	return entries
+}
+
+// mergeEntries merges the entries of both sides in base order, placing new
+// entries after the base entry they followed.
+func mergeEntries(base, ours, theirs []markdown.Block) ([]mergeEntry, []MergeConflict) {
+	baseEntries := entriesOf(base)
+	inBase := map[string]bool{}
+	for _, e := range baseEntries {
+		inBase[e.key] = true
+	}
+
+	// index maps each side's entries by key, and groups its new entries by
+	// the key of the base entry before them ("" for the start).
+	index := func(entries []mergeEntry) (map[string]mergeEntry, map[string][]mergeEntry) {
+		byKey := map[string]mergeEntry{}
+		added := map[string][]mergeEntry{}
+		anchor := ""
+		for _, e := range entries {
+			byKey[e.key] = e
+			if inBase[e.key] {
+				anchor = e.key
+			} else {
+				added[anchor] = append(added[anchor], e)
+			}
+		}
+		return byKey, added
+	}
+	oursByKey, oursAdded := index(entriesOf(ours))
+	theirsByKey, theirsAdded := index(entriesOf(theirs))
+
+	var merged []mergeEntry
+	var conflicts []MergeConflict
+	emitted := map[string]bool{}
+	emitAdded := func(anchor string) {
+		for _, e := range oursAdded[anchor] {
+			if t, ok := theirsByKey[e.key]; ok && t.sum != e.sum {
+				conflicts = append(conflicts, MergeConflict{EntryID: e.id, Reason: "added on both sides with different content"})
+			}
+			merged = append(merged, e)
+			emitted[e.key] = true
+		}
+		for _, e := range theirsAdded[anchor] {
+			if !emitted[e.key] {
+				merged = append(merged, e)
+				emitted[e.key] = true
+			}
+		}
+	}
+
+	emitAdded("")
+	for _, b := range baseEntries {
+		o, inOurs := oursByKey[b.key]
+		t, inTheirs := theirsByKey[b.key]
+		switch {
+		case inOurs && inTheirs:
+			switch {
+			case o.sum == b.sum:
+				merged = append(merged, t)
+			case t.sum == b.sum || t.sum == o.sum:
+				merged = append(merged, o)
+			default:
+				conflicts = append(conflicts, MergeConflict{EntryID: b.id, Reason: "changed on both sides"})
+				merged = append(merged, o)
+			}
+		case inOurs && o.sum != b.sum:
+			conflicts = append(conflicts, MergeConflict{EntryID: b.id, Reason: "changed in ours, removed in theirs"})
+			merged = append(merged, o)
+		case inTheirs && t.sum != b.sum:
+			conflicts = append(conflicts, MergeConflict{EntryID: b.id, Reason: "removed in ours, changed in theirs"})
+		}
+		emitAdded(b.key)
+	}
+	return merged, conflicts
+}
@@ -0,0 +1,185 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// copyFile copies src to a new file named name in the same directory.
+func copyFile(t *testing.T, src, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(filepath.Dir(src), name)
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.md")
+	if err := Init(base, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(base, "Shared intro"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(base, "bash", "echo shared", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	ours := copyFile(t, base, "ours.md")
+	theirs := copyFile(t, base, "theirs.md")
+	if _, _, err := Exec(ours, "bash", "echo ours", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(theirs, "Theirs too"); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "merged.md")
+	conflicts, err := Merge(base, ours, theirs, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 0 {
+		t.Errorf("expected a clean merge, got %v", conflicts)
+	}
+	blocks := mustRead(t, out)
+	// New entries at the same point: ours come first.
+	if got := entryTexts(blocks); got != "Shared intro|echo shared|echo ours|Theirs too" {
+		t.Errorf("unexpected merged entries: %v", got)
+	}
+	if documentID(blocks) != documentID(mustRead(t, base)) {
+		t.Error("expected the document ID to be kept")
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+
+	conflicts, err = Merge(base, theirs, ours, out)
+	if err != nil || len(conflicts) != 0 {
+		t.Fatalf("unexpected result: %v %v", conflicts, err)
+	}
+	if got := entryTexts(mustRead(t, out)); got != "Shared intro|echo shared|Theirs too|echo ours" {
+		t.Errorf("expected the other side's entries first, got %v", got)
+	}
+
+	// A popped entry is removed, and entries added after it follow the
+	// entry before it.
+	if err := Pop(theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := Pop(theirs); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(theirs, "Theirs instead"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Merge(base, ours, theirs, out); err != nil {
+		t.Fatal(err)
+	}
+	if got := entryTexts(mustRead(t, out)); got != "Shared intro|Theirs instead|echo ours" {
+		t.Errorf("unexpected merged entries: %v", got)
+	}
+
+	// Merging into our file, as the git merge driver does, is journaled
+	// and can be undone.
+	before := mustReadFile(t, ours)
+	if _, err := Merge(base, ours, theirs, ours); err != nil {
+		t.Fatal(err)
+	}
+	if got := entryTexts(mustRead(t, ours)); got != "Shared intro|Theirs instead|echo ours" {
+		t.Errorf("unexpected merged entries: %v", got)
+	}
+	if err := Undo(ours); err != nil {
+		t.Fatal(err)
+	}
+	if string(mustReadFile(t, ours)) != string(before) {
+		t.Errorf("expected undo to restore our file, got:\n%s", mustReadFile(t, ours))
+	}
+}
+
+// entryTexts joins the note text or code of each entry.
+func entryTexts(blocks []markdown.Block) string {
+	var texts []string
+	for _, e := range markdown.Entries(blocks) {
+		switch b := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			texts = append(texts, b.Text)
+		case markdown.CodeBlock:
+			texts = append(texts, b.Code)
+		}
+	}
+	return strings.Join(texts, "|")
+}
+
+func TestMergeConflict(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "base.md")
+	if err := Init(base, "Demo", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(base, "bash", "echo one", ""); err != nil {
+		t.Fatal(err)
+	}
+	id := markdown.Entries(mustRead(t, base))[0].ID()
+
+	// Both sides re-record the same entry with different output.
+	setOutput := func(file, output string) {
+		blocks := mustRead(t, file)
+		blocks[2] = markdown.OutputBlock{Content: output}
+		if err := writeBlocks(file, markdown.Rechain(blocks)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ours := copyFile(t, base, "ours.md")
+	theirs := copyFile(t, base, "theirs.md")
+	setOutput(ours, "ours\n")
+	setOutput(theirs, "theirs\n")
+
+	conflicts, err := Merge(base, ours, theirs, ours)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].EntryID != id || !strings.Contains(conflicts[0].String(), "changed on both sides") {
+		t.Fatalf("expected one conflict on entry %s, got %v", id, conflicts)
+	}
+	if !strings.Contains(string(mustReadFile(t, ours)), "```output\nours\n```") {
+		t.Error("expected our version to be kept")
+	}
+
+	other := filepath.Join(dir, "other.md")
+	if err := Init(other, "Other", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Merge(base, ours, other, filepath.Join(dir, "x.md")); err == nil {
+		t.Error("expected error merging different documents")
+	}
+}
+
+func mustRead(t *testing.T, file string) []markdown.Block {
+	t.Helper()
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blocks
+}
+
+func mustReadFile(t *testing.T, file string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
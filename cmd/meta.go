@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// Meta returns a document's metadata.
+func Meta(file string) (markdown.Metadata, error) {
+	doc, err := openDocument(file, "", "")
+	if err != nil {
+		return markdown.Metadata{}, err
+	}
+	return doc.Metadata(), nil
+}
+
+// MetaGet returns one metadata field of a document, such as "author" or
+// "tags"; see markdown.MetadataKeys.
+func MetaGet(file, key string) (string, error) {
+	meta, err := Meta(file)
+	if err != nil {
+		return "", err
+	}
+	return meta.Get(key)
+}
+
+// MetaSet sets one metadata field of a document. An empty value clears it.
+// The metadata is covered by the hash chain, so every entry is chained
+// again. The change is journaled as a rewrite of the whole file, so it can
+// be undone. A sealed or signed document is refused, as the change would
+// break the seal or the signature.
+func MetaSet(file, key, value string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	doc, err := openDocument(file, "", "")
+	if err != nil {
+		return err
+	}
+	if err := ensureUnsealed(doc.Blocks()); err != nil {
+		return err
+	}
+	if hasSignature(doc.Blocks()) {
+		return fmt.Errorf("document is signed; changing its metadata would invalidate the signature")
+	}
+	before, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if err := doc.SetMetadata(context.Background(), key, value); err != nil {
+		return err
+	}
+	if err := doc.Save(); err != nil {
+		return err
+	}
+	after, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	return journalRewrite(file, "meta", []string{key, value}, before, after)
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestMetaSetGet(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	opts := InitOptions{Metadata: markdown.Metadata{Agent: "builder"}}
+	if err := InitWithOptions(file, "Demo", "dev", opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MetaSet(file, "task", "PROJ-142"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "<!-- showboat-meta agent=builder task=PROJ-142 -->\n") {
+		t.Errorf("expected metadata comment in document, got:\n%s", content)
+	}
+	task, err := MetaGet(file, "task")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task != "PROJ-142" {
+		t.Errorf("expected task PROJ-142, got %q", task)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := markdown.CheckChain(blocks); len(errs) > 0 {
+		t.Errorf("expected setting metadata to keep the hash chain, got %v", errs)
+	}
+
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := MetaGet(file, "task"); task != "" {
+		t.Errorf("expected undo to clear the task, got %q", task)
+	}
+	if err := Redo(file); err != nil {
+		t.Fatal(err)
+	}
+	if task, _ := MetaGet(file, "task"); task != "PROJ-142" {
+		t.Errorf("expected redo to restore the task, got %q", task)
+	}
+
+	if err := MetaSet(file, "colour", "red"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+	if err := Seal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := MetaSet(file, "task", "other"); err == nil {
+		t.Error("expected a sealed document to refuse metadata changes")
+	}
+}
+
+func TestMetaSetSigned(t *testing.T) {
+	file, _ := signedDocument(t)
+	before, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := MetaSet(file, "task", "PROJ-142"); err == nil || !strings.Contains(err.Error(), "signed") {
+		t.Errorf("expected a signed document to refuse metadata changes, got %v", err)
+	}
+	after, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Errorf("expected a refused change to leave the file alone, got:\n%s", after)
+	}
+}
@@ -1,9 +1,7 @@
 package cmd
 
 import (
-	"fmt"
-
-	"github.com/simonw/showboat/markdown"
+	"context"
 )
 
 // Pop removes the most recent entry from a showboat document.
@@ -11,44 +9,36 @@ import (
 // blocks are removed. A commentary entry is a single block.
 // The title block cannot be removed.
 func Pop(file string) error {
-	blocks, err := readBlocks(file)
+	return PopWithOptions(file, EntryOptions{})
+}
+
+// PopWithOptions is Pop with optional behaviour controlled by opts.
+func PopWithOptions(file string, opts EntryOptions) error {
+	unlock, err := lockDocument(file)
 	if err != nil {
 		return err
 	}
-
-	if len(blocks) == 0 {
-		return fmt.Errorf("document is empty")
-	}
-
-	// Don't allow removing the title block.
-	if len(blocks) == 1 {
-		if _, ok := blocks[0].(markdown.TitleBlock); ok {
-			return fmt.Errorf("nothing to pop: document only contains a title")
-		}
+	defer unlock()
+	doc, err := openDocument(file, "", opts.Region)
+	if err != nil {
+		return err
 	}
-
-	docID := documentID(blocks)
-
-	last := blocks[len(blocks)-1]
-
-	switch last.(type) {
-	case markdown.OutputBlock, markdown.ImageOutputBlock:
-		// Output blocks are always preceded by a code block — remove both.
-		if len(blocks) >= 2 {
-			blocks = blocks[:len(blocks)-2]
-		} else {
-			blocks = blocks[:len(blocks)-1]
+	before := doc.Blocks()
+	if len(before) > 0 {
+		if err := ensureUnsealed(before); err != nil {
+			return err
 		}
-	default:
-		blocks = blocks[:len(blocks)-1]
 	}
 
-	if err := writeBlocks(file, blocks); err != nil {
+	if _, err := doc.Pop(context.Background()); err != nil {
 		return err
 	}
-
-	if docID != "" {
-		postPop(docID)
+	if opts.Region != "" {
+		return saveRegionChange(doc, "pop", nil)
+	}
+	if err := doc.Save(); err != nil {
+		return err
 	}
-	return nil
+	after := doc.Blocks()
+	return journalChange(file, "pop", nil, before, after, nil, before[len(after):])
 }
@@ -2,15 +2,18 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/simonw/showboat/document"
 	"github.com/simonw/showboat/markdown"
 )
 
@@ -28,6 +31,38 @@ func documentID(blocks []markdown.Block) string {
 	return tb.DocumentID
 }
 
+// blocksEntryID returns the entry ID carried by the first block that has one.
+func blocksEntryID(blocks []markdown.Block) string {
+	for _, b := range blocks {
+		switch blk := b.(type) {
+		case markdown.CommentaryBlock:
+			if blk.ID != "" {
+				return blk.ID
+			}
+		case markdown.CodeBlock:
+			if blk.ID != "" {
+				return blk.ID
+			}
+		}
+	}
+	return ""
+}
+
+// remoteSink posts document changes to SHOWBOAT_REMOTE_URL.
+type remoteSink struct{}
+
+// Send posts e as the command that made the change.
+func (remoteSink) Send(ctx context.Context, e document.Event) {
+	switch e.Command {
+	case "image":
+		postImage(e.DocumentID, e.Blocks, e.ImagePath)
+	case "pop":
+		postPop(e.DocumentID, e.EntryID)
+	default:
+		postSection(e.DocumentID, e.Command, e.Blocks)
+	}
+}
+
 // postSection renders blocks to markdown and POSTs them form-encoded to
 // SHOWBOAT_REMOTE_URL. No-op if the env var is unset or empty.
 // Errors print a warning to stderr but do not fail the command.
@@ -40,12 +75,20 @@ func postSection(uuid, command string, blocks []markdown.Block) {
 	data := url.Values{}
 	data.Set("uuid", uuid)
 	data.Set("command", command)
+	if id := blocksEntryID(blocks); id != "" {
+		data.Set("id", id)
+	}
 
 	switch command {
-	case "init":
+	case "init", "meta":
 		for _, b := range blocks {
 			if tb, ok := b.(markdown.TitleBlock); ok {
 				data.Set("title", tb.Title)
+				for _, key := range markdown.MetadataKeys {
+					if v, _ := tb.Metadata.Get(key); v != "" {
+						data.Set(key, v)
+					}
+				}
 				break
 			}
 		}
@@ -89,6 +132,9 @@ func postImage(uuid string, blocks []markdown.Block, imagePath string) {
 
 	writer.WriteField("uuid", uuid)
 	writer.WriteField("command", "image")
+	if id := blocksEntryID(blocks); id != "" {
+		writer.WriteField("id", id)
+	}
 
 	for _, b := range blocks {
 		if blk, ok := b.(markdown.ImageOutputBlock); ok {
@@ -123,9 +169,31 @@ func postImage(uuid string, blocks []markdown.Block, imagePath string) {
 	}
 }
 
-// postPop POSTs a pop command to SHOWBOAT_REMOTE_URL.
+// postEntries POSTs each entry in blocks as the command that would have
+// created it. Image files are resolved relative to the document.
+func postEntries(file, uuid string, blocks []markdown.Block) {
+	for _, e := range markdown.Entries(blocks) {
+		switch b := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			postSection(uuid, "note", e.Blocks)
+		case markdown.CodeBlock:
+			if !b.IsImage {
+				postSection(uuid, "exec", e.Blocks)
+				continue
+			}
+			for _, out := range e.Blocks {
+				if img, ok := out.(markdown.ImageOutputBlock); ok {
+					postImage(uuid, e.Blocks, filepath.Join(filepath.Dir(file), img.Filename))
+				}
+			}
+		}
+	}
+}
+
+// postPop POSTs a pop command to SHOWBOAT_REMOTE_URL. entryID identifies the
+// removed entry and is omitted when empty.
 // No-op if the env var is unset or empty.
-func postPop(uuid string) {
+func postPop(uuid, entryID string) {
 	remoteURL := os.Getenv("SHOWBOAT_REMOTE_URL")
 	if remoteURL == "" {
 		return
@@ -134,6 +202,9 @@ func postPop(uuid string) {
 	data := url.Values{}
 	data.Set("uuid", uuid)
 	data.Set("command", "pop")
+	if entryID != "" {
+		data.Set("id", entryID)
+	}
 
 	resp, err := remoteClient.PostForm(remoteURL, data)
 	if err != nil {
@@ -70,6 +70,9 @@ func TestPostSectionNotePayload(t *testing.T) {
 
 	postSection("test-uuid", "note", blocks)
 
+	if strings.Contains(gotBody, "&id=") {
+		t.Errorf("expected no entry id for block without one, got %q", gotBody)
+	}
 	if !strings.Contains(gotBody, "command=note") {
 		t.Errorf("expected command=note in body, got %q", gotBody)
 	}
@@ -143,7 +146,7 @@ func TestPostPopSendsCorrectPayload(t *testing.T) {
 
 	t.Setenv("SHOWBOAT_REMOTE_URL", server.URL)
 
-	postPop("test-uuid")
+	postPop("test-uuid", "3f2a9c1e")
 
 	if !strings.Contains(gotBody, "uuid=test-uuid") {
 		t.Errorf("expected uuid in body, got %q", gotBody)
@@ -151,13 +154,16 @@ func TestPostPopSendsCorrectPayload(t *testing.T) {
 	if !strings.Contains(gotBody, "command=pop") {
 		t.Errorf("expected command=pop in body, got %q", gotBody)
 	}
+	if !strings.Contains(gotBody, "id=3f2a9c1e") {
+		t.Errorf("expected entry id in body, got %q", gotBody)
+	}
 }
 
 func TestPostPopNoOpWhenEnvUnset(t *testing.T) {
 	t.Setenv("SHOWBOAT_REMOTE_URL", "")
 
 	// Should not panic or error
-	postPop("test-uuid")
+	postPop("test-uuid", "")
 }
 
 func TestPostImageSendsMultipart(t *testing.T) {
@@ -204,6 +210,29 @@ func TestPostImageSendsMultipart(t *testing.T) {
 	}
 }
 
+func TestPostSectionIncludesEntryID(t *testing.T) {
+	var gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Setenv("SHOWBOAT_REMOTE_URL", server.URL)
+
+	blocks := []markdown.Block{
+		markdown.CodeBlock{Lang: "bash", Code: "echo hi", ID: "3f2a9c1e"},
+		markdown.OutputBlock{Content: "hi\n"},
+	}
+
+	postSection("test-uuid", "exec", blocks)
+
+	if !strings.Contains(gotBody, "id=3f2a9c1e") {
+		t.Errorf("expected entry id in body, got %q", gotBody)
+	}
+}
+
 func TestDocumentID(t *testing.T) {
 	blocks := []markdown.Block{
 		markdown.TitleBlock{Title: "Test", Timestamp: "2026-02-06T00:00:00Z", DocumentID: "my-uuid"},
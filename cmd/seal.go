@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+// Seal appends a seal to a document, recording a hash of its content. A
+// sealed document cannot be changed by note, exec, image, pop, undo or redo
+// until it is unsealed.
+func Seal(file string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+	if err := ensureUnsealed(blocks); err != nil {
+		return err
+	}
+
+	seal := markdown.SealBlock{
+		Hash:      stateHash(blocks),
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	}
+	sealed := append(blocks[:len(blocks):len(blocks)], seal)
+	if err := writeBlocks(file, sealed); err != nil {
+		return err
+	}
+	return journalChange(file, "seal", nil, blocks, sealed, []markdown.Block{seal}, nil)
+}
+
+// Unseal removes the seal from a document so that it can be changed again.
+// Anything after the seal, such as a signature over the sealed document, is
+// removed with it since it no longer applies.
+func Unseal(file string) error {
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+	idx := document.SealIndex(blocks)
+	if idx == -1 {
+		return fmt.Errorf("document is not sealed")
+	}
+
+	unsealed := blocks[:idx]
+	if err := writeBlocks(file, unsealed); err != nil {
+		return err
+	}
+	return journalChange(file, "unseal", nil, blocks, unsealed, nil, blocks[idx:])
+}
+
+// ensureUnsealed returns an error if the document has been sealed.
+func ensureUnsealed(blocks []markdown.Block) error {
+	if document.SealIndex(blocks) != -1 {
+		return fmt.Errorf("document is sealed; run \"showboat unseal\" to change it")
+	}
+	return nil
+}
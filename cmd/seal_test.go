@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSealRefusesChanges(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	marker := filepath.Join(dir, "ran")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Seal(file); err != nil {
+		t.Fatal(err)
+	}
+	sealed, _ := os.ReadFile(file)
+	if !strings.Contains(string(sealed), "<!-- showboat-seal hash=sha256:") {
+		t.Errorf("expected seal marker in document, got:\n%s", sealed)
+	}
+
+	if err := Note(file, "More"); err == nil {
+		t.Error("expected note to fail on a sealed document")
+	}
+	if _, _, err := Exec(file, "bash", "touch "+marker, ""); err == nil {
+		t.Error("expected exec to fail on a sealed document")
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected exec not to run code against a sealed document")
+	}
+	if err := Pop(file); err == nil {
+		t.Error("expected pop to fail on a sealed document")
+	}
+	if err := Undo(file); err == nil {
+		t.Error("expected undo to fail on a sealed document")
+	}
+	if err := Seal(file); err == nil {
+		t.Error("expected sealing twice to fail")
+	}
+	if got, _ := os.ReadFile(file); string(got) != string(sealed) {
+		t.Errorf("expected sealed document to be unchanged, got:\n%s", got)
+	}
+
+	if err := Unseal(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "More"); err != nil {
+		t.Errorf("expected note to work after unsealing, got %v", err)
+	}
+}
+
+func TestVerifyChecksSeal(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	marker := filepath.Join(dir, "ran")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Seal(file); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatalf("expected intact sealed document to verify, got %v", err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %v", diffs)
+	}
+
+	// Replace the code with something that leaves a trace if it runs.
+	content, _ := os.ReadFile(file)
+	tampered := strings.Replace(string(content), "echo hello", "touch "+marker+"; echo hello", 1)
+	if err := os.WriteFile(file, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Verify(file, "", "")
+	if err == nil || !strings.Contains(err.Error(), "sealed") {
+		t.Errorf("expected seal error, got %v", err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("expected verify not to run code from a tampered sealed document")
+	}
+}
@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/simonw/showboat/document"
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// ServiceOptions controls ServiceStartWithOptions. At most one of Port, Log
+// and HTTP may be set; with none, a service is ready once it has started.
+type ServiceOptions struct {
+	// Port waits for a TCP port on localhost to accept connections.
+	Port string
+
+	// Log waits for the text to appear in the service's output.
+	Log string
+
+	// HTTP waits for a GET of a localhost URL to return 200. A value
+	// without a scheme and host, such as ":8080/health", is taken to be
+	// on http://localhost.
+	HTTP string
+
+	// Timeout is how long to wait for the service to become ready. Zero
+	// means 30 seconds.
+	Timeout time.Duration
+
+	// Region is the ID of the showboat region of a larger markdown file to
+	// change, instead of the whole file.
+	Region string
+
+	// ID is the entry ID to give the new entry; see EntryOptions.ID.
+	ID string
+}
+
+// readyCheck returns the markdown.Service readiness check for opts.
+func (opts ServiceOptions) readyCheck() (string, error) {
+	var checks []string
+	if opts.Port != "" {
+		checks = append(checks, "port:"+opts.Port)
+	}
+	if opts.Log != "" {
+		checks = append(checks, "log:"+opts.Log)
+	}
+	if opts.HTTP != "" {
+		u := opts.HTTP
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			u = "http://localhost" + u
+		}
+		checks = append(checks, "http:"+u)
+	}
+	if len(checks) > 1 {
+		return "", fmt.Errorf("use only one of --port, --log and --http")
+	}
+	if len(checks) == 0 {
+		return "", nil
+	}
+	return checks[0], execpkg.CheckReady(checks[0])
+}
+
+// ServiceStart starts command as a bash background service called name,
+// waits until it is ready and records it in the document. It returns the
+// line recorded as the entry's output.
+func ServiceStart(file, name, command, workdir string) (string, error) {
+	return ServiceStartWithOptions(file, name, command, workdir, ServiceOptions{})
+}
+
+// ServiceStartWithOptions is ServiceStart with optional behaviour
+// controlled by opts.
+func ServiceStartWithOptions(file, name, command, workdir string, opts ServiceOptions) (string, error) {
+	ready, err := opts.readyCheck()
+	if err != nil {
+		return "", err
+	}
+	args := []string{"start", name, command}
+	if ready != "" {
+		args = append(args, "--ready", ready)
+	}
+	args = append(args, EntryOptions{ID: opts.ID}.idArgs()...)
+
+	svc := markdown.Service{Name: name, Ready: ready}
+	var res document.ExecResult
+	err = addEntry(file, workdir, opts.Region, "service", args, func(doc *document.Document) error {
+		res, err = doc.StartService(context.Background(), svc, "bash", command, document.EntryOptions{Timeout: opts.Timeout, ID: opts.ID})
+		return err
+	})
+	if err != nil {
+		if res.EntryID != "" {
+			// Started, but not recorded.
+			execpkg.StopService(document.ServiceDir(file), name)
+		}
+		return "", err
+	}
+	return res.Output, nil
+}
+
+// ServiceStop stops the service called name started for the document at
+// file. The entry that started it stays in the document.
+func ServiceStop(file, name string) error {
+	return execpkg.StopService(document.ServiceDir(file), name)
+}
+
+// ServiceLogs returns the output of the service called name so far.
+func ServiceLogs(file, name string) (string, error) {
+	return execpkg.ServiceLog(document.ServiceDir(file), name)
+}
+
+// Services returns the names of the document's services that are running.
+func Services(file string) []string {
+	return execpkg.RunningServices(document.ServiceDir(file))
+}
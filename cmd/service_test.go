@@ -0,0 +1,109 @@
+//go:build unix
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestServiceStartVerify(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	if err := Init(file, "Services", "dev"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The service writes a file that the next step reads, and its pid.
+	service := "echo up > state.txt; echo $$ > pid.txt; echo ready; sleep 60"
+	output, err := ServiceStartWithOptions(file, "state", service, dir, ServiceOptions{Log: "ready"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output != "state logged \"ready\"\n" {
+		t.Errorf("unexpected output %q", output)
+	}
+	if _, _, err := Exec(file, "bash", "cat state.txt", dir); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	for _, want := range []string{"service=state ready=log:ready", "```bash {service}\n" + service + "\n```"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in document, got:\n%s", want, content)
+		}
+	}
+	if logs, err := ServiceLogs(file, "state"); err != nil || logs != "ready\n" {
+		t.Errorf("unexpected logs %q, %v", logs, err)
+	}
+
+	if err := ServiceStop(file, "state"); err != nil {
+		t.Fatal(err)
+	}
+	if running := Services(file); len(running) != 0 {
+		t.Errorf("expected no running services, got %v", running)
+	}
+	os.Remove(filepath.Join(dir, "state.txt"))
+
+	// Verify starts the service again before the step that needs it.
+	diffs, err := Verify(file, "", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 0 {
+		t.Errorf("expected verify to pass, got %v", diffs)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "pid.txt"))
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	if pid == 0 || syscall.Kill(pid, 0) == nil {
+		t.Errorf("expected verify to stop the service (pid %d)", pid)
+	}
+
+	if _, err := ServiceStartWithOptions(file, "other", "sleep 60", dir, ServiceOptions{Port: "8080", Log: "x"}); err == nil {
+		t.Error("expected two readiness checks to be refused")
+	}
+}
+
+func TestInitTemplateStartsService(t *testing.T) {
+	project := t.TempDir()
+	source := filepath.Join(project, "source.md")
+	if err := Init(source, "Source", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ServiceStartWithOptions(source, "web", "echo ready; sleep 60", project, ServiceOptions{Log: "ready"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ServiceStop(source, "web"); err != nil {
+		t.Fatal(err)
+	}
+	templates := filepath.Join(project, ".showboat", "templates")
+	if err := os.MkdirAll(templates, 0755); err != nil {
+		t.Fatal(err)
+	}
+	template, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(templates, "web.md"), template, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(project, "demo.md")
+	if err := InitWithOptions(file, "Demo", "dev", InitOptions{Template: "web", Workdir: project}); err != nil {
+		t.Fatal(err)
+	}
+	defer ServiceStop(file, "web")
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "service=web ready=log:ready") || !strings.Contains(string(content), "web logged \"ready\"") {
+		t.Errorf("expected the service to be started with its readiness check, got:\n%s", content)
+	}
+	if running := Services(file); len(running) != 1 {
+		t.Errorf("expected the template's service to be running, got %v", running)
+	}
+}
@@ -0,0 +1,226 @@
+package cmd
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// Keygen writes a new ed25519 key pair: the PKCS#8 private key to path and
+// the PKIX public key to path + ".pub", both PEM encoded. These are the same
+// formats "openssl genpkey -algorithm ed25519" produces.
+func Keygen(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("file already exists: %s", path)
+	}
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("generating key: %w", err)
+	}
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("encoding private key: %w", err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return fmt.Errorf("encoding public key: %w", err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}), 0600); err != nil {
+		return fmt.Errorf("writing private key: %w", err)
+	}
+	if err := os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0644); err != nil {
+		return fmt.Errorf("writing public key: %w", err)
+	}
+	return nil
+}
+
+// Sign signs a document with the ed25519 private key in keyFile. The
+// signature covers everything before it and is appended as the final block,
+// replacing any existing signature.
+func Sign(file, keyFile string) error {
+	priv, err := loadPrivateKey(keyFile)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockDocument(file)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return err
+	}
+
+	// first is the index of the first existing signature; everything from
+	// there on is rewritten, which is what the journal records.
+	first := len(blocks)
+	var unsigned []markdown.Block
+	for i, b := range blocks {
+		if _, ok := b.(markdown.SignatureBlock); ok {
+			if i < first {
+				first = i
+			}
+			continue
+		}
+		unsigned = append(unsigned, b)
+	}
+
+	sig := ed25519.Sign(priv, []byte(renderBlocks(unsigned)))
+	signed := append(unsigned, markdown.SignatureBlock{
+		PublicKey: base64.RawStdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		Signature: base64.RawStdEncoding.EncodeToString(sig),
+	})
+
+	if err := writeBlocks(file, signed); err != nil {
+		return err
+	}
+	return journalChange(file, "sign", nil, blocks, signed, signed[first:], blocks[first:])
+}
+
+// CheckSignature verifies the signature at the end of a document and returns
+// the fingerprint of the key that made it. If keyFile is non-empty the
+// signature must also have been made with that key; it may be a public or a
+// private key file.
+func CheckSignature(file, keyFile string) (string, error) {
+	var want ed25519.PublicKey
+	if keyFile != "" {
+		pub, err := loadPublicKey(keyFile)
+		if err != nil {
+			return "", err
+		}
+		want = pub
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return "", err
+	}
+	return checkSignature(blocks, want)
+}
+
+// hasSignature reports whether blocks contain a signature block.
+func hasSignature(blocks []markdown.Block) bool {
+	for _, b := range blocks {
+		if _, ok := b.(markdown.SignatureBlock); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSignature verifies the last signature block in blocks, optionally
+// requiring that it was made with want.
+func checkSignature(blocks []markdown.Block, want ed25519.PublicKey) (string, error) {
+	idx := -1
+	for i, b := range blocks {
+		if _, ok := b.(markdown.SignatureBlock); ok {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return "", fmt.Errorf("document is not signed")
+	}
+	sb := blocks[idx].(markdown.SignatureBlock)
+
+	pubBytes, err := base64.RawStdEncoding.DecodeString(sb.PublicKey)
+	if err != nil || len(pubBytes) != ed25519.PublicKeySize {
+		return "", fmt.Errorf("signature has a malformed public key")
+	}
+	sig, err := base64.RawStdEncoding.DecodeString(sb.Signature)
+	if err != nil {
+		return "", fmt.Errorf("signature is malformed")
+	}
+	pub := ed25519.PublicKey(pubBytes)
+	fingerprint := keyFingerprint(pub)
+
+	if want != nil && !pub.Equal(want) {
+		return fingerprint, fmt.Errorf("document was signed by %s, not by the expected key %s", fingerprint, keyFingerprint(want))
+	}
+	var unsigned []markdown.Block
+	for _, b := range blocks[:idx] {
+		if _, ok := b.(markdown.SignatureBlock); !ok {
+			unsigned = append(unsigned, b)
+		}
+	}
+	if !ed25519.Verify(pub, []byte(renderBlocks(unsigned)), sig) {
+		return fingerprint, fmt.Errorf("signature does not match document content")
+	}
+	if idx != len(blocks)-1 {
+		return fingerprint, fmt.Errorf("document was modified after it was signed")
+	}
+	return fingerprint, nil
+}
+
+// keyFingerprint returns an SSH-style SHA256 fingerprint of a public key.
+func keyFingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// readPEM reads the first PEM block from path.
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
+	}
+	return block, nil
+}
+
+// loadPrivateKey reads a PEM encoded PKCS#8 ed25519 private key.
+func loadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s is not a private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing private key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return priv, nil
+}
+
+// loadPublicKey reads a PEM encoded ed25519 public key, or derives it from a
+// private key file.
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	if block.Type == "PRIVATE KEY" {
+		priv, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, err
+		}
+		return priv.Public().(ed25519.PublicKey), nil
+	}
+	if block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s is not a public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key: %w", err)
+	}
+	pub, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return pub, nil
+}
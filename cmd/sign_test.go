@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func signedDocument(t *testing.T) (file, key string) {
+	t.Helper()
+	dir := t.TempDir()
+	file = filepath.Join(dir, "demo.md")
+	key = filepath.Join(dir, "key")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Note(file, "Hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hi", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := Keygen(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(file, key); err != nil {
+		t.Fatal(err)
+	}
+	return file, key
+}
+
+func TestSignAndCheckSignature(t *testing.T) {
+	file, key := signedDocument(t)
+
+	fingerprint, err := CheckSignature(file, key+".pub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(fingerprint, "SHA256:") {
+		t.Errorf("unexpected fingerprint %q", fingerprint)
+	}
+
+	// Signing again replaces the signature rather than adding another.
+	if err := Sign(file, key); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(file)
+	if n := strings.Count(string(content), "showboat-signature"); n != 1 {
+		t.Errorf("expected exactly one signature, got %d", n)
+	}
+	if _, err := CheckSignature(file, key); err != nil {
+		t.Errorf("expected re-signed document to check out, got %v", err)
+	}
+}
+
+func TestCheckSignatureWrongKey(t *testing.T) {
+	file, _ := signedDocument(t)
+	other := filepath.Join(t.TempDir(), "other")
+	if err := Keygen(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckSignature(file, other+".pub"); err == nil {
+		t.Error("expected error for a signature made with a different key")
+	}
+}
+
+func TestCheckSignatureDetectsTampering(t *testing.T) {
+	file, key := signedDocument(t)
+	content, _ := os.ReadFile(file)
+	tampered := strings.Replace(string(content), "Hello", "Goodbye", 1)
+	if err := os.WriteFile(file, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CheckSignature(file, key); err == nil {
+		t.Error("expected error for tampered document")
+	}
+}
+
+func TestCheckSignatureAfterAppend(t *testing.T) {
+	file, key := signedDocument(t)
+	if err := Note(file, "Added later"); err != nil {
+		t.Fatal(err)
+	}
+	_, err := CheckSignature(file, key)
+	if err == nil || !strings.Contains(err.Error(), "modified after it was signed") {
+		t.Errorf("expected error about content after the signature, got %v", err)
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	file, _ := signedDocument(t)
+
+	problems, err := Integrity(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+
+	// Change a recorded output by hand: both the chain and the signature break.
+	content, _ := os.ReadFile(file)
+	tampered := strings.Replace(string(content), "```output\nhi\n```", "```output\nforged\n```", 1)
+	if err := os.WriteFile(file, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+	problems, err = Integrity(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatalf("expected 2 problems, got %v", problems)
+	}
+	if problems[0].EntryID == "" || !strings.Contains(problems[0].String(), "hash does not match") {
+		t.Errorf("expected a chain problem for the edited entry, got %s", problems[0])
+	}
+	if problems[1].BlockIndex != -1 || !strings.Contains(problems[1].String(), "signature") {
+		t.Errorf("expected a signature problem, got %s", problems[1])
+	}
+}
@@ -0,0 +1,169 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+// templateDir is where templates are looked up, relative to a project
+// directory.
+const templateDir = ".showboat/templates"
+
+// Template is a document template found in a templates directory.
+type Template struct {
+	Name string
+	Path string
+}
+
+// Templates lists the templates available to a document in dir: the .md
+// files in .showboat/templates in dir and each of its parents. A template
+// in a nearer directory hides one with the same name further up.
+func Templates(dir string) ([]Template, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	var templates []Template
+	for {
+		paths, err := filepath.Glob(filepath.Join(dir, templateDir, "*.md"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(paths)
+		for _, p := range paths {
+			name := strings.TrimSuffix(filepath.Base(p), ".md")
+			if !seen[name] {
+				seen[name] = true
+				templates = append(templates, Template{Name: name, Path: p})
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return templates, nil
+		}
+		dir = parent
+	}
+}
+
+// findTemplate resolves a template name or path for a document in dir. A
+// value containing a path separator or ending in .md is a path.
+func findTemplate(nameOrPath, dir string) (string, error) {
+	if strings.ContainsRune(nameOrPath, '/') || strings.ContainsRune(nameOrPath, filepath.Separator) || strings.HasSuffix(nameOrPath, ".md") {
+		return nameOrPath, nil
+	}
+	templates, err := Templates(dir)
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	for _, t := range templates {
+		if t.Name == nameOrPath {
+			return t.Path, nil
+		}
+		names = append(names, t.Name)
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("template %q not found: no %s directory", nameOrPath, templateDir)
+	}
+	return "", fmt.Errorf("template %q not found, available: %s", nameOrPath, strings.Join(names, ", "))
+}
+
+var templateVarRe = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// expandTemplate replaces {{name}} references to the variables in vars.
+// Other text in double braces is left alone, so that code such as
+// docker --format '{{.Name}}' survives.
+func expandTemplate(text string, vars map[string]string) string {
+	return templateVarRe.ReplaceAllStringFunc(text, func(m string) string {
+		if v, ok := vars[templateVarRe.FindStringSubmatch(m)[1]]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// templateVars returns the variables available to a template: the title,
+// today's date, the author from git config or $USER, and the current git
+// branch of dir.
+func templateVars(title, dir string, now time.Time) map[string]string {
+	author := gitOutput(dir, "config", "user.name")
+	if author == "" {
+		author = os.Getenv("USER")
+	}
+	return map[string]string{
+		"title":  title,
+		"date":   now.Format("2006-01-02"),
+		"author": author,
+		"branch": gitOutput(dir, "branch", "--show-current"),
+	}
+}
+
+// gitOutput runs git in dir and returns its trimmed output, or "" if git
+// is missing or fails.
+func gitOutput(dir string, args ...string) string {
+	c := osexec.Command("git", args...)
+	c.Dir = dir
+	out, err := c.Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// readTemplate reads the template at path with its variables expanded.
+func readTemplate(path string, vars map[string]string) ([]markdown.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading template: %w", err)
+	}
+	blocks, err := markdown.Parse(strings.NewReader(expandTemplate(string(data), vars)))
+	if err != nil {
+		return nil, fmt.Errorf("parsing template: %w", err)
+	}
+	return blocks, nil
+}
+
+// applyTemplate adds the entries of a template to doc. Notes are added as
+// they are and code blocks are run, so that their output is recorded;
+// output blocks in the template are ignored. Code blocks keep their entry
+// ID, role and needs, so that the entries of the template still depend on
+// each other, and services are started with their readiness check.
+func applyTemplate(ctx context.Context, doc *document.Document, template []markdown.Block) error {
+	for _, e := range markdown.Entries(template) {
+		var err error
+		switch b := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			_, err = doc.AppendNote(ctx, b.Text)
+		case markdown.CodeBlock:
+			opts := document.EntryOptions{ID: b.ID}
+			switch {
+			case b.IsImage:
+				_, err = doc.Image(ctx, b.Code, opts)
+			case b.Role == markdown.RoleService && b.Service != nil:
+				_, err = doc.StartService(ctx, *b.Service, b.Lang, b.Code, opts)
+			case b.Role == markdown.RoleGitState:
+				_, err = doc.AppendGitState(ctx, opts)
+			case b.Role == markdown.RoleEnv:
+				_, err = doc.AppendEnv(ctx, opts)
+			default:
+				opts.Role, opts.Needs = b.Role, b.NeedsList()
+				_, err = doc.Exec(ctx, b.Lang, b.Code, opts)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// TimelineEntry summarises one exec or image entry of a document.
+// Provenance is nil for entries recorded without it.
+type TimelineEntry struct {
+	EntryID    string
+	Lang       string
+	Code       string
+	IsImage    bool
+	Provenance *markdown.Provenance
+}
+
+// Timeline returns the exec and image entries of a document in order,
+// together with any provenance recorded for them.
+func Timeline(file string) ([]TimelineEntry, error) {
+	blocks, err := readBlocks(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []TimelineEntry
+	for _, block := range blocks {
+		cb, ok := block.(markdown.CodeBlock)
+		if !ok {
+			continue
+		}
+		entries = append(entries, TimelineEntry{
+			EntryID:    cb.ID,
+			Lang:       cb.Lang,
+			Code:       cb.Code,
+			IsImage:    cb.IsImage,
+			Provenance: cb.Provenance,
+		})
+	}
+	return entries, nil
+}
+
+// WriteTimeline writes entries to w as a table followed by a one-line
+// summary of the total run time and failures.
+func WriteTimeline(w io.Writer, entries []TimelineEntry) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENTRY\tSTART\tDURATION\tEXIT\tHOST\tINTERPRETER\tCOMMAND")
+
+	var total time.Duration
+	recorded, failed := 0, 0
+	for _, e := range entries {
+		id := e.EntryID
+		if id == "" {
+			id = "-"
+		}
+		command := e.Lang + ": " + truncateArg(e.Code)
+		if e.IsImage {
+			command = "image: " + truncateArg(e.Code)
+		}
+		p := e.Provenance
+		if p == nil {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\t%s\n", id, command)
+			continue
+		}
+		recorded++
+		if d, err := time.ParseDuration(p.Duration); err == nil {
+			total += d
+		}
+		if p.ExitCode != 0 {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			id, p.Start, p.Duration, p.ExitCode, orDash(p.Host), orDash(p.Interpreter), command)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "\n%d entries, %d with provenance, total duration %s, %d non-zero exits\n",
+		len(entries), recorded, total, failed)
+	return err
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExecRecordsProvenance(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo plain", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(file, "bash", "echo tracked && exit 2", dir, EntryOptions{Provenance: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := Timeline(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 timeline entries, got %d", len(entries))
+	}
+	if entries[0].Provenance != nil {
+		t.Errorf("expected no provenance without the option, got %+v", entries[0].Provenance)
+	}
+	p := entries[1].Provenance
+	if p == nil {
+		t.Fatal("expected provenance to be recorded")
+	}
+	if p.ExitCode != 2 {
+		t.Errorf("expected exit code 2, got %d", p.ExitCode)
+	}
+	if p.Start == "" || p.Duration == "" || p.Host == "" {
+		t.Errorf("expected start, duration and host to be set, got %+v", p)
+	}
+	if p.Dir != dir {
+		t.Errorf("expected dir %q, got %q", dir, p.Dir)
+	}
+	if !strings.Contains(strings.ToLower(p.Interpreter), "bash") {
+		t.Errorf("expected bash interpreter version, got %q", p.Interpreter)
+	}
+
+	var buf strings.Builder
+	if err := WriteTimeline(&buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "bash: echo tracked && exit 2") {
+		t.Errorf("expected command in timeline, got:\n%s", out)
+	}
+	if !strings.Contains(out, "2 entries, 1 with provenance") || !strings.Contains(out, "1 non-zero exits") {
+		t.Errorf("expected summary line, got:\n%s", out)
+	}
+}
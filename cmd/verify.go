@@ -1,24 +1,39 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
-	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/internal/lockedfile"
 	"github.com/simonw/showboat/markdown"
 )
 
 // Diff represents a mismatch between expected and actual output of a code block.
+// EntryID is the stable ID of the entry, which unlike BlockIndex does not
+// change when other entries are added or removed. It is empty for entries
+// written before IDs were recorded. Skipped is set instead of Actual for a
+// block that was not run because a block it depends on failed.
 type Diff struct {
 	BlockIndex int
+	EntryID    string
 	Expected   string
 	Actual     string
+	Skipped    string
 }
 
 // String returns a human-readable description of the diff.
 func (d Diff) String() string {
-	return fmt.Sprintf("block %d:\n  expected: %s\n  actual:   %s",
-		d.BlockIndex,
+	label := fmt.Sprintf("block %d", d.BlockIndex)
+	if d.EntryID != "" {
+		label += fmt.Sprintf(" (entry %s)", d.EntryID)
+	}
+	if d.Skipped != "" {
+		return fmt.Sprintf("%s: skipped: %s", label, d.Skipped)
+	}
+	return fmt.Sprintf("%s:\n  expected: %s\n  actual:   %s",
+		label,
 		strings.TrimRight(d.Expected, "\n"),
 		strings.TrimRight(d.Actual, "\n"),
 	)
@@ -27,47 +42,162 @@ func (d Diff) String() string {
 // Verify re-executes all code blocks and compares outputs.
 // If outputFile is non-empty, an updated copy of the document is written there.
 // If workdir is non-empty, code blocks are executed in that directory.
+// A sealed document whose content no longer matches its seal is rejected
+// before anything is executed.
 func Verify(file, outputFile, workdir string) ([]Diff, error) {
-	blocks, err := readBlocks(file)
+	return VerifyWithOptions(file, outputFile, workdir, VerifyOptions{})
+}
+
+// VerifyOptions controls optional behaviour of Verify and Integrity.
+type VerifyOptions struct {
+	// Region is the ID of the showboat region of a larger markdown file to
+	// check, instead of the whole file. The output copy is then the whole
+	// file with only that region updated.
+	Region string
+
+	// FailFast stops at the first block whose output differs. Teardown
+	// blocks still run.
+	FailFast bool
+
+	// Chain makes every block depend on all the blocks before it, so that
+	// the blocks after the first failure are reported as skipped.
+	Chain bool
+}
+
+// VerifyWithOptions is Verify with optional behaviour controlled by opts.
+func VerifyWithOptions(file, outputFile, workdir string, opts VerifyOptions) ([]Diff, error) {
+	doc, err := document.Open(file, document.Options{Workdir: workdir, Region: opts.Region})
+	if err != nil {
+		return nil, err
+	}
+	results, err := doc.Verify(context.Background(), document.VerifyOptions{FailFast: opts.FailFast, Chain: opts.Chain})
 	if err != nil {
 		return nil, err
 	}
 
+	blocks := doc.Blocks()
 	var diffs []Diff
-
-	for i := 0; i < len(blocks); i++ {
-		cb, ok := blocks[i].(markdown.CodeBlock)
-		if !ok || cb.IsImage {
+	for _, r := range results {
+		if r.Passed() {
 			continue
 		}
-
-		// Execute the code block
-		output, _, err := execpkg.Run(cb.Lang, cb.Code, workdir)
-		if err != nil {
-			return nil, fmt.Errorf("executing block %d: %w", i, err)
-		}
-
-		// Check if next block is an OutputBlock
-		if i+1 < len(blocks) {
-			if ob, ok := blocks[i+1].(markdown.OutputBlock); ok {
-				if ob.Content != output {
-					diffs = append(diffs, Diff{
-						BlockIndex: i,
-						Expected:   ob.Content,
-						Actual:     output,
-					})
-					// Update the block for the output copy
-					blocks[i+1] = markdown.OutputBlock{Content: output}
-				}
-			}
+		diffs = append(diffs, Diff{
+			BlockIndex: r.BlockIndex,
+			EntryID:    r.EntryID,
+			Expected:   r.Expected,
+			Actual:     r.Actual,
+			Skipped:    r.Skipped,
+		})
+		if r.Skipped != "" {
+			continue
 		}
+		// Update the block for the output copy
+		blocks[r.BlockIndex+1] = markdown.OutputBlock{Content: r.Actual}
 	}
 
 	if outputFile != "" {
-		if err := writeBlocks(outputFile, blocks); err != nil {
+		// The copy records new outputs, so its hash chain is recomputed and
+		// any seal or signature, which vouch for the original, is dropped.
+		var copied []markdown.Block
+		for _, b := range markdown.Rechain(blocks) {
+			switch b.(type) {
+			case markdown.SealBlock, markdown.SignatureBlock:
+				continue
+			}
+			copied = append(copied, b)
+		}
+		if opts.Region != "" {
+			if err := writeRegionCopy(file, outputFile, opts.Region, copied); err != nil {
+				return diffs, fmt.Errorf("writing output file: %w", err)
+			}
+		} else if err := writeBlocks(outputFile, copied); err != nil {
 			return diffs, fmt.Errorf("writing output file: %w", err)
 		}
 	}
 
 	return diffs, nil
 }
+
+// IntegrityProblem describes evidence that a document was changed after it
+// was recorded: a broken link in the entry hash chain or an invalid
+// signature. BlockIndex is -1 for problems with the document as a whole.
+type IntegrityProblem struct {
+	BlockIndex int
+	EntryID    string
+	Reason     string
+}
+
+// String returns a human-readable description of the problem.
+func (p IntegrityProblem) String() string {
+	if p.BlockIndex < 0 {
+		return "integrity: " + p.Reason
+	}
+	label := fmt.Sprintf("block %d", p.BlockIndex)
+	if p.EntryID != "" {
+		label += fmt.Sprintf(" (entry %s)", p.EntryID)
+	}
+	return fmt.Sprintf("integrity: %s: %s", label, p.Reason)
+}
+
+// Integrity checks the entry hash chain of a document and, if the document is
+// signed, that the signature matches its content. It does not execute
+// anything.
+func Integrity(file string) ([]IntegrityProblem, error) {
+	return IntegrityWithOptions(file, VerifyOptions{})
+}
+
+// IntegrityWithOptions is Integrity with optional behaviour controlled by
+// opts.
+func IntegrityWithOptions(file string, opts VerifyOptions) ([]IntegrityProblem, error) {
+	blocks, err := readBlocksIn(file, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []IntegrityProblem
+	for _, ce := range markdown.CheckChain(blocks) {
+		problems = append(problems, IntegrityProblem{
+			BlockIndex: ce.Entry.Start,
+			EntryID:    ce.Entry.ID(),
+			Reason:     ce.Reason,
+		})
+	}
+	if hasSignature(blocks) {
+		if _, err := checkSignature(blocks, nil); err != nil {
+			problems = append(problems, IntegrityProblem{BlockIndex: -1, Reason: err.Error()})
+		}
+	}
+	return problems, nil
+}
+
+// readBlocksIn parses the blocks of file, or of one region of it if region
+// is not empty.
+func readBlocksIn(file, region string) ([]markdown.Block, error) {
+	if region != "" {
+		return readRegion(file, region)
+	}
+	return readBlocks(file)
+}
+
+// readRegion parses the blocks of one region of file.
+func readRegion(file, region string) ([]markdown.Block, error) {
+	data, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	return markdown.ParseRegion(data, region)
+}
+
+// writeRegionCopy writes a copy of file to dest with the given region
+// replaced by blocks.
+func writeRegionCopy(file, dest, region string, blocks []markdown.Block) error {
+	data, err := lockedfile.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	data, err = markdown.ReplaceRegion(data, region, blocks)
+	if err != nil {
+		return err
+	}
+	return lockedfile.WriteFile(dest, data, 0644)
+}
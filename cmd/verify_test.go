@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/simonw/showboat/markdown"
 )
 
 func TestVerifyPasses(t *testing.T) {
@@ -64,6 +66,12 @@ func TestVerifyDetectsDrift(t *testing.T) {
 	if !strings.Contains(diffs[0].Expected, "wrong") {
 		t.Errorf("expected expected to contain 'wrong', got: %s", diffs[0].Expected)
 	}
+	if diffs[0].EntryID == "" {
+		t.Error("expected diff to carry the entry ID")
+	}
+	if !strings.Contains(diffs[0].String(), "entry "+diffs[0].EntryID) {
+		t.Errorf("expected diff description to mention the entry, got: %s", diffs[0].String())
+	}
 }
 
 func TestVerifyWritesOutput(t *testing.T) {
@@ -119,4 +127,167 @@ func TestVerifyWritesOutput(t *testing.T) {
 	if strings.Contains(string(updatedContent), "wrong") {
 		t.Errorf("output file should not contain tampered output, got: %s", updatedContent)
 	}
+
+	// The updated copy gets a fresh hash chain.
+	problems, err := Integrity(outputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected output file to have an intact hash chain, got %v", problems)
+	}
+}
+
+func TestRegionCommands(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "CONTRIBUTING.md")
+	outside := "# Contributing\n\nHand-written  text.\n\n<!-- showboat:begin id=tests -->\n<!-- showboat:end -->\n\nMore text.\n"
+	if err := os.WriteFile(file, []byte(outside), 0644); err != nil {
+		t.Fatal(err)
+	}
+	region := EntryOptions{Region: "tests"}
+
+	if err := NoteWithOptions(file, "Say hello:", region); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(file, "bash", "echo hello", "", region); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(file, "bash", "echo popped", "", region); err != nil {
+		t.Fatal(err)
+	}
+	if err := PopWithOptions(file, region); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(content)
+	if !strings.HasPrefix(s, "# Contributing\n\nHand-written  text.\n\n<!-- showboat:begin id=tests -->\n") ||
+		!strings.HasSuffix(s, "```output\nhello\n```\n<!-- showboat:end -->\n\nMore text.\n") {
+		t.Errorf("expected text outside the region to be kept, got:\n%s", s)
+	}
+	if strings.Contains(s, "popped") {
+		t.Errorf("expected popped entry to be removed, got:\n%s", s)
+	}
+
+	// Region changes are journaled as rewrites of the whole file, so undo
+	// restores the popped entry and leaves the rest of the file as it was.
+	if err := Undo(file); err != nil {
+		t.Fatal(err)
+	}
+	undone, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(undone), "popped") || !strings.HasPrefix(string(undone), "# Contributing\n\nHand-written  text.\n") {
+		t.Errorf("expected undo to restore the popped entry, got:\n%s", undone)
+	}
+	if err := Redo(file); err != nil {
+		t.Fatal(err)
+	}
+	if redone, err := os.ReadFile(file); err != nil || string(redone) != s {
+		t.Errorf("expected redo to remove it again, got %v:\n%s", err, redone)
+	}
+
+	problems, err := IntegrityWithOptions(file, VerifyOptions{Region: "tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 0 {
+		t.Errorf("expected no integrity problems, got %v", problems)
+	}
+
+	// Break the recorded output and check verify writes a corrected copy.
+	broken := strings.Replace(s, "```output\nhello\n```", "```output\nstale\n```", 1)
+	if err := os.WriteFile(file, []byte(broken), 0644); err != nil {
+		t.Fatal(err)
+	}
+	copyFile := filepath.Join(dir, "fixed.md")
+	diffs, err := VerifyWithOptions(file, copyFile, "", VerifyOptions{Region: "tests"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 1 {
+		t.Fatalf("expected one diff, got %v", diffs)
+	}
+	fixed, err := os.ReadFile(copyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(fixed), "# Contributing\n\nHand-written  text.\n") || !strings.Contains(string(fixed), "```output\nhello\n```") {
+		t.Errorf("expected whole file with the region updated, got:\n%s", fixed)
+	}
+
+	if err := NoteWithOptions(file, "x", EntryOptions{Region: "missing"}); err == nil {
+		t.Error("expected error for an unknown region")
+	}
+}
+
+func TestVerifySkipsDependents(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+
+	if err := Init(file, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Exec(file, "bash", "echo hello", ""); err != nil {
+		t.Fatal(err)
+	}
+	blocks, err := readBlocks(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := blocks[1].(markdown.CodeBlock).ID
+	if _, _, err := ExecWithOptions(file, "bash", "echo next", "", EntryOptions{Needs: []string{id}}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(content), "```output\nhello\n```", "```output\nwrong\n```", 1)
+	if err := os.WriteFile(file, []byte(tampered), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := Verify(file, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 {
+		t.Fatalf("expected 2 diffs, got %d: %v", len(diffs), diffs)
+	}
+	if want := "skipped: needs entry " + id + ", which failed"; !strings.HasSuffix(diffs[1].String(), want) {
+		t.Errorf("expected %q, got %q", want, diffs[1].String())
+	}
+
+	commands, err := Extract(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := commands[len(commands)-1]; !strings.HasSuffix(got, "--needs "+id) {
+		t.Errorf("expected extract to keep --needs, got %s", got)
+	}
+	if got := commands[len(commands)-2]; !strings.HasSuffix(got, "--id "+id) {
+		t.Errorf("expected extract to keep the ID of the needed entry, got %s", got)
+	}
+
+	// Replaying the commands recreates the needed entry with its ID.
+	replay := filepath.Join(dir, "replay.md")
+	if err := Init(replay, "Test", "dev"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(replay, "bash", "echo hello", "", EntryOptions{ID: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(replay, "bash", "echo next", "", EntryOptions{Needs: []string{id}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ExecWithOptions(replay, "bash", "echo again", "", EntryOptions{ID: id}); err == nil {
+		t.Error("expected an ID already in the document to be rejected")
+	}
 }
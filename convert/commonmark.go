@@ -0,0 +1,142 @@
+package convert
+
+import (
+	"html"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// renderMarkdown converts commentary text to HTML. It handles the subset of
+// markdown that agents commonly write in notes: headings, paragraphs, bullet
+// and numbered lists, block quotes, inline code, emphasis, links and images.
+// Anything else is rendered as plain escaped text. Images with a local path,
+// relative to baseDir, are embedded as data URIs.
+func renderMarkdown(text, baseDir string) string {
+	var sb strings.Builder
+	var para []string
+	listTag := ""
+
+	flushPara := func() {
+		if len(para) > 0 {
+			sb.WriteString("<p>" + renderInline(strings.Join(para, "\n"), baseDir) + "</p>\n")
+			para = nil
+		}
+	}
+	closeList := func() {
+		if listTag != "" {
+			sb.WriteString("</" + listTag + ">\n")
+			listTag = ""
+		}
+	}
+	openList := func(tag string) {
+		if listTag != tag {
+			closeList()
+			sb.WriteString("<" + tag + ">\n")
+			listTag = tag
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flushPara()
+			closeList()
+		case headingRe.MatchString(trimmed):
+			flushPara()
+			closeList()
+			m := headingRe.FindStringSubmatch(trimmed)
+			level := string(rune('0' + len(m[1])))
+			sb.WriteString("<h" + level + ">" + renderInline(m[2], baseDir) + "</h" + level + ">\n")
+		case bulletRe.MatchString(line):
+			flushPara()
+			openList("ul")
+			sb.WriteString("<li>" + renderInline(bulletRe.ReplaceAllString(line, ""), baseDir) + "</li>\n")
+		case orderedRe.MatchString(line):
+			flushPara()
+			openList("ol")
+			sb.WriteString("<li>" + renderInline(orderedRe.ReplaceAllString(line, ""), baseDir) + "</li>\n")
+		case strings.HasPrefix(trimmed, ">"):
+			flushPara()
+			closeList()
+			quoted := strings.TrimSpace(strings.TrimPrefix(trimmed, ">"))
+			sb.WriteString("<blockquote>" + renderInline(quoted, baseDir) + "</blockquote>\n")
+		default:
+			closeList()
+			para = append(para, trimmed)
+		}
+	}
+	flushPara()
+	closeList()
+	return sb.String()
+}
+
+var (
+	headingRe    = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bulletRe     = regexp.MustCompile(`^\s*[-*+]\s+`)
+	orderedRe    = regexp.MustCompile(`^\s*\d+[.)]\s+`)
+	inlineCodeRe = regexp.MustCompile("`([^`]+)`")
+	imageRe      = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+	linkRe       = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldRe       = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicRe     = regexp.MustCompile(`\*([^*]+)\*|\b_([^_]+)_\b`)
+)
+
+// renderInline escapes text and converts inline markdown to HTML. Code spans
+// are swapped out first so their contents are not formatted. Images are
+// embedded as by renderMarkdown.
+func renderInline(text, baseDir string) string {
+	var spans []string
+	text = inlineCodeRe.ReplaceAllStringFunc(text, func(m string) string {
+		spans = append(spans, "<code>"+html.EscapeString(m[1:len(m)-1])+"</code>")
+		return "\x00" + strconv.Itoa(len(spans)-1) + "\x00"
+	})
+
+	text = html.EscapeString(text)
+	text = imageRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := imageRe.FindStringSubmatch(m)
+		return inlineImageHTML(sub[1], html.UnescapeString(sub[2]), baseDir)
+	})
+	text = linkRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := linkRe.FindStringSubmatch(m)
+		if !safeURL(html.UnescapeString(sub[2])) {
+			return sub[1]
+		}
+		return `<a href="` + sub[2] + `">` + sub[1] + `</a>`
+	})
+	text = boldRe.ReplaceAllString(text, "<strong>$1</strong>")
+	text = italicRe.ReplaceAllString(text, "<em>$1$2</em>")
+
+	for i, span := range spans {
+		text = strings.Replace(text, "\x00"+strconv.Itoa(i)+"\x00", span, 1)
+	}
+	return text
+}
+
+// inlineImageHTML returns an img tag for an image in a note. alt is already
+// escaped. An image with a local path is embedded as a data URI so that the
+// page stands alone, like the images recorded by "showboat image"; one that
+// cannot be embedded is reported in its place. Images with a URL keep it.
+func inlineImageHTML(alt, src, baseDir string) string {
+	if u, err := url.Parse(src); err != nil || u.Scheme != "" || u.Host != "" {
+		return `<img alt="` + alt + `" src="` + html.EscapeString(src) + `">`
+	}
+	path := filepath.FromSlash(src)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(baseDir, path)
+	}
+	uri, err := dataURI(path)
+	if err != nil {
+		return `<span class="missing">Image ` + html.EscapeString(src) + ` could not be embedded: ` + html.EscapeString(err.Error()) + `</span>`
+	}
+	return `<img alt="` + alt + `" src="` + uri + `">`
+}
+
+// safeURL rejects link targets that would run script when clicked.
+func safeURL(u string) bool {
+	lower := strings.ToLower(strings.TrimSpace(u))
+	return !strings.HasPrefix(lower, "javascript:") && !strings.HasPrefix(lower, "data:") && !strings.HasPrefix(lower, "vbscript:")
+}
@@ -0,0 +1,26 @@
+package convert
+
+import "fmt"
+
+// Fixtures controls how an export shows setup and teardown entries.
+type Fixtures string
+
+const (
+	FixturesShow     Fixtures = ""         // like any other entry
+	FixturesCollapse Fixtures = "collapse" // folded away, but present
+	FixturesHide     Fixtures = "hide"     // left out
+)
+
+// ParseFixtures parses the value of an export's --fixtures option: "show",
+// "collapse" or "hide".
+func ParseFixtures(s string) (Fixtures, error) {
+	switch s {
+	case "show":
+		return FixturesShow, nil
+	case "collapse":
+		return FixturesCollapse, nil
+	case "hide":
+		return FixturesHide, nil
+	}
+	return "", fmt.Errorf("invalid --fixtures value %q (want show, collapse or hide)", s)
+}
@@ -0,0 +1,87 @@
+package convert
+
+import (
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// GoTestOptions controls WriteGoTest.
+type GoTestOptions struct {
+	// Package is the package clause of the generated file.
+	Package string
+
+	// Document is the path of the document as seen from the package
+	// directory, where "go test" runs.
+	Document string
+}
+
+// WriteGoTest writes a Go test file with one test function that verifies
+// the document through the showboattest package, which runs each code block
+// as a subtest.
+func WriteGoTest(w io.Writer, opts GoTestOptions) error {
+	src := fmt.Sprintf(`// Code generated by "showboat export --go-test"; DO NOT EDIT.
+
+package %s
+
+import (
+	"testing"
+
+	"github.com/simonw/showboat/showboattest"
+)
+
+func %s(t *testing.T) {
+	showboattest.Run(t, %s)
+}
+`, opts.Package, GoTestName(opts.Document), strconv.Quote(filepath.ToSlash(opts.Document)))
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return fmt.Errorf("formatting test file: %w", err)
+	}
+	_, err = w.Write(formatted)
+	return err
+}
+
+// GoTestName returns the test function name for a document: "Test"
+// followed by the file's base name in CamelCase, so "setup-guide.md"
+// becomes "TestSetupGuide".
+func GoTestName(document string) string {
+	base := filepath.Base(document)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	var sb strings.Builder
+	sb.WriteString("Test")
+	upper := true
+	for _, r := range base {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// GoPackageName returns a package name derived from a directory name, or
+// "docs" if the name cannot be used as one.
+func GoPackageName(dir string) string {
+	var sb strings.Builder
+	for _, r := range strings.ToLower(filepath.Base(dir)) {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			sb.WriteRune(r)
+		}
+	}
+	name := sb.String()
+	if name == "" || name[0] >= '0' && name[0] <= '9' {
+		return "docs"
+	}
+	return name
+}
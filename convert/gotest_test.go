@@ -0,0 +1,44 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWriteGoTest(t *testing.T) {
+	var buf strings.Builder
+	if err := WriteGoTest(&buf, GoTestOptions{Package: "docs", Document: "setup-guide.md"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"package docs\n",
+		"func TestSetupGuide(t *testing.T) {",
+		`showboattest.Run(t, "setup-guide.md")`,
+		"DO NOT EDIT",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected generated file to contain %q, got:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestGoNames(t *testing.T) {
+	for in, want := range map[string]string{
+		"demo.md":          "TestDemo",
+		"docs/my_demo.md":  "TestMyDemo",
+		"release notes.md": "TestReleaseNotes",
+	} {
+		if got := GoTestName(in); got != want {
+			t.Errorf("GoTestName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	for in, want := range map[string]string{
+		"/src/project/docs": "docs",
+		"/src/My-Demos":     "mydemos",
+		"/tmp/2026":         "docs",
+	} {
+		if got := GoPackageName(in); got != want {
+			t.Errorf("GoPackageName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package convert
+
+import (
+	"html"
+	"strings"
+)
+
+// syntax describes the lexical conventions used to highlight a language.
+type syntax struct {
+	lineComments []string
+	blockComment [2]string
+	quotes       string
+	keywords     map[string]bool
+}
+
+func words(s string) map[string]bool {
+	m := make(map[string]bool)
+	for _, w := range strings.Fields(s) {
+		m[w] = true
+	}
+	return m
+}
+
+var (
+	shellSyntax = syntax{
+		lineComments: []string{"#"},
+		quotes:       `'"`,
+		keywords: words(`if then else elif fi for while until do done case esac in
+			function return local export echo cd exit set unset source true false`),
+	}
+	pythonSyntax = syntax{
+		lineComments: []string{"#"},
+		quotes:       `'"`,
+		keywords: words(`and as assert async await break class continue def del elif else
+			except finally for from global if import in is lambda nonlocal not or pass
+			raise return try while with yield None True False print`),
+	}
+	rubySyntax = syntax{
+		lineComments: []string{"#"},
+		quotes:       `'"`,
+		keywords: words(`begin class def do else elsif end ensure if module nil puts
+			require rescue return self then unless until when while yield true false`),
+	}
+	cSyntax = syntax{
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       "'\"`",
+		keywords: words(`break case catch class const continue default defer do else
+			export extends false finally for func function go if import interface let
+			new nil null package range return static struct switch this throw true
+			try type typeof var void while`),
+	}
+	sqlSyntax = syntax{
+		lineComments: []string{"--"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `'"`,
+		keywords: words(`select from where insert into values update set delete create
+			table drop alter join left right inner outer on group by order having
+			limit as and or not null is in distinct count
+			SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP
+			ALTER JOIN LEFT RIGHT INNER OUTER ON GROUP BY ORDER HAVING LIMIT AS AND
+			OR NOT NULL IS IN DISTINCT COUNT`),
+	}
+)
+
+// syntaxFor returns the highlighting rules for a fence language, or nil if
+// the language is not recognised.
+func syntaxFor(lang string) *syntax {
+	switch strings.TrimRight(strings.ToLower(lang), "0123456789.") {
+	case "bash", "sh", "zsh", "shell", "console":
+		return &shellSyntax
+	case "python", "py":
+		return &pythonSyntax
+	case "ruby", "rb":
+		return &rubySyntax
+	case "node", "javascript", "js", "typescript", "ts", "deno", "go", "c", "cpp", "java", "rust", "php", "swift":
+		return &cSyntax
+	case "sqlite", "sql", "psql", "mysql":
+		return &sqlSyntax
+	}
+	return nil
+}
+
+// highlight returns code as escaped HTML with comments, strings, numbers and
+// keywords wrapped in spans. Unknown languages are escaped only.
+func highlight(lang, code string) string {
+	syn := syntaxFor(lang)
+	if syn == nil {
+		return html.EscapeString(code)
+	}
+
+	var sb strings.Builder
+	span := func(class, text string) {
+		sb.WriteString(`<span class="` + class + `">`)
+		sb.WriteString(html.EscapeString(text))
+		sb.WriteString("</span>")
+	}
+
+	i := 0
+	for i < len(code) {
+		rest := code[i:]
+
+		if syn.blockComment[0] != "" && strings.HasPrefix(rest, syn.blockComment[0]) {
+			end := strings.Index(rest[len(syn.blockComment[0]):], syn.blockComment[1])
+			n := len(rest)
+			if end != -1 {
+				n = len(syn.blockComment[0]) + end + len(syn.blockComment[1])
+			}
+			span("c", rest[:n])
+			i += n
+			continue
+		}
+
+		if isLineComment(syn, code, i) {
+			n := strings.IndexByte(rest, '\n')
+			if n == -1 {
+				n = len(rest)
+			}
+			span("c", rest[:n])
+			i += n
+			continue
+		}
+
+		c := code[i]
+		if strings.IndexByte(syn.quotes, c) != -1 {
+			n := 1
+			for n < len(rest) && rest[n] != c {
+				if rest[n] == '\\' {
+					n++
+				}
+				n++
+			}
+			if n < len(rest) {
+				n++ // closing quote
+			} else {
+				n = len(rest)
+			}
+			span("s", rest[:n])
+			i += n
+			continue
+		}
+
+		if isWordByte(c) {
+			n := 0
+			for n < len(rest) && isWordByte(rest[n]) {
+				n++
+			}
+			word := rest[:n]
+			switch {
+			case word[0] >= '0' && word[0] <= '9':
+				span("n", word)
+			case syn.keywords[word]:
+				span("k", word)
+			default:
+				sb.WriteString(html.EscapeString(word))
+			}
+			i += n
+			continue
+		}
+
+		// Copy byte by byte so multi-byte UTF-8 sequences pass through intact.
+		sb.WriteString(html.EscapeString(code[i : i+1]))
+		i++
+	}
+	return sb.String()
+}
+
+// isLineComment reports whether a line comment starts at code[i]. A "#" only
+// starts a comment at the start of a word, so "$#" and "a#b" in shell are
+// left alone.
+func isLineComment(syn *syntax, code string, i int) bool {
+	for _, prefix := range syn.lineComments {
+		if !strings.HasPrefix(code[i:], prefix) {
+			continue
+		}
+		if prefix == "#" && i > 0 && !strings.ContainsRune(" \t\n;(", rune(code[i-1])) {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
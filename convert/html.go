@@ -0,0 +1,258 @@
+package convert
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// HTMLOptions controls WriteHTML.
+type HTMLOptions struct {
+	// BaseDir is the directory that image filenames are relative to,
+	// normally the directory containing the document.
+	BaseDir string
+
+	// Verified adds a verification status to the code entries. Ran holds
+	// the block index of each code block that was re-run, Mismatches maps
+	// those whose output changed to the output they produced, and Skipped
+	// maps the block index of each block that was not re-run to the
+	// reason. Blocks that ran without a mismatch passed; blocks in none of
+	// the maps get no status.
+	Verified   bool
+	Ran        map[int]bool
+	Mismatches map[int]string
+	Skipped    map[int]string
+
+	// CollapseLines is the number of output lines above which an output is
+	// collapsed behind a summary. Zero means 20.
+	CollapseLines int
+
+	// Fixtures controls how setup and teardown entries are shown.
+	Fixtures Fixtures
+}
+
+// WriteHTML renders blocks as a single self-contained HTML page. Images are
+// embedded as data URIs and all styling is inline, so the file can be shared
+// on its own. Each entry is wrapped in an element whose id is
+// "entry-<entry ID>", so links can point at individual entries.
+func WriteHTML(w io.Writer, blocks []markdown.Block, opts HTMLOptions) error {
+	collapse := opts.CollapseLines
+	if collapse == 0 {
+		collapse = 20
+	}
+
+	title := "Showboat document"
+	if len(blocks) > 0 {
+		if tb, ok := blocks[0].(markdown.TitleBlock); ok {
+			title = tb.Title
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html lang=\"en\">\n<head>\n<meta charset=\"utf-8\">\n")
+	sb.WriteString("<meta name=\"viewport\" content=\"width=device-width, initial-scale=1\">\n")
+	fmt.Fprintf(&sb, "<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n<main>\n", html.EscapeString(title), htmlStyle)
+
+	for _, b := range blocks {
+		if tb, ok := b.(markdown.TitleBlock); ok {
+			writeTitleHTML(&sb, tb)
+		}
+	}
+
+	for _, e := range markdown.Entries(blocks) {
+		fixture := ""
+		if cb, ok := e.Blocks[0].(markdown.CodeBlock); ok && cb.IsFixture() {
+			fixture = cb.Role
+		}
+		if fixture != "" && opts.Fixtures == FixturesHide {
+			continue
+		}
+		id := e.ID()
+		if id != "" {
+			fmt.Fprintf(&sb, "<section class=\"entry\" id=\"entry-%s\">\n", html.EscapeString(id))
+		} else {
+			sb.WriteString("<section class=\"entry\">\n")
+		}
+		collapsed := fixture != "" && opts.Fixtures == FixturesCollapse
+		if collapsed {
+			fmt.Fprintf(&sb, "<details class=\"fixture\"><summary>%s</summary>\n", strings.ToUpper(fixture[:1])+fixture[1:])
+		}
+		for i, b := range e.Blocks {
+			switch blk := b.(type) {
+			case markdown.CommentaryBlock:
+				sb.WriteString("<div class=\"note\">\n" + renderMarkdown(blk.Text, opts.BaseDir) + "</div>\n")
+			case markdown.CodeBlock:
+				writeCodeHTML(&sb, blk, id)
+				if opts.Verified && !blk.IsImage && !blk.IsRecord() {
+					writeStatusHTML(&sb, opts, e.Start+i)
+				}
+			case markdown.OutputBlock:
+				writeOutputHTML(&sb, blk.Content, collapse)
+			case markdown.ImageOutputBlock:
+				writeImageHTML(&sb, blk, opts.BaseDir)
+			}
+		}
+		if collapsed {
+			sb.WriteString("</details>\n")
+		}
+		sb.WriteString("</section>\n")
+	}
+
+	for _, b := range blocks {
+		switch blk := b.(type) {
+		case markdown.SealBlock:
+			fmt.Fprintf(&sb, "<footer class=\"attestation\">Sealed %s<br><code>%s</code></footer>\n",
+				html.EscapeString(blk.Timestamp), html.EscapeString(blk.Hash))
+		case markdown.SignatureBlock:
+			fmt.Fprintf(&sb, "<footer class=\"attestation\">Signed with ed25519 key <code>%s</code></footer>\n",
+				html.EscapeString(blk.PublicKey))
+		}
+	}
+
+	sb.WriteString("</main>\n</body>\n</html>\n")
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func writeTitleHTML(sb *strings.Builder, tb markdown.TitleBlock) {
+	fmt.Fprintf(sb, "<header>\n<h1>%s</h1>\n<dl class=\"meta\">\n", html.EscapeString(tb.Title))
+	m := tb.Metadata
+	meta := [][2]string{
+		{"Created", tb.Timestamp},
+		{"Author", m.Author},
+		{"Agent", m.Agent},
+		{"Model", m.Model},
+		{"Task", m.Task},
+		{"Tags", strings.Join(m.TagList(), ", ")},
+		{"Repository", m.Repo},
+		{"Commit", m.Commit},
+		{"Showboat", tb.Version},
+		{"Document ID", tb.DocumentID},
+	}
+	for _, m := range meta {
+		if m[1] != "" {
+			fmt.Fprintf(sb, "<dt>%s</dt><dd>%s</dd>\n", m[0], html.EscapeString(m[1]))
+		}
+	}
+	sb.WriteString("</dl>\n</header>\n")
+}
+
+func writeCodeHTML(sb *strings.Builder, cb markdown.CodeBlock, id string) {
+	label := cb.Lang
+	if cb.IsImage {
+		label = "image"
+	}
+	if cb.Role != "" {
+		label += " {" + cb.Role + "}"
+	}
+	if cb.Service != nil {
+		label += " " + cb.Service.Name
+	}
+	sb.WriteString("<div class=\"code-header\">")
+	if id != "" {
+		fmt.Fprintf(sb, "<a class=\"anchor\" href=\"#entry-%s\">#%s</a> ", html.EscapeString(id), html.EscapeString(id))
+	}
+	sb.WriteString(html.EscapeString(label))
+	if p := cb.Provenance; p != nil {
+		fmt.Fprintf(sb, " <span class=\"provenance\">%s &middot; %s &middot; exit %d</span>",
+			html.EscapeString(p.Start), html.EscapeString(p.Duration), p.ExitCode)
+	}
+	sb.WriteString("</div>\n")
+	fmt.Fprintf(sb, "<pre class=\"code\"><code class=\"language-%s\">%s</code></pre>\n",
+		html.EscapeString(cb.Lang), highlight(cb.Lang, cb.Code))
+}
+
+func writeStatusHTML(sb *strings.Builder, opts HTMLOptions, index int) {
+	if reason, skipped := opts.Skipped[index]; skipped {
+		fmt.Fprintf(sb, "<div class=\"status skip\">&#8211; not re-run: %s</div>\n", html.EscapeString(reason))
+		return
+	}
+	if !opts.Ran[index] {
+		return
+	}
+	actual, failed := opts.Mismatches[index]
+	if !failed {
+		sb.WriteString("<div class=\"status pass\">&#10003; output verified</div>\n")
+		return
+	}
+	sb.WriteString("<div class=\"status fail\">&#10007; output differs when re-run")
+	fmt.Fprintf(sb, "<details><summary>Actual output</summary><pre>%s</pre></details></div>\n", html.EscapeString(actual))
+}
+
+func writeOutputHTML(sb *strings.Builder, content string, collapse int) {
+	body := fmt.Sprintf("<pre class=\"output\">%s</pre>\n", html.EscapeString(strings.TrimSuffix(content, "\n")))
+	lines := strings.Count(content, "\n")
+	if lines <= collapse {
+		sb.WriteString(body)
+		return
+	}
+	fmt.Fprintf(sb, "<details class=\"output\"><summary>Output (%d lines)</summary>\n%s</details>\n", lines, body)
+}
+
+// imageTypes maps image extensions to MIME types for data URIs.
+var imageTypes = map[string]string{
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".svg":  "image/svg+xml",
+}
+
+func writeImageHTML(sb *strings.Builder, img markdown.ImageOutputBlock, baseDir string) {
+	src, err := dataURI(filepath.Join(baseDir, img.Filename))
+	if err != nil {
+		fmt.Fprintf(sb, "<p class=\"missing\">Image %s could not be embedded: %s</p>\n",
+			html.EscapeString(img.Filename), html.EscapeString(err.Error()))
+		return
+	}
+	fmt.Fprintf(sb, "<figure><img alt=\"%s\" src=\"%s\"></figure>\n", html.EscapeString(img.AltText), src)
+}
+
+// dataURI returns the contents of an image file as a base64 data URI.
+func dataURI(path string) (string, error) {
+	mime, ok := imageTypes[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return "", fmt.Errorf("unrecognized image format: %s", filepath.Ext(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+const htmlStyle = `body { margin: 0; background: #f6f7f9; color: #1f2328; font: 16px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; }
+main { max-width: 960px; margin: 0 auto; padding: 2em 1.5em; }
+header h1 { margin-bottom: 0.25em; }
+dl.meta { display: grid; grid-template-columns: max-content 1fr; gap: 0.1em 1em; color: #59636e; font-size: 0.85em; }
+dl.meta dt { font-weight: 600; }
+dl.meta dd { margin: 0; font-family: ui-monospace, SFMono-Regular, Menlo, monospace; }
+.entry { margin: 1.5em 0; }
+.note p { margin: 0.5em 0; }
+pre { margin: 0; padding: 0.75em 1em; overflow-x: auto; font: 13px/1.45 ui-monospace, SFMono-Regular, Menlo, monospace; white-space: pre-wrap; word-break: break-word; }
+.code-header { font: 12px ui-monospace, SFMono-Regular, Menlo, monospace; color: #59636e; padding: 0.3em 1em; background: #eaeef2; border: 1px solid #d1d9e0; border-bottom: none; border-radius: 6px 6px 0 0; }
+.code-header .anchor { color: #59636e; text-decoration: none; }
+.provenance { float: right; }
+pre.code { background: #ffffff; border: 1px solid #d1d9e0; }
+pre.output { background: #1f2328; color: #e6edf3; border-radius: 0 0 6px 6px; }
+details.output > summary { cursor: pointer; padding: 0.3em 1em; background: #1f2328; color: #9198a1; font-size: 0.85em; }
+details.fixture > summary { cursor: pointer; color: #59636e; font-size: 0.85em; }
+.status { font-size: 0.85em; padding: 0.3em 1em; }
+.status.pass { color: #1a7f37; }
+.status.fail { color: #d1242f; }
+.status.skip { color: #9a6700; }
+figure { margin: 0; padding: 1em; background: #ffffff; border: 1px solid #d1d9e0; border-radius: 0 0 6px 6px; }
+figure img { max-width: 100%; }
+.missing { color: #d1242f; }
+.attestation { margin-top: 2em; font-size: 0.85em; color: #59636e; word-break: break-all; }
+.k { color: #cf222e; }
+.s { color: #0a3069; }
+.c { color: #6e7781; font-style: italic; }
+.n { color: #0550ae; }
+`
@@ -0,0 +1,177 @@
+package convert
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestWriteHTML(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "shot.png"), []byte("\x89PNG fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := []markdown.Block{
+		markdown.TitleBlock{Title: "Demo <1>", Timestamp: "2026-02-06T15:30:00Z", Version: "dev", DocumentID: "doc-1"},
+		markdown.CommentaryBlock{Text: "Some **bold** text and `code`.", ID: "aaaa1111"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo 'hi' # greet", ID: "bbbb2222"},
+		markdown.OutputBlock{Content: "hi\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "shot.png", IsImage: true, ID: "cccc3333"},
+		markdown.ImageOutputBlock{AltText: "shot", Filename: "shot.png"},
+	}
+
+	var buf strings.Builder
+	if err := WriteHTML(&buf, blocks, HTMLOptions{BaseDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"<title>Demo &lt;1&gt;</title>",
+		"<dd>doc-1</dd>",
+		`<section class="entry" id="entry-aaaa1111">`,
+		`<section class="entry" id="entry-bbbb2222">`,
+		"<strong>bold</strong>",
+		"<code>code</code>",
+		`<span class="k">echo</span>`,
+		`<span class="s">&#39;hi&#39;</span>`,
+		`<span class="c"># greet</span>`,
+		`<pre class="output">hi</pre>`,
+		`src="data:image/png;base64,`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected HTML to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "output verified") {
+		t.Error("expected no verification status without Verified")
+	}
+}
+
+func TestWriteHTMLCollapsesLongOutput(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.CodeBlock{Lang: "bash", Code: "seq 3"},
+		markdown.OutputBlock{Content: "1\n2\n3\n"},
+	}
+
+	var buf strings.Builder
+	if err := WriteHTML(&buf, blocks, HTMLOptions{CollapseLines: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "<summary>Output (3 lines)</summary>") {
+		t.Errorf("expected long output to be collapsed, got:\n%s", buf.String())
+	}
+}
+
+func TestWriteHTMLVerifyStatus(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.CodeBlock{Lang: "bash", Code: "echo a"},
+		markdown.OutputBlock{Content: "a\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "date"},
+		markdown.OutputBlock{Content: "yesterday\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "date +%Y"},
+		markdown.OutputBlock{Content: "2026\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "uptime"},
+		markdown.OutputBlock{Content: "up\n"},
+	}
+
+	// Block 6 was never run, as after a --fail-fast stop.
+	var buf strings.Builder
+	opts := HTMLOptions{
+		Verified:   true,
+		Ran:        map[int]bool{0: true, 2: true},
+		Mismatches: map[int]string{2: "today\n"},
+		Skipped:    map[int]string{4: "block 2 failed before it"},
+	}
+	if err := WriteHTML(&buf, blocks, opts); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Count(out, "output verified") != 1 {
+		t.Errorf("expected one verified block, got:\n%s", out)
+	}
+	if !strings.Contains(out, "output differs when re-run") || !strings.Contains(out, "today") {
+		t.Errorf("expected mismatch with actual output, got:\n%s", out)
+	}
+	if !strings.Contains(out, "not re-run: block 2 failed before it") {
+		t.Errorf("expected skipped block with its reason, got:\n%s", out)
+	}
+}
+
+func TestWriteHTMLFixtures(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.CodeBlock{Lang: "bash", Code: "make seed", Role: markdown.RoleSetup, ID: "aaaa1111"},
+		markdown.OutputBlock{Content: "seeded\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo hi", ID: "bbbb2222"},
+		markdown.OutputBlock{Content: "hi\n"},
+	}
+	render := func(f Fixtures) string {
+		var buf strings.Builder
+		if err := WriteHTML(&buf, blocks, HTMLOptions{Fixtures: f}); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	if out := render(FixturesShow); !strings.Contains(out, "bash {setup}") || strings.Contains(out, `<details class="fixture">`) {
+		t.Errorf("expected the setup entry to be shown as it is, got:\n%s", out)
+	}
+	if out := render(FixturesCollapse); !strings.Contains(out, "<details class=\"fixture\"><summary>Setup</summary>\n<div class=\"code-header\">") {
+		t.Errorf("expected the setup entry to be collapsed, got:\n%s", out)
+	}
+	out := render(FixturesHide)
+	if strings.Contains(out, "entry-aaaa1111") || !strings.Contains(out, "entry-bbbb2222") {
+		t.Errorf("expected only the setup entry to be left out, got:\n%s", out)
+	}
+	if _, err := ParseFixtures("fold"); err == nil {
+		t.Error("expected an invalid --fixtures value to be rejected")
+	}
+}
+
+func TestWriteHTMLMissingImage(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.ImageOutputBlock{AltText: "gone", Filename: "gone.png"},
+	}
+
+	var buf strings.Builder
+	if err := WriteHTML(&buf, blocks, HTMLOptions{BaseDir: t.TempDir()}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "Image gone.png could not be embedded") {
+		t.Errorf("expected missing image notice, got:\n%s", buf.String())
+	}
+}
+
+func TestRenderInlineRejectsScriptLinks(t *testing.T) {
+	got := renderInline("[click](javascript:alert(1)) <b>", "")
+	if strings.Contains(got, "href") || strings.Contains(got, "<b>") {
+		t.Errorf("expected unsafe link and tags to be neutralised, got %q", got)
+	}
+}
+
+func TestRenderMarkdownEmbedsImages(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "img"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "img", "diagram.png"), []byte("\x89PNG fake"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got := renderMarkdown("See ![the diagram](img/diagram.png), ![logo](https://example.com/logo.png) and ![gone](gone.png).", dir)
+	for _, want := range []string{
+		`<img alt="the diagram" src="data:image/png;base64,`,
+		`<img alt="logo" src="https://example.com/logo.png">`,
+		`Image gone.png could not be embedded`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, `src="img/diagram.png"`) {
+		t.Errorf("expected the local image not to be linked, got:\n%s", got)
+	}
+}
@@ -0,0 +1,261 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// JSONVersion is the version of the JSON document model written by
+// WriteJSON. It is incremented whenever a field is removed or its meaning
+// changes; new optional fields do not change it.
+const JSONVersion = 1
+
+// JSONDocument is the JSON representation of a showboat document:
+//
+//	{"format": "showboat", "version": 1, "blocks": [...]}
+//
+// Blocks appear in document order. Converting a document to JSON and back
+// reproduces its markdown exactly.
+type JSONDocument struct {
+	Format  string      `json:"format"`
+	Version int         `json:"version"`
+	Blocks  []JSONBlock `json:"blocks"`
+}
+
+// JSONBlock is one block of a document. Type is the block's Type(): "title",
+// "commentary", "code", "output", "output-image", "signature" or "seal".
+// Only the fields that apply to the type are set:
+//
+//   - title: Title, Timestamp, ShowboatVersion, DocumentID, Metadata
+//   - commentary: Content, ID, Hash
+//   - code: Lang, Content, Image, Role, Needs, ID, Hash, Provenance, Service
+//   - output: Content
+//   - output-image: Alt, Filename
+//   - signature: PublicKey, Signature
+//   - seal: Hash, Timestamp
+//
+// Line is the 1-based line the block starts on in the markdown file, or 0
+// when unknown. It is informational and ignored when reading.
+type JSONBlock struct {
+	Type string `json:"type"`
+	Line int    `json:"line,omitempty"`
+
+	Title           string `json:"title,omitempty"`
+	Timestamp       string `json:"timestamp,omitempty"`
+	ShowboatVersion string `json:"showboat_version,omitempty"`
+	DocumentID      string `json:"document_id,omitempty"`
+
+	Metadata *JSONMetadata `json:"metadata,omitempty"`
+
+	ID         string          `json:"id,omitempty"`
+	Hash       string          `json:"hash,omitempty"`
+	Lang       string          `json:"lang,omitempty"`
+	Image      bool            `json:"image,omitempty"`
+	Role       string          `json:"role,omitempty"`
+	Needs      []string        `json:"needs,omitempty"`
+	Content    *string         `json:"content,omitempty"`
+	Provenance *JSONProvenance `json:"provenance,omitempty"`
+	Service    *JSONService    `json:"service,omitempty"`
+
+	Alt      string `json:"alt,omitempty"`
+	Filename string `json:"filename,omitempty"`
+
+	PublicKey string `json:"public_key,omitempty"`
+	Signature string `json:"signature,omitempty"`
+}
+
+// JSONProvenance mirrors markdown.Provenance.
+type JSONProvenance struct {
+	Start       string `json:"start,omitempty"`
+	Duration    string `json:"duration,omitempty"`
+	ExitCode    int    `json:"exit_code"`
+	Host        string `json:"host,omitempty"`
+	Dir         string `json:"dir,omitempty"`
+	Interpreter string `json:"interpreter,omitempty"`
+}
+
+// JSONService mirrors markdown.Service.
+type JSONService struct {
+	Name  string `json:"name"`
+	Ready string `json:"ready,omitempty"`
+}
+
+// JSONMetadata mirrors markdown.Metadata, with the tags as a list.
+type JSONMetadata struct {
+	Author string   `json:"author,omitempty"`
+	Agent  string   `json:"agent,omitempty"`
+	Model  string   `json:"model,omitempty"`
+	Task   string   `json:"task,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Repo   string   `json:"repo,omitempty"`
+	Commit string   `json:"commit,omitempty"`
+}
+
+// jsonMetadata converts m, returning nil when no field is set.
+func jsonMetadata(m markdown.Metadata) *JSONMetadata {
+	if m.IsZero() {
+		return nil
+	}
+	return &JSONMetadata{
+		Author: m.Author,
+		Agent:  m.Agent,
+		Model:  m.Model,
+		Task:   m.Task,
+		Tags:   m.TagList(),
+		Repo:   m.Repo,
+		Commit: m.Commit,
+	}
+}
+
+// metadata converts m back; a nil m has no fields set.
+func (m *JSONMetadata) metadata() markdown.Metadata {
+	if m == nil {
+		return markdown.Metadata{}
+	}
+	return markdown.Metadata{
+		Author: m.Author,
+		Agent:  m.Agent,
+		Model:  m.Model,
+		Task:   m.Task,
+		Tags:   strings.Join(m.Tags, ","),
+		Repo:   m.Repo,
+		Commit: m.Commit,
+	}
+}
+
+// WriteJSON writes blocks as a JSONDocument. lines gives the source line of
+// each block and may be nil.
+func WriteJSON(w io.Writer, blocks []markdown.Block, lines []int) error {
+	doc := JSONDocument{Format: "showboat", Version: JSONVersion, Blocks: []JSONBlock{}}
+	for i, b := range blocks {
+		jb, err := jsonBlock(b)
+		if err != nil {
+			return err
+		}
+		if i < len(lines) {
+			jb.Line = lines[i]
+		}
+		doc.Blocks = append(doc.Blocks, jb)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func jsonBlock(b markdown.Block) (JSONBlock, error) {
+	jb := JSONBlock{Type: b.Type()}
+	switch blk := b.(type) {
+	case markdown.TitleBlock:
+		jb.Title = blk.Title
+		jb.Timestamp = blk.Timestamp
+		jb.ShowboatVersion = blk.Version
+		jb.DocumentID = blk.DocumentID
+		jb.Metadata = jsonMetadata(blk.Metadata)
+	case markdown.CommentaryBlock:
+		jb.Content = &blk.Text
+		jb.ID = blk.ID
+		jb.Hash = blk.Hash
+	case markdown.CodeBlock:
+		jb.Lang = blk.Lang
+		jb.Content = &blk.Code
+		jb.Image = blk.IsImage
+		jb.Role = blk.Role
+		jb.Needs = blk.NeedsList()
+		jb.ID = blk.ID
+		jb.Hash = blk.Hash
+		if p := blk.Provenance; p != nil {
+			jb.Provenance = &JSONProvenance{
+				Start:       p.Start,
+				Duration:    p.Duration,
+				ExitCode:    p.ExitCode,
+				Host:        p.Host,
+				Dir:         p.Dir,
+				Interpreter: p.Interpreter,
+			}
+		}
+		if s := blk.Service; s != nil {
+			jb.Service = &JSONService{Name: s.Name, Ready: s.Ready}
+		}
+	case markdown.OutputBlock:
+		jb.Content = &blk.Content
+	case markdown.ImageOutputBlock:
+		jb.Alt = blk.AltText
+		jb.Filename = blk.Filename
+	case markdown.SignatureBlock:
+		jb.PublicKey = blk.PublicKey
+		jb.Signature = blk.Signature
+	case markdown.SealBlock:
+		jb.Hash = blk.Hash
+		jb.Timestamp = blk.Timestamp
+	default:
+		return jb, fmt.Errorf("unknown block type: %T", b)
+	}
+	return jb, nil
+}
+
+// ReadJSON parses a JSONDocument and returns its blocks.
+func ReadJSON(r io.Reader) ([]markdown.Block, error) {
+	var doc JSONDocument
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing JSON: %w", err)
+	}
+	if doc.Format != "showboat" {
+		return nil, fmt.Errorf("not a showboat JSON document")
+	}
+	if doc.Version < 1 || doc.Version > JSONVersion {
+		return nil, fmt.Errorf("unsupported JSON document version %d", doc.Version)
+	}
+
+	var blocks []markdown.Block
+	for i, jb := range doc.Blocks {
+		content := ""
+		if jb.Content != nil {
+			content = *jb.Content
+		}
+		switch jb.Type {
+		case "title":
+			blocks = append(blocks, markdown.TitleBlock{
+				Title:      jb.Title,
+				Timestamp:  jb.Timestamp,
+				Version:    jb.ShowboatVersion,
+				DocumentID: jb.DocumentID,
+				Metadata:   jb.Metadata.metadata(),
+			})
+		case "commentary":
+			blocks = append(blocks, markdown.CommentaryBlock{Text: content, ID: jb.ID, Hash: jb.Hash})
+		case "code":
+			cb := markdown.CodeBlock{Lang: jb.Lang, Code: content, IsImage: jb.Image, Role: jb.Role, Needs: strings.Join(jb.Needs, ","), ID: jb.ID, Hash: jb.Hash}
+			if p := jb.Provenance; p != nil {
+				cb.Provenance = &markdown.Provenance{
+					Start:       p.Start,
+					Duration:    p.Duration,
+					ExitCode:    p.ExitCode,
+					Host:        p.Host,
+					Dir:         p.Dir,
+					Interpreter: p.Interpreter,
+				}
+			}
+			if s := jb.Service; s != nil {
+				cb.Service = &markdown.Service{Name: s.Name, Ready: s.Ready}
+			}
+			blocks = append(blocks, cb)
+		case "output":
+			blocks = append(blocks, markdown.OutputBlock{Content: content})
+		case "output-image":
+			blocks = append(blocks, markdown.ImageOutputBlock{AltText: jb.Alt, Filename: jb.Filename})
+		case "signature":
+			blocks = append(blocks, markdown.SignatureBlock{PublicKey: jb.PublicKey, Signature: jb.Signature})
+		case "seal":
+			blocks = append(blocks, markdown.SealBlock{Hash: jb.Hash, Timestamp: jb.Timestamp})
+		default:
+			return nil, fmt.Errorf("block %d: unknown block type %q", i, jb.Type)
+		}
+	}
+	return blocks, nil
+}
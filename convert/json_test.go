@@ -0,0 +1,82 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z by Showboat dev*\n<!-- showboat-id: doc-uuid -->\n\n" +
+		"<!-- showboat-entry id=aaaa1111 hash=sha256:abc -->\nIntro with `code`.\n\n" +
+		"<!-- showboat-entry id=bbbb2222 start=2026-02-06T00:00:01.000Z duration=5ms exit=1 host=box interpreter=\"GNU bash\" hash=sha256:def -->\n```bash\necho \"hi\"\n```\n\n```output\nhi\n\n```\n\n" +
+		"<!-- showboat-entry id=cccc3333 -->\n```bash {image}\nshot.png\n```\n\n![shot](abc-2026-02-06.png)\n\n" +
+		"<!-- showboat-seal hash=sha256:123 at=2026-02-06T00:00:02Z -->\n\n" +
+		"<!-- showboat-signature key=cHVi sig=c2ln -->\n"
+
+	blocks, lines, err := markdown.ParseWithLines(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var js strings.Builder
+	if err := WriteJSON(&js, blocks, lines); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"format": "showboat"`, `"version": 1`, `"type": "code"`, `"line": 9`, `"exit_code": 1`, `"filename": "abc-2026-02-06.png"`} {
+		if !strings.Contains(js.String(), want) {
+			t.Errorf("expected JSON to contain %s, got:\n%s", want, js.String())
+		}
+	}
+
+	got, err := ReadJSON(strings.NewReader(js.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := markdown.Write(&out, got); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, out.String())
+	}
+}
+
+func TestJSONMetadata(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n<!-- showboat-id: doc-uuid -->\n<!-- showboat-meta agent=builder task=PROJ-1 tags=a,b -->\n"
+	blocks, err := markdown.Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var js strings.Builder
+	if err := WriteJSON(&js, blocks, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(js.String(), `"tags": [`) || !strings.Contains(js.String(), `"task": "PROJ-1"`) {
+		t.Errorf("expected metadata in JSON, got:\n%s", js.String())
+	}
+
+	got, err := ReadJSON(strings.NewReader(js.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := markdown.Write(&out, got); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, out.String())
+	}
+}
+
+func TestReadJSONRejectsUnknownVersion(t *testing.T) {
+	for _, doc := range []string{
+		`{"format": "showboat", "version": 99, "blocks": []}`,
+		`{"format": "other", "version": 1, "blocks": []}`,
+		`{"format": "showboat", "version": 1, "blocks": [{"type": "mystery"}]}`,
+	} {
+		if _, err := ReadJSON(strings.NewReader(doc)); err == nil {
+			t.Errorf("expected error for %s", doc)
+		}
+	}
+}
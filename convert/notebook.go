@@ -0,0 +1,453 @@
+package convert
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// The notebook types cover the parts of the nbformat 4 schema that showboat
+// reads and writes. Cells use nbformat 4.5 so that entry IDs can be carried
+// over as cell IDs.
+
+type notebook struct {
+	Cells         []cell           `json:"cells"`
+	Metadata      notebookMetadata `json:"metadata"`
+	NBFormat      int              `json:"nbformat"`
+	NBFormatMinor int              `json:"nbformat_minor"`
+}
+
+type notebookMetadata struct {
+	KernelSpec   *kernelSpec   `json:"kernelspec,omitempty"`
+	LanguageInfo *languageInfo `json:"language_info,omitempty"`
+	Showboat     *titleMeta    `json:"showboat,omitempty"`
+}
+
+type kernelSpec struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	Language    string `json:"language"`
+}
+
+type languageInfo struct {
+	Name string `json:"name"`
+}
+
+// titleMeta holds the title block so that it survives a round trip.
+type titleMeta struct {
+	Title      string `json:"title"`
+	Timestamp  string `json:"timestamp,omitempty"`
+	Version    string `json:"version,omitempty"`
+	DocumentID string `json:"document_id,omitempty"`
+
+	Metadata *JSONMetadata `json:"metadata,omitempty"`
+}
+
+type cell struct {
+	ID             string          `json:"id,omitempty"`
+	CellType       string          `json:"cell_type"`
+	Metadata       cellMetadata    `json:"metadata"`
+	Source         multiline       `json:"source"`
+	ExecutionCount json.RawMessage `json:"execution_count,omitempty"`
+	Outputs        *[]outputRecord `json:"outputs,omitempty"`
+}
+
+type cellMetadata struct {
+	Jupyter  *cellJupyter  `json:"jupyter,omitempty"`
+	Showboat *cellShowboat `json:"showboat,omitempty"`
+}
+
+// cellJupyter holds the cell display options of JupyterLab.
+type cellJupyter struct {
+	SourceHidden  bool `json:"source_hidden,omitempty"`
+	OutputsHidden bool `json:"outputs_hidden,omitempty"`
+}
+
+// cellShowboat marks code cells that came from showboat image entries or
+// from code blocks with a role, such as setup blocks, or with dependencies.
+type cellShowboat struct {
+	Image   bool         `json:"image,omitempty"`
+	Role    string       `json:"role,omitempty"`
+	Needs   []string     `json:"needs,omitempty"`
+	Service *JSONService `json:"service,omitempty"`
+}
+
+type outputRecord struct {
+	OutputType string               `json:"output_type"`
+	Name       string               `json:"name,omitempty"`
+	Text       *multiline           `json:"text,omitempty"`
+	Data       map[string]multiline `json:"data,omitempty"`
+	Metadata   *struct{}            `json:"metadata,omitempty"`
+	EName      string               `json:"ename,omitempty"`
+	EValue     string               `json:"evalue,omitempty"`
+	Traceback  []string             `json:"traceback,omitempty"`
+}
+
+// multiline is notebook text, stored either as one string or as a list of
+// lines that are concatenated. It is always written as a list.
+type multiline string
+
+func (m multiline) MarshalJSON() ([]byte, error) {
+	lines := []string{}
+	s := string(m)
+	for s != "" {
+		n := strings.IndexByte(s, '\n') + 1
+		if n == 0 {
+			n = len(s)
+		}
+		lines = append(lines, s[:n])
+		s = s[n:]
+	}
+	return json.Marshal(lines)
+}
+
+func (m *multiline) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*m = multiline(s)
+		return nil
+	}
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*m = multiline(strings.Join(lines, ""))
+	return nil
+}
+
+// kernels maps fence languages to the Jupyter kernel that runs them.
+var kernels = map[string]kernelSpec{
+	"python":  {Name: "python3", DisplayName: "Python 3", Language: "python"},
+	"python3": {Name: "python3", DisplayName: "Python 3", Language: "python"},
+	"bash":    {Name: "bash", DisplayName: "Bash", Language: "bash"},
+	"sh":      {Name: "bash", DisplayName: "Bash", Language: "bash"},
+	"node":    {Name: "javascript", DisplayName: "JavaScript (Node.js)", Language: "javascript"},
+	"Rscript": {Name: "ir", DisplayName: "R", Language: "R"},
+}
+
+// fenceLangs maps kernel languages to the command showboat runs them with.
+var fenceLangs = map[string]string{
+	"python":     "python3",
+	"javascript": "node",
+	"R":          "Rscript",
+}
+
+// kernelFor picks the kernel for a notebook from the language used by most
+// code blocks.
+func kernelFor(blocks []markdown.Block) kernelSpec {
+	counts := make(map[string]int)
+	best := ""
+	for _, b := range blocks {
+		if cb, ok := b.(markdown.CodeBlock); ok && !cb.IsImage {
+			counts[cb.Lang]++
+			if counts[cb.Lang] > counts[best] {
+				best = cb.Lang
+			}
+		}
+	}
+	if best == "" {
+		best = "bash"
+	}
+	if k, ok := kernels[best]; ok {
+		return k
+	}
+	return kernelSpec{Name: best, DisplayName: best, Language: best}
+}
+
+// fenceLang returns the fence language for a kernel language.
+func fenceLang(kernelLang string) string {
+	if lang, ok := fenceLangs[kernelLang]; ok {
+		return lang
+	}
+	return kernelLang
+}
+
+// NotebookOptions controls WriteNotebook.
+type NotebookOptions struct {
+	// BaseDir is the directory that image filenames are relative to.
+	BaseDir string
+
+	// Fixtures controls how setup and teardown entries are shown. Collapsed
+	// cells have their source and outputs hidden.
+	Fixtures Fixtures
+}
+
+// WriteNotebook writes blocks as a Jupyter notebook. Commentary becomes
+// markdown cells and each code entry a code cell with its output as a stdout
+// stream. Images become display_data outputs. The kernel is chosen from the
+// most common code language; cells in any other language start with a
+// %%<lang> cell magic.
+func WriteNotebook(w io.Writer, blocks []markdown.Block, opts NotebookOptions) error {
+	kernel := kernelFor(blocks)
+	nb := notebook{
+		Cells: []cell{},
+		Metadata: notebookMetadata{
+			KernelSpec:   &kernel,
+			LanguageInfo: &languageInfo{Name: kernel.Language},
+		},
+		NBFormat:      4,
+		NBFormatMinor: 5,
+	}
+
+	for _, b := range blocks {
+		if tb, ok := b.(markdown.TitleBlock); ok {
+			nb.Metadata.Showboat = &titleMeta{
+				Title:      tb.Title,
+				Timestamp:  tb.Timestamp,
+				Version:    tb.Version,
+				DocumentID: tb.DocumentID,
+				Metadata:   jsonMetadata(tb.Metadata),
+			}
+			nb.Cells = append(nb.Cells, cell{CellType: "markdown", Source: multiline("# " + tb.Title)})
+		}
+	}
+
+	for _, e := range markdown.Entries(blocks) {
+		switch first := e.Blocks[0].(type) {
+		case markdown.CommentaryBlock:
+			nb.Cells = append(nb.Cells, cell{ID: first.ID, CellType: "markdown", Source: multiline(first.Text)})
+		case markdown.CodeBlock:
+			if first.IsFixture() && opts.Fixtures == FixturesHide {
+				continue
+			}
+			source := first.Code
+			if fenceLang(kernel.Language) != first.Lang && kernel.Name != kernels[first.Lang].Name {
+				source = "%%" + first.Lang + "\n" + source
+			}
+			c := cell{
+				ID:             first.ID,
+				CellType:       "code",
+				Source:         multiline(source),
+				ExecutionCount: json.RawMessage("null"),
+				Outputs:        &[]outputRecord{},
+			}
+			if first.IsImage || first.Role != "" || first.Needs != "" {
+				c.Metadata.Showboat = &cellShowboat{Image: first.IsImage, Role: first.Role, Needs: first.NeedsList()}
+				if s := first.Service; s != nil {
+					c.Metadata.Showboat.Service = &JSONService{Name: s.Name, Ready: s.Ready}
+				}
+			}
+			if first.IsFixture() && opts.Fixtures == FixturesCollapse {
+				c.Metadata.Jupyter = &cellJupyter{SourceHidden: true, OutputsHidden: true}
+			}
+			for _, b := range e.Blocks[1:] {
+				out, err := notebookOutput(b, opts.BaseDir)
+				if err != nil {
+					return err
+				}
+				if out != nil {
+					*c.Outputs = append(*c.Outputs, *out)
+				}
+			}
+			nb.Cells = append(nb.Cells, c)
+		}
+	}
+
+	// Cell IDs are required in nbformat 4.5; give entries without one an ID
+	// based on their position.
+	for i := range nb.Cells {
+		if nb.Cells[i].ID == "" {
+			nb.Cells[i].ID = fmt.Sprintf("cell-%d", i)
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	return enc.Encode(nb)
+}
+
+// notebookOutput converts an output block to a notebook output. It returns
+// nil for empty text output.
+func notebookOutput(b markdown.Block, baseDir string) (*outputRecord, error) {
+	switch blk := b.(type) {
+	case markdown.OutputBlock:
+		if blk.Content == "" {
+			return nil, nil
+		}
+		text := multiline(blk.Content)
+		return &outputRecord{OutputType: "stream", Name: "stdout", Text: &text}, nil
+	case markdown.ImageOutputBlock:
+		uri, err := dataURI(filepath.Join(baseDir, blk.Filename))
+		if err != nil {
+			return nil, fmt.Errorf("embedding %s: %w", blk.Filename, err)
+		}
+		mime, data, _ := strings.Cut(strings.TrimPrefix(uri, "data:"), ";base64,")
+		if mime == "image/svg+xml" {
+			// SVG is stored as text rather than base64.
+			raw, _ := base64.StdEncoding.DecodeString(data)
+			data = string(raw)
+		}
+		return &outputRecord{
+			OutputType: "display_data",
+			Data:       map[string]multiline{mime: multiline(data), "text/plain": multiline(blk.AltText)},
+			Metadata:   &struct{}{},
+		}, nil
+	}
+	return nil, nil
+}
+
+// imageExts maps notebook image MIME types to file extensions.
+var imageExts = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/svg+xml": ".svg",
+}
+
+// entryIDRe matches cell IDs that can be kept as entry IDs.
+var entryIDRe = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// cellMagicRe matches a cell magic naming the language of a cell.
+var cellMagicRe = regexp.MustCompile(`^%%([A-Za-z][A-Za-z0-9_+.-]*)[ \t]*\n`)
+
+// ReadNotebook parses a Jupyter notebook into showboat blocks. The first
+// block is always a TitleBlock, whose fields are empty when the notebook was
+// not exported by showboat and has no leading "# " heading cell. Code cells
+// become code entries with their text outputs joined into one OutputBlock;
+// every image output becomes an image entry of its own, and saveImage is
+// called to store its bytes and return the filename to reference. Cells whose
+// IDs look like showboat entry IDs keep them; other entries have no ID.
+func ReadNotebook(r io.Reader, saveImage func(ext string, data []byte) (string, error)) ([]markdown.Block, error) {
+	var nb notebook
+	if err := json.NewDecoder(r).Decode(&nb); err != nil {
+		return nil, fmt.Errorf("parsing notebook: %w", err)
+	}
+	if nb.NBFormat != 4 {
+		return nil, fmt.Errorf("unsupported notebook format version %d", nb.NBFormat)
+	}
+
+	lang := "python3"
+	if nb.Metadata.LanguageInfo != nil && nb.Metadata.LanguageInfo.Name != "" {
+		lang = fenceLang(nb.Metadata.LanguageInfo.Name)
+	} else if nb.Metadata.KernelSpec != nil && nb.Metadata.KernelSpec.Language != "" {
+		lang = fenceLang(nb.Metadata.KernelSpec.Language)
+	}
+
+	title := markdown.TitleBlock{}
+	cells := nb.Cells
+	if m := nb.Metadata.Showboat; m != nil {
+		title = markdown.TitleBlock{Title: m.Title, Timestamp: m.Timestamp, Version: m.Version, DocumentID: m.DocumentID, Metadata: m.Metadata.metadata()}
+	}
+	if len(cells) > 0 && cells[0].CellType == "markdown" {
+		heading := strings.TrimSpace(string(cells[0].Source))
+		if strings.HasPrefix(heading, "# ") && !strings.Contains(heading, "\n") &&
+			(title.Title == "" || title.Title == heading[2:]) {
+			title.Title = heading[2:]
+			cells = cells[1:]
+		}
+	}
+	blocks := []markdown.Block{title}
+
+	seen := make(map[string]bool)
+	cellID := func(c cell) string {
+		if !entryIDRe.MatchString(c.ID) || seen[c.ID] {
+			return ""
+		}
+		seen[c.ID] = true
+		return c.ID
+	}
+
+	for _, c := range cells {
+		source := strings.TrimRight(string(c.Source), "\n")
+		switch c.CellType {
+		case "markdown", "raw":
+			if strings.TrimSpace(source) == "" {
+				continue
+			}
+			blocks = append(blocks, markdown.CommentaryBlock{Text: source, ID: cellID(c)})
+		case "code":
+			cellLang := lang
+			if m := cellMagicRe.FindStringSubmatch(source + "\n"); m != nil {
+				cellLang = m[1]
+				source = strings.TrimRight(strings.TrimPrefix(source+"\n", m[0]), "\n")
+			}
+
+			var text strings.Builder
+			var images []markdown.ImageOutputBlock
+			var outputs []outputRecord
+			if c.Outputs != nil {
+				outputs = *c.Outputs
+			}
+			for _, out := range outputs {
+				switch out.OutputType {
+				case "stream":
+					if out.Text != nil {
+						text.WriteString(string(*out.Text))
+					}
+				case "execute_result", "display_data":
+					img, ok, err := readImageOutput(out, saveImage)
+					if err != nil {
+						return nil, err
+					}
+					if ok {
+						images = append(images, img)
+					} else if plain, ok := out.Data["text/plain"]; ok {
+						text.WriteString(strings.TrimSuffix(string(plain), "\n") + "\n")
+					}
+				case "error":
+					fmt.Fprintf(&text, "%s: %s\n", out.EName, out.EValue)
+				}
+			}
+
+			isImage := c.Metadata.Showboat != nil && c.Metadata.Showboat.Image
+			if isImage && len(images) > 0 {
+				// A showboat image entry: keep its original code.
+				blocks = append(blocks, markdown.CodeBlock{Lang: cellLang, Code: source, IsImage: true, ID: cellID(c)}, images[0])
+				images = images[1:]
+			} else {
+				cb := markdown.CodeBlock{Lang: cellLang, Code: source, ID: cellID(c)}
+				if m := c.Metadata.Showboat; m != nil {
+					cb.Role = m.Role
+					cb.Needs = strings.Join(m.Needs, ",")
+					if m.Service != nil {
+						cb.Service = &markdown.Service{Name: m.Service.Name, Ready: m.Service.Ready}
+					}
+				}
+				blocks = append(blocks,
+					cb,
+					markdown.OutputBlock{Content: text.String()},
+				)
+			}
+			for _, img := range images {
+				code := fmt.Sprintf("![%s](%s)", img.AltText, img.Filename)
+				blocks = append(blocks, markdown.CodeBlock{Lang: "bash", Code: code, IsImage: true}, img)
+			}
+		}
+	}
+	return blocks, nil
+}
+
+// readImageOutput saves the first image in a display output and returns the
+// block referencing it. ok is false if the output has no image.
+func readImageOutput(out outputRecord, saveImage func(ext string, data []byte) (string, error)) (img markdown.ImageOutputBlock, ok bool, err error) {
+	for _, mime := range []string{"image/png", "image/jpeg", "image/gif", "image/svg+xml"} {
+		content, ok := out.Data[mime]
+		if !ok {
+			continue
+		}
+		data := []byte(content)
+		if mime != "image/svg+xml" {
+			data, err = base64.StdEncoding.DecodeString(strings.ReplaceAll(string(content), "\n", ""))
+			if err != nil {
+				return img, false, fmt.Errorf("decoding %s output: %w", mime, err)
+			}
+		}
+		filename, err := saveImage(imageExts[mime], data)
+		if err != nil {
+			return img, false, err
+		}
+		alt := strings.TrimSpace(string(out.Data["text/plain"]))
+		if alt == "" || strings.ContainsAny(alt, "[]<>\n") {
+			alt = strings.TrimSuffix(filename, filepath.Ext(filename))
+		}
+		return markdown.ImageOutputBlock{AltText: alt, Filename: filename}, true, nil
+	}
+	return img, false, nil
+}
@@ -0,0 +1,146 @@
+package convert
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestWriteNotebook(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "plot.png"), []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	blocks := []markdown.Block{
+		markdown.TitleBlock{Title: "Notebook", Timestamp: "2026-02-06T15:30:00Z", DocumentID: "doc-1"},
+		markdown.CommentaryBlock{Text: "Intro", ID: "aaaa1111"},
+		markdown.CodeBlock{Lang: "python3", Code: "print(1)\nprint(2)", ID: "bbbb2222"},
+		markdown.OutputBlock{Content: "1\n2\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo hi"},
+		markdown.OutputBlock{Content: "hi\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "plot.png", IsImage: true},
+		markdown.ImageOutputBlock{AltText: "plot", Filename: "plot.png"},
+	}
+
+	var buf strings.Builder
+	if err := WriteNotebook(&buf, blocks, NotebookOptions{BaseDir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	var nb notebook
+	if err := json.Unmarshal([]byte(buf.String()), &nb); err != nil {
+		t.Fatal(err)
+	}
+	if nb.NBFormat != 4 || nb.Metadata.KernelSpec.Name != "python3" {
+		t.Errorf("expected nbformat 4 with python3 kernel, got %d %+v", nb.NBFormat, nb.Metadata.KernelSpec)
+	}
+	if len(nb.Cells) != 5 {
+		t.Fatalf("expected 5 cells, got %d", len(nb.Cells))
+	}
+	if nb.Cells[1].ID != "aaaa1111" || nb.Cells[1].CellType != "markdown" {
+		t.Errorf("expected commentary cell with entry ID, got %+v", nb.Cells[1])
+	}
+	code := nb.Cells[2]
+	if code.Source != "print(1)\nprint(2)" || (*code.Outputs)[0].Name != "stdout" || string(*(*code.Outputs)[0].Text) != "1\n2\n" {
+		t.Errorf("unexpected python cell: %+v", code)
+	}
+	if !strings.HasPrefix(string(nb.Cells[3].Source), "%%bash\n") {
+		t.Errorf("expected bash cell magic, got %q", nb.Cells[3].Source)
+	}
+	img := (*nb.Cells[4].Outputs)[0]
+	if img.OutputType != "display_data" || img.Data["image/png"] != "cG5n" {
+		t.Errorf("expected PNG display_data, got %+v", img)
+	}
+	if !strings.Contains(buf.String(), `"execution_count": null`) {
+		t.Error("expected code cells to have a null execution count")
+	}
+}
+
+func TestReadNotebook(t *testing.T) {
+	// A notebook as Jupyter writes it: source as one string, an expression
+	// result, an error and an inline image.
+	src := `{
+ "nbformat": 4, "nbformat_minor": 4,
+ "metadata": {"kernelspec": {"name": "python3", "display_name": "Python 3", "language": "python"},
+              "language_info": {"name": "python"}},
+ "cells": [
+  {"cell_type": "markdown", "metadata": {}, "source": "# Analysis"},
+  {"cell_type": "markdown", "metadata": {}, "source": ["Some ", "notes\n"]},
+  {"cell_type": "code", "metadata": {}, "execution_count": 1, "source": "x = 2\nx * 3",
+   "outputs": [{"output_type": "execute_result", "execution_count": 1, "metadata": {}, "data": {"text/plain": "6"}}]},
+  {"cell_type": "code", "metadata": {}, "execution_count": 2, "source": "%%bash\necho hi\n",
+   "outputs": [{"output_type": "stream", "name": "stdout", "text": "hi\n"}]},
+  {"cell_type": "code", "metadata": {}, "execution_count": 3, "source": "plot()",
+   "outputs": [{"output_type": "display_data", "metadata": {}, "data": {"image/png": "cG5n\n", "text/plain": "<Figure>"}},
+               {"output_type": "error", "ename": "ValueError", "evalue": "bad", "traceback": []}]}
+ ]
+}`
+	var saved []string
+	save := func(ext string, data []byte) (string, error) {
+		saved = append(saved, string(data))
+		return "img" + ext, nil
+	}
+
+	blocks, err := ReadNotebook(strings.NewReader(src), save)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []markdown.Block{
+		markdown.TitleBlock{Title: "Analysis"},
+		markdown.CommentaryBlock{Text: "Some notes"},
+		markdown.CodeBlock{Lang: "python3", Code: "x = 2\nx * 3"},
+		markdown.OutputBlock{Content: "6\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo hi"},
+		markdown.OutputBlock{Content: "hi\n"},
+		markdown.CodeBlock{Lang: "python3", Code: "plot()"},
+		markdown.OutputBlock{Content: "ValueError: bad\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "![img](img.png)", IsImage: true},
+		markdown.ImageOutputBlock{AltText: "img", Filename: "img.png"},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("expected %d blocks, got %d: %+v", len(want), len(blocks), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d: expected %+v, got %+v", i, want[i], blocks[i])
+		}
+	}
+	if len(saved) != 1 || saved[0] != "png" {
+		t.Errorf("expected one decoded PNG, got %q", saved)
+	}
+}
+
+func TestNotebookRoundTrip(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.TitleBlock{Title: "Round trip", Timestamp: "2026-02-06T15:30:00Z", Version: "dev", DocumentID: "doc-1"},
+		markdown.CommentaryBlock{Text: "Intro\n\n- a\n- b", ID: "aaaa1111"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo hi", Role: markdown.RoleSetup, ID: "bbbb2222"},
+		markdown.OutputBlock{Content: "hi\n"},
+		markdown.CodeBlock{Lang: "python3", Code: "print(1)", ID: "cccc3333"},
+		markdown.OutputBlock{Content: ""},
+	}
+
+	var buf strings.Builder
+	if err := WriteNotebook(&buf, blocks, NotebookOptions{Fixtures: FixturesCollapse}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"source_hidden": true`) {
+		t.Errorf("expected the setup cell to be collapsed, got:\n%s", buf.String())
+	}
+	got, err := ReadNotebook(strings.NewReader(buf.String()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(blocks) {
+		t.Fatalf("expected %d blocks, got %d: %+v", len(blocks), len(got), got)
+	}
+	for i := range blocks {
+		if got[i] != blocks[i] {
+			t.Errorf("block %d: expected %+v, got %+v", i, blocks[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+var (
+	// promptRe matches a shell prompt followed by a command: "$ cmd",
+	// "% cmd", "user@host:~/dir$ cmd", "[user@host dir]$ cmd" or the root
+	// equivalents ending in "#". A bare "# " is not a prompt, since it is
+	// more often a markdown heading.
+	promptRe = regexp.MustCompile(`^(?:[$%]|(?:\[[^\]]*@[^\]]*\]|[\w.-]+@[\w.-]+(?::[^\s$#]*)?)\s?[$#%])\s+(.*)$`)
+
+	// ansiRe matches terminal escape sequences, as found in script(1) logs.
+	ansiRe = regexp.MustCompile(`\x1b(?:\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[()][0-9A-Za-z])`)
+
+	// scriptHeaderRe matches the lines script(1) writes around a session.
+	scriptHeaderRe = regexp.MustCompile(`^Script (?:started|done) on `)
+)
+
+// ReadTranscript parses a terminal transcript into showboat blocks, all
+// without entry IDs or hashes. The first block is a TitleBlock, whose title
+// is empty unless the transcript starts with a "# " heading.
+//
+// Lines starting with a shell prompt are commands, and "> " lines directly
+// after a command continue it. A command's output runs until the next
+// prompt or the first run of two or more blank lines. Any other text becomes
+// commentary. Terminal escape sequences, carriage returns and the header and
+// footer lines written by script(1) are removed.
+func ReadTranscript(r io.Reader) ([]markdown.Block, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := ansiRe.ReplaceAllString(scanner.Text(), "")
+		line = line[strings.LastIndexByte(line, '\r')+1:]
+		if scriptHeaderRe.MatchString(line) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	blocks := []markdown.Block{markdown.TitleBlock{}}
+	var prose []string
+	flushProse := func() {
+		text := strings.Trim(strings.Join(prose, "\n"), "\n")
+		prose = nil
+		if text == "" {
+			return
+		}
+		if len(blocks) == 1 && strings.HasPrefix(text, "# ") && blocks[0].(markdown.TitleBlock).Title == "" {
+			heading, rest, _ := strings.Cut(text, "\n")
+			blocks[0] = markdown.TitleBlock{Title: strings.TrimSpace(heading[2:])}
+			text = strings.Trim(rest, "\n")
+			if text == "" {
+				return
+			}
+		}
+		blocks = append(blocks, markdown.CommentaryBlock{Text: text})
+	}
+
+	for i := 0; i < len(lines); {
+		m := promptRe.FindStringSubmatch(lines[i])
+		if m == nil {
+			prose = append(prose, lines[i])
+			i++
+			continue
+		}
+		flushProse()
+
+		code := []string{m[1]}
+		i++
+		for i < len(lines) && strings.HasPrefix(lines[i], "> ") {
+			code = append(code, lines[i][2:])
+			i++
+		}
+
+		var output []string
+		for i < len(lines) && !promptRe.MatchString(lines[i]) {
+			if lines[i] == "" && i+1 < len(lines) && lines[i+1] == "" {
+				break
+			}
+			output = append(output, lines[i])
+			i++
+		}
+		for len(output) > 0 && output[len(output)-1] == "" {
+			output = output[:len(output)-1]
+		}
+		content := ""
+		if len(output) > 0 {
+			content = strings.Join(output, "\n") + "\n"
+		}
+
+		command := strings.Join(code, "\n")
+		if command == "" {
+			// An empty prompt, such as the last line of a session.
+			continue
+		}
+		blocks = append(blocks,
+			markdown.CodeBlock{Lang: "bash", Code: command},
+			markdown.OutputBlock{Content: content},
+		)
+	}
+	flushProse()
+	return blocks, nil
+}
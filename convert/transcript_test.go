@@ -0,0 +1,59 @@
+package convert
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+func TestReadTranscript(t *testing.T) {
+	input := "Script started on 2026-02-06 10:00:00+00:00 [TERM=\"xterm\"]\n" +
+		"# Setting up\n\nFirst look around.\n\n" +
+		"\x1b]0;me@box: ~\x07\x1b[01;32mme@box\x1b[00m:\x1b[01;34m~/src\x1b[00m$ ls\r\n" +
+		"a.txt  b.txt\r\n" +
+		"$ for f in a b; do\n> echo $f\n> done\n" +
+		"a\n\nb\n" +
+		"\n\nThat worked.\n" +
+		"# grep missing a.txt\n" +
+		"me@box:~$ \n" +
+		"Script done on 2026-02-06 10:01:00+00:00 [COMMAND_EXIT_CODE=\"0\"]\n"
+
+	blocks, err := ReadTranscript(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []markdown.Block{
+		markdown.TitleBlock{Title: "Setting up"},
+		markdown.CommentaryBlock{Text: "First look around."},
+		markdown.CodeBlock{Lang: "bash", Code: "ls"},
+		markdown.OutputBlock{Content: "a.txt  b.txt\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "for f in a b; do\necho $f\ndone"},
+		markdown.OutputBlock{Content: "a\n\nb\n"},
+		markdown.CommentaryBlock{Text: "That worked.\n# grep missing a.txt"},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("expected %d blocks, got %d: %#v", len(want), len(blocks), blocks)
+	}
+	for i := range want {
+		if blocks[i] != want[i] {
+			t.Errorf("block %d: expected %#v, got %#v", i, want[i], blocks[i])
+		}
+	}
+}
+
+func TestReadTranscriptWithoutTitle(t *testing.T) {
+	blocks, err := ReadTranscript(strings.NewReader("$ true\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected title, code and output blocks, got %#v", blocks)
+	}
+	if tb := blocks[0].(markdown.TitleBlock); tb.Title != "" {
+		t.Errorf("expected empty title, got %q", tb.Title)
+	}
+	if ob := blocks[2].(markdown.OutputBlock); ob.Content != "" {
+		t.Errorf("expected empty output, got %q", ob.Content)
+	}
+}
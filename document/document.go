@@ -0,0 +1,469 @@
+// Package document builds and verifies showboat documents from Go without
+// shelling out to the showboat command.
+//
+// A Document holds its blocks in memory. Methods that add or remove entries
+// change only the in-memory copy; Save writes it back to the file it was
+// opened from, and WriteTo writes the markdown anywhere else:
+//
+//	doc, err := document.Create(ctx, "demo.md", "My demo", document.Options{})
+//	if err != nil { ... }
+//	doc.AppendNote(ctx, "Check the tests pass.")
+//	res, err := doc.Exec(ctx, "bash", "go test ./...", document.EntryOptions{})
+//	if err != nil { ... }
+//	err = doc.Save()
+//
+// Code runs through an Executor, timestamps come from a clock and every
+// saved change is reported to a Sink, all of which can be replaced through
+// Options. A Document is not safe for concurrent use.
+package document
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// Executor runs a code block and returns its combined stdout and stderr
+// and its exit code. A non-zero exit code is not an error.
+type Executor interface {
+	Run(ctx context.Context, lang, code, workdir string) (output string, exitCode int, err error)
+}
+
+// ExecutorFunc adapts a function to the Executor interface.
+type ExecutorFunc func(ctx context.Context, lang, code, workdir string) (string, int, error)
+
+// Run calls f.
+func (f ExecutorFunc) Run(ctx context.Context, lang, code, workdir string) (string, int, error) {
+	return f(ctx, lang, code, workdir)
+}
+
+// DefaultExecutor runs code as "<lang> -c <code>", like the showboat
+// command.
+var DefaultExecutor Executor = ExecutorFunc(execpkg.RunContext)
+
+// Event describes a change to a document. Command is "init", "note",
+// "exec", "image", "pop" or "meta". Blocks holds the blocks that were added
+// and is empty for "pop", where EntryID identifies the entry that was
+// removed. For "meta" it holds the title block with the new metadata.
+// ImagePath is the copied image file for "image" events.
+type Event struct {
+	DocumentID string
+	Command    string
+	EntryID    string
+	Blocks     []markdown.Block
+	ImagePath  string
+}
+
+// Sink receives an Event for every change made to a document, such as to
+// stream it to a remote viewer. Events are held until Save has written the
+// change, so a sink never sees one that failed to save, and a document that
+// is never saved sends none. Sinks handle their own errors; a change is
+// never undone because a sink failed.
+type Sink interface {
+	Send(ctx context.Context, e Event)
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, e Event)
+
+// Send calls f.
+func (f SinkFunc) Send(ctx context.Context, e Event) { f(ctx, e) }
+
+// Options configures a Document. The zero value runs code with
+// DefaultExecutor, uses the system clock and discards events.
+type Options struct {
+	Executor Executor
+	Now      func() time.Time
+	Sink     Sink
+
+	// Version is the showboat version recorded in the title by Create.
+	Version string
+
+	// Metadata is recorded in the title by Create.
+	Metadata markdown.Metadata
+
+	// Workdir is the directory code runs in when EntryOptions and
+	// VerifyOptions do not name one. Empty means the current directory.
+	Workdir string
+
+	// Region is the ID of a showboat region of a larger markdown file for
+	// Open to work on, instead of the whole file. Save rewrites only that
+	// region. See markdown.ParseRegion.
+	Region string
+}
+
+func (o Options) executor() Executor {
+	if o.Executor == nil {
+		return DefaultExecutor
+	}
+	return o.Executor
+}
+
+func (o Options) now() time.Time {
+	if o.Now == nil {
+		return time.Now()
+	}
+	return o.Now()
+}
+
+// ErrSealed is returned when changing a document that has been sealed.
+var ErrSealed = errors.New("document is sealed")
+
+// Document is a showboat document held in memory.
+type Document struct {
+	path   string
+	blocks []markdown.Block
+	opts   Options
+
+	// disk describes the file as last read or written; it is nil if the
+	// file has not been written yet.
+	disk *fileState
+
+	// pending holds the events for changes not yet saved.
+	pending []pendingEvent
+}
+
+// pendingEvent is an event held until Save, with the context of the change
+// that caused it.
+type pendingEvent struct {
+	ctx context.Context
+	e   Event
+}
+
+// fileState records what a document's file held when it was last read or
+// written, so that Save can tell whether someone else has changed it since
+// and whether new entries can simply be appended to it.
+type fileState struct {
+	blocks []markdown.Block
+	size   int64
+	tail   []byte // the file's last bytes, up to tailSize
+
+	// kept is how many leading blocks of the document are still those in
+	// the file. It is less than len(blocks) after a pop.
+	kept int
+}
+
+// tailSize is how many bytes at the end of the file are compared before
+// appending to it.
+const tailSize = 1024
+
+func newFileState(blocks []markdown.Block, data []byte) *fileState {
+	tail := data[max(0, len(data)-tailSize):]
+	return &fileState{
+		blocks: blocks,
+		size:   int64(len(data)),
+		tail:   append([]byte{}, tail...),
+		kept:   len(blocks),
+	}
+}
+
+// Create returns a new document with a title block. It fails if a file
+// already exists at path. Nothing is written until Save. path may be empty
+// for a document that is only written with WriteTo; images are then copied
+// to the current directory.
+func Create(ctx context.Context, path, title string, opts Options) (*Document, error) {
+	if opts.Region != "" {
+		return nil, fmt.Errorf("regions are created by adding their markers to a file")
+	}
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return nil, fmt.Errorf("file already exists: %s", path)
+		}
+	}
+	d := &Document{
+		path: path,
+		opts: opts,
+		blocks: []markdown.Block{markdown.TitleBlock{
+			Title:      title,
+			Timestamp:  opts.now().UTC().Format(time.RFC3339),
+			Version:    opts.Version,
+			DocumentID: uuid.New().String(),
+			Metadata:   opts.Metadata,
+		}},
+	}
+	d.send(ctx, Event{Command: "init", Blocks: d.Blocks()})
+	return d, nil
+}
+
+// Open reads the document at path, or the region of it named by
+// opts.Region.
+func Open(path string, opts Options) (*Document, error) {
+	data, err := lockedfile.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening file: %w", err)
+	}
+	blocks, err := parseDocument(data, opts.Region)
+	if err != nil {
+		return nil, err
+	}
+	return &Document{path: path, blocks: blocks, opts: opts, disk: newFileState(blocks, data)}, nil
+}
+
+// parseDocument parses a whole file, or one region of it.
+func parseDocument(data []byte, region string) ([]markdown.Block, error) {
+	if region != "" {
+		return markdown.ParseRegion(data, region)
+	}
+	blocks, err := markdown.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing file: %w", err)
+	}
+	return blocks, nil
+}
+
+// Path returns the file the document is saved to.
+func (d *Document) Path() string { return d.path }
+
+// Region returns the ID of the region the document was opened from, or ""
+// for a whole file.
+func (d *Document) Region() string { return d.opts.Region }
+
+// Blocks returns a copy of the document's blocks.
+func (d *Document) Blocks() []markdown.Block {
+	return append([]markdown.Block{}, d.blocks...)
+}
+
+// ID returns the document ID from the title block, or "" if it has none.
+func (d *Document) ID() string {
+	if len(d.blocks) > 0 {
+		if tb, ok := d.blocks[0].(markdown.TitleBlock); ok {
+			return tb.DocumentID
+		}
+	}
+	return ""
+}
+
+// Metadata returns the document's metadata from the title block.
+func (d *Document) Metadata() markdown.Metadata {
+	if len(d.blocks) > 0 {
+		if tb, ok := d.blocks[0].(markdown.TitleBlock); ok {
+			return tb.Metadata
+		}
+	}
+	return markdown.Metadata{}
+}
+
+// SetMetadata sets one metadata field, such as "author" or "tags"; see
+// markdown.MetadataKeys. An empty value clears it. The document must have a
+// title block to hold it. As the hash chain covers the title block, every
+// entry is chained again.
+func (d *Document) SetMetadata(ctx context.Context, key, value string) error {
+	if err := d.ensureUnsealed(); err != nil {
+		return err
+	}
+	if len(d.blocks) == 0 {
+		return fmt.Errorf("document has no title block to hold metadata")
+	}
+	tb, ok := d.blocks[0].(markdown.TitleBlock)
+	if !ok {
+		return fmt.Errorf("document has no title block to hold metadata")
+	}
+	if err := tb.Metadata.Set(key, value); err != nil {
+		return err
+	}
+	d.blocks = markdown.Rechain(append([]markdown.Block{tb}, d.blocks[1:]...))
+	d.rewriteFrom(0)
+	d.send(ctx, Event{Command: "meta", Blocks: []markdown.Block{tb}})
+	return nil
+}
+
+// Sealed reports whether the document has been sealed.
+func (d *Document) Sealed() bool {
+	return SealIndex(d.blocks) != -1
+}
+
+// WriteTo writes the document's markdown to w.
+func (d *Document) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	err := markdown.Write(cw, d.blocks)
+	return cw.n, err
+}
+
+// Save writes the document to its file. It fails rather than overwrite
+// changes made to the file by someone else since it was opened or last
+// saved, and for a document from Create, if the file already exists. For a
+// region, changes outside the region are kept.
+//
+// When entries have only been added since the file was read, and the file
+// still has the length and ending it had then, Save appends the new entries
+// and leaves the rest of the file as it is, hand formatting included. A
+// crash while appending leaves the old document, as lockedfile.Append is
+// undone by the next lockedfile.Lock and ignored by readers until then.
+// Otherwise, as after a pop, the file is replaced atomically, so a crash
+// leaves either the old or the new document.
+//
+// Once the file is written, Save sends the events for the changes it holds
+// to the Sink.
+//
+// Save does not lock the file; the showboat command holds an advisory lock
+// from Open to Save so that concurrent commands take turns.
+func (d *Document) Save() error {
+	if err := d.save(); err != nil {
+		return err
+	}
+	pending := d.pending
+	d.pending = nil
+	for _, p := range pending {
+		d.opts.Sink.Send(p.ctx, p.e)
+	}
+	return nil
+}
+
+func (d *Document) save() error {
+	if d.path == "" {
+		return fmt.Errorf("document has no file path")
+	}
+	if d.opts.Region != "" {
+		return d.saveRegion()
+	}
+	if d.disk != nil && d.disk.kept == len(d.disk.blocks) {
+		// If the file has changed, fall through to check whether it still
+		// holds the same blocks.
+		if err := d.appendNew(); !errors.Is(err, lockedfile.ErrChanged) {
+			return err
+		}
+	}
+	if err := d.checkUnchanged(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := markdown.Write(&buf, d.blocks); err != nil {
+		return err
+	}
+	if err := lockedfile.WriteFile(d.path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	d.disk = newFileState(d.blocks, buf.Bytes())
+	return nil
+}
+
+// appendNew writes the blocks added since the file was last read or written
+// to its end, exactly as Write would have written them after the blocks
+// already there.
+func (d *Document) appendNew() error {
+	added := d.blocks[len(d.disk.blocks):]
+	if len(added) == 0 {
+		return nil
+	}
+	var buf bytes.Buffer
+	if d.disk.size > 0 && !bytes.HasSuffix(d.disk.tail, []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	if len(d.disk.blocks) > 0 {
+		buf.WriteString("\n")
+	}
+	if err := markdown.Write(&buf, added); err != nil {
+		return err
+	}
+	if err := lockedfile.Append(d.path, d.disk.size, d.disk.tail, buf.Bytes()); err != nil {
+		return err
+	}
+
+	tail := append(d.disk.tail, buf.Bytes()...)
+	d.disk = &fileState{
+		blocks: d.blocks,
+		size:   d.disk.size + int64(buf.Len()),
+		tail:   append([]byte{}, tail[max(0, len(tail)-tailSize):]...),
+		kept:   len(d.blocks),
+	}
+	return nil
+}
+
+// rewriteFrom records that the blocks from index i on no longer match the
+// file, so that Save rewrites it rather than appending.
+func (d *Document) rewriteFrom(i int) {
+	if d.disk != nil {
+		d.disk.kept = min(d.disk.kept, i)
+	}
+}
+
+// checkUnchanged returns an error if the file no longer holds what was last
+// read or written.
+func (d *Document) checkUnchanged() error {
+	if d.disk == nil {
+		if _, err := os.Stat(d.path); err == nil {
+			return fmt.Errorf("file already exists: %s", d.path)
+		}
+		return nil
+	}
+	data, err := lockedfile.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	return d.checkContent(data)
+}
+
+// checkContent returns an error if the document in data is not what was
+// last read or written.
+func (d *Document) checkContent(data []byte) error {
+	current, err := parseDocument(data, d.opts.Region)
+	if err != nil {
+		return err
+	}
+	if markdown.ContentHash(current) != markdown.ContentHash(d.disk.blocks) {
+		return fmt.Errorf("%s was changed by another process since it was read", d.path)
+	}
+	return nil
+}
+
+// saveRegion rewrites the document's region of its file, keeping the
+// current content of the rest of the file.
+func (d *Document) saveRegion() error {
+	data, err := lockedfile.ReadFile(d.path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if err := d.checkContent(data); err != nil {
+		return err
+	}
+	data, err = markdown.ReplaceRegion(data, d.opts.Region, d.blocks)
+	if err != nil {
+		return err
+	}
+	if err := lockedfile.WriteFile(d.path, data, 0644); err != nil {
+		return err
+	}
+	d.disk = newFileState(d.blocks, data)
+	return nil
+}
+
+// send holds a change to report to the sink when the document is saved, if
+// there is a sink and the document has an ID to report it under.
+func (d *Document) send(ctx context.Context, e Event) {
+	e.DocumentID = d.ID()
+	if d.opts.Sink == nil || e.DocumentID == "" {
+		return
+	}
+	d.pending = append(d.pending, pendingEvent{ctx, e})
+}
+
+// SealIndex returns the index of the first seal block in blocks, or -1.
+func SealIndex(blocks []markdown.Block) int {
+	for i, b := range blocks {
+		if _, ok := b.(markdown.SealBlock); ok {
+			return i
+		}
+	}
+	return -1
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
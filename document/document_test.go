@@ -0,0 +1,561 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// fakeExecutor returns canned output for each code string.
+func fakeExecutor(outputs map[string]string) Executor {
+	return ExecutorFunc(func(ctx context.Context, lang, code, workdir string) (string, int, error) {
+		out, ok := outputs[code]
+		if !ok {
+			return "", 127, nil
+		}
+		return out, 0, nil
+	})
+}
+
+func TestCreateExecSaveOpen(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	clock := time.Date(2026, 2, 6, 15, 30, 0, 0, time.UTC)
+	opts := Options{
+		Executor: fakeExecutor(map[string]string{"echo hi": "hi\n"}),
+		Now:      func() time.Time { return clock },
+		Version:  "test",
+	}
+
+	doc, err := Create(ctx, file, "Library demo", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.AppendNote(ctx, "Intro"); err != nil {
+		t.Fatal(err)
+	}
+	res, err := doc.Exec(ctx, "bash", "echo hi", EntryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Output != "hi\n" || res.ExitCode != 0 || res.EntryID == "" {
+		t.Errorf("unexpected exec result: %+v", res)
+	}
+	if _, err := os.Stat(file); err == nil {
+		t.Fatal("expected nothing to be written before Save")
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if _, err := reopened.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	s := buf.String()
+	if !strings.HasPrefix(s, "# Library demo\n\n*2026-02-06T15:30:00Z by Showboat test*\n") {
+		t.Errorf("expected title with the injected clock, got:\n%s", s)
+	}
+	if !strings.Contains(s, "```bash\necho hi\n```\n\n```output\nhi\n```\n") {
+		t.Errorf("expected exec entry, got:\n%s", s)
+	}
+	if errs := markdown.CheckChain(reopened.Blocks()); len(errs) != 0 {
+		t.Errorf("expected a valid hash chain, got %+v", errs)
+	}
+
+	if _, err := Create(ctx, file, "Again", opts); err == nil {
+		t.Error("expected Create to fail when the file exists")
+	}
+}
+
+func TestSaveRefusesConcurrentChange(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	doc, err := Create(ctx, file, "Demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := Open(file, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.AppendNote(ctx, "from elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := doc.AppendNote(ctx, "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err == nil || !strings.Contains(err.Error(), "changed by another process") {
+		t.Errorf("expected a conflict error, got %v", err)
+	}
+	content, _ := os.ReadFile(file)
+	if !strings.Contains(string(content), "from elsewhere") {
+		t.Error("expected the other change to be kept")
+	}
+}
+
+func TestSaveAppends(t *testing.T) {
+	ctx := context.Background()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	// Hand-written markdown that Write would format differently, with no
+	// newline at the end.
+	original := "# Demo\n\n*2026-02-06T15:30:00Z*\n<!-- showboat-id: 1234 -->\n\nSome  notes\nwritten by hand.\n\n```bash\necho hi\n```\n\n```output\nhi\n```"
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := Open(file, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.AppendNote(ctx, "Appended"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.AppendNote(ctx, "And again"); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := os.ReadFile(file)
+	if !strings.HasPrefix(string(content), original+"\n") {
+		t.Errorf("expected the existing content to be left as it was, got:\n%s", content)
+	}
+	reopened, err := Open(file, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if markdown.ContentHash(reopened.Blocks()) != markdown.ContentHash(doc.Blocks()) {
+		t.Errorf("expected the appended file to parse as the document, got:\n%s", content)
+	}
+
+	// Pop needs a full rewrite.
+	if _, err := reopened.Pop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Save(); err != nil {
+		t.Fatal(err)
+	}
+	var want strings.Builder
+	reopened.WriteTo(&want)
+	content, _ = os.ReadFile(file)
+	if string(content) != want.String() {
+		t.Errorf("expected pop to rewrite the file, got:\n%s", content)
+	}
+}
+
+func TestSinkReceivesEvents(t *testing.T) {
+	ctx := context.Background()
+	var events []Event
+	opts := Options{
+		Executor: fakeExecutor(map[string]string{"ls": "a\n"}),
+		Sink:     SinkFunc(func(ctx context.Context, e Event) { events = append(events, e) }),
+	}
+
+	doc, err := Create(ctx, filepath.Join(t.TempDir(), "demo.md"), "Events", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noteID, _ := doc.AppendNote(ctx, "note")
+	res, _ := doc.Exec(ctx, "bash", "ls", EntryOptions{})
+	popped, err := doc.Pop(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if popped != res.EntryID {
+		t.Errorf("expected Pop to return %q, got %q", res.EntryID, popped)
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events before Save, got %v", events)
+	}
+	if err := doc.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, e := range events {
+		if e.DocumentID != doc.ID() {
+			t.Errorf("expected document ID %q on %s event, got %q", doc.ID(), e.Command, e.DocumentID)
+		}
+		got = append(got, e.Command+":"+e.EntryID)
+	}
+	want := []string{"init:", "note:" + noteID, "exec:" + res.EntryID, "pop:" + res.EntryID}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected events %v, got %v", want, got)
+	}
+}
+
+func TestSinkWaitsForSave(t *testing.T) {
+	ctx := context.Background()
+	var events []Event
+	opts := Options{Sink: SinkFunc(func(ctx context.Context, e Event) { events = append(events, e) })}
+
+	path := filepath.Join(t.TempDir(), "demo.md")
+	doc, err := Create(ctx, path, "Events", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.AppendNote(ctx, "note"); err != nil {
+		t.Fatal(err)
+	}
+	// Someone else creates the file first, so the save fails.
+	if err := os.WriteFile(path, []byte("# Other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.Save(); err == nil {
+		t.Fatal("expected Save to fail")
+	}
+	if len(events) != 0 {
+		t.Errorf("expected no events for a failed save, got %v", events)
+	}
+}
+
+func TestPopTitleOnly(t *testing.T) {
+	doc, err := Create(context.Background(), "", "Demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Pop(context.Background()); err == nil {
+		t.Error("expected error popping a document with only a title")
+	}
+}
+
+func TestSealedDocumentRefusesChanges(t *testing.T) {
+	ctx := context.Background()
+	doc, err := Create(ctx, "", "Demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.blocks = append(doc.blocks, markdown.SealBlock{Hash: markdown.ContentHash(doc.blocks), Timestamp: "now"})
+
+	if !doc.Sealed() {
+		t.Fatal("expected document to be sealed")
+	}
+	if _, err := doc.AppendNote(ctx, "late"); !errors.Is(err, ErrSealed) {
+		t.Errorf("expected ErrSealed, got %v", err)
+	}
+	if _, err := doc.Pop(ctx); !errors.Is(err, ErrSealed) {
+		t.Errorf("expected ErrSealed from Pop, got %v", err)
+	}
+}
+
+func TestVerifyResults(t *testing.T) {
+	ctx := context.Background()
+	outputs := map[string]string{"date": "Monday\n", "echo ok": "ok\n"}
+	doc, err := Create(ctx, "", "Demo", Options{Executor: fakeExecutor(outputs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Exec(ctx, "bash", "echo ok", EntryOptions{})
+	doc.Exec(ctx, "bash", "date", EntryOptions{})
+
+	outputs["date"] = "Tuesday\n"
+	results, err := doc.Verify(ctx, VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	if !results[0].Passed() {
+		t.Errorf("expected first block to pass: %+v", results[0])
+	}
+	if r := results[1]; r.Passed() || r.Expected != "Monday\n" || r.Actual != "Tuesday\n" || r.EntryID == "" {
+		t.Errorf("expected second block to fail with both outputs, got %+v", r)
+	}
+}
+
+func TestVerifyUnrecorded(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "demo.md")
+	// A sample with no output block after it, as adopt leaves examples in
+	// languages it was not asked to run, is not run.
+	original := "# Demo\n\n```json\n{\"a\": 1}\n```\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n"
+	if err := os.WriteFile(file, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var ran []string
+	doc, err := Open(file, Options{Executor: ExecutorFunc(func(ctx context.Context, lang, code, workdir string) (string, int, error) {
+		ran = append(ran, code)
+		return "hi\n", 0, nil
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := doc.Verify(context.Background(), VerifyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(ran, ","); got != "echo hi" {
+		t.Errorf("expected only the block with an output to run, got %s", got)
+	}
+	if len(results) != 1 || results[0].BlockIndex != 2 || !results[0].Passed() {
+		t.Errorf("expected one passing result, got %+v", results)
+	}
+}
+
+func TestVerifyFixtures(t *testing.T) {
+	ctx := context.Background()
+	outputs := map[string]string{"start": "", "step": "ok\n", "stop": ""}
+	doc, err := Create(ctx, "", "Demo", Options{Executor: fakeExecutor(outputs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Exec(ctx, "bash", "stop", EntryOptions{Role: markdown.RoleTeardown})
+	doc.Exec(ctx, "bash", "step", EntryOptions{})
+	doc.Exec(ctx, "bash", "start", EntryOptions{Role: markdown.RoleSetup})
+	if _, err := doc.Exec(ctx, "bash", "x", EntryOptions{Role: "cleanup"}); err == nil {
+		t.Error("expected an unknown role to be rejected")
+	}
+
+	// The step fails to run; teardown still runs, with a live context.
+	ctx, cancel := context.WithCancel(ctx)
+	var ran []string
+	doc.opts.Executor = ExecutorFunc(func(ctx context.Context, lang, code, workdir string) (string, int, error) {
+		ran = append(ran, code)
+		if code == "step" {
+			cancel()
+			return "", 1, ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return "", 1, err
+		}
+		return outputs[code], 0, nil
+	})
+	results, err := doc.Verify(ctx, VerifyOptions{})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the step's error, got %v", err)
+	}
+	if got := strings.Join(ran, ","); got != "start,step,stop" {
+		t.Errorf("expected setup, step, teardown order, got %s", got)
+	}
+	if len(results) != 2 || results[0].Code != "start" || results[1].Code != "stop" {
+		t.Errorf("expected results for setup and teardown, got %+v", results)
+	}
+}
+
+func TestVerifyNeeds(t *testing.T) {
+	ctx := context.Background()
+	outputs := map[string]string{"a": "a\n", "b": "b\n", "c": "c\n", "d": "d\n", "stop": ""}
+	doc, err := Create(ctx, "", "Demo", Options{Executor: fakeExecutor(outputs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, _ := doc.Exec(ctx, "bash", "a", EntryOptions{})
+	b, err := doc.Exec(ctx, "bash", "b", EntryOptions{Needs: []string{a.EntryID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Exec(ctx, "bash", "c", EntryOptions{})
+	doc.Exec(ctx, "bash", "d", EntryOptions{Needs: []string{b.EntryID}})
+	doc.Exec(ctx, "bash", "stop", EntryOptions{Role: markdown.RoleTeardown})
+	if _, err := doc.Exec(ctx, "bash", "x", EntryOptions{Needs: []string{"missing0"}}); err == nil {
+		t.Error("expected an unknown entry in needs to be rejected")
+	}
+
+	// a now fails: b and d are skipped, c still runs.
+	outputs["a"] = "changed\n"
+	summary := func(results []Result) string {
+		var parts []string
+		for _, r := range results {
+			switch {
+			case r.Skipped != "":
+				parts = append(parts, r.Code+" skipped: "+r.Skipped)
+			case r.Passed():
+				parts = append(parts, r.Code+" passed")
+			default:
+				parts = append(parts, r.Code+" failed")
+			}
+		}
+		return strings.Join(parts, "; ")
+	}
+	tests := []struct {
+		opts VerifyOptions
+		want string
+	}{
+		{VerifyOptions{}, fmt.Sprintf("a failed; b skipped: needs entry %s, which failed; c passed; d skipped: needs entry %s, which was skipped; stop passed", a.EntryID, b.EntryID)},
+		{VerifyOptions{Chain: true}, fmt.Sprintf("a failed; b skipped: needs entry %[1]s, which failed; c skipped: entry %[1]s failed before it; d skipped: needs entry %[2]s, which was skipped; stop passed", a.EntryID, b.EntryID)},
+		{VerifyOptions{FailFast: true}, "a failed; stop passed"},
+	}
+	for _, tt := range tests {
+		results, err := doc.Verify(ctx, tt.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := summary(results); got != tt.want {
+			t.Errorf("%+v:\nexpected %s\ngot      %s", tt.opts, tt.want, got)
+		}
+	}
+}
+
+func TestVerifyEach(t *testing.T) {
+	ctx := context.Background()
+	outputs := map[string]string{"start": "", "a": "a\n", "b": "b\n", "stop": ""}
+	doc, err := Create(ctx, "", "Demo", Options{Executor: fakeExecutor(outputs)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc.Exec(ctx, "bash", "start", EntryOptions{Role: markdown.RoleSetup})
+	doc.Exec(ctx, "bash", "a", EntryOptions{})
+	doc.Exec(ctx, "bash", "b", EntryOptions{})
+	doc.Exec(ctx, "bash", "stop", EntryOptions{Role: markdown.RoleTeardown})
+
+	var ran []string
+	doc.opts.Executor = ExecutorFunc(func(ctx context.Context, lang, code, workdir string) (string, int, error) {
+		ran = append(ran, code)
+		return outputs[code], 0, nil
+	})
+	var seen []string
+	results, err := doc.Verify(ctx, VerifyOptions{Each: func(r *Result, run func() error) {
+		seen = append(seen, r.Code)
+		if r.Code != "a" {
+			run()
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(seen, ","); got != "start,a,b,stop" {
+		t.Errorf("expected Each to see every block, got %s", got)
+	}
+	if got := strings.Join(ran, ","); got != "start,b,stop" {
+		t.Errorf("expected fixtures to run and a to be left out, got %s", got)
+	}
+	if len(results) != 3 {
+		t.Errorf("expected no result for the block that was not run, got %+v", results)
+	}
+}
+
+func TestExecCancelled(t *testing.T) {
+	doc, err := Create(context.Background(), "", "Demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := doc.Exec(ctx, "bash", "sleep 5", EntryOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if len(doc.Blocks()) != 1 {
+		t.Errorf("expected nothing to be appended, got %d blocks", len(doc.Blocks()))
+	}
+}
+
+func TestImage(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "shot.png")
+	if err := os.WriteFile(src, []byte("png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Create(context.Background(), filepath.Join(dir, "demo.md"), "Demo", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Image(context.Background(), "![A shot]("+src+")", EntryOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	blocks := doc.Blocks()
+	img, ok := blocks[len(blocks)-1].(markdown.ImageOutputBlock)
+	if !ok || img.AltText != "A shot" {
+		t.Fatalf("expected image output with alt text, got %+v", blocks[len(blocks)-1])
+	}
+	if _, err := os.Stat(filepath.Join(dir, img.Filename)); err != nil {
+		t.Errorf("expected image to be copied next to the document: %v", err)
+	}
+}
+
+func TestParseImageInput(t *testing.T) {
+	tests := []struct {
+		input   string
+		path    string
+		altText string
+	}{
+		{"/path/to/img.png", "/path/to/img.png", ""},
+		{"![alt text](/path/to/img.png)", "/path/to/img.png", "alt text"},
+		{"![](file.jpg)", "file.jpg", ""},
+		{"![Screenshot of homepage](shot.png)", "shot.png", "Screenshot of homepage"},
+		{"  ![padded](file.png)  ", "file.png", "padded"},
+		{"not-markdown.png", "not-markdown.png", ""},
+		{`\![escaped](file.png)`, "file.png", "escaped"},
+		{`\![alt text](/path/to/img.png)`, "/path/to/img.png", "alt text"},
+	}
+	for _, tt := range tests {
+		path, alt := ParseImageInput(tt.input)
+		if path != tt.path {
+			t.Errorf("ParseImageInput(%q): path = %q, want %q", tt.input, path, tt.path)
+		}
+		if alt != tt.altText {
+			t.Errorf("ParseImageInput(%q): altText = %q, want %q", tt.input, alt, tt.altText)
+		}
+	}
+}
+
+func TestParseGitState(t *testing.T) {
+	g := GitState{Commit: "abc123", Dirty: true, Changes: " a.txt | 2 +-\n 1 file changed\n?? b.txt\n"}
+	out := g.String()
+	if !strings.HasPrefix(out, "commit: abc123\nbranch:\ndirty: yes\n a.txt | 2 +-\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	parsed, ok := ParseGitState(out)
+	if !ok || parsed != g {
+		t.Errorf("expected %+v, got %+v", g, parsed)
+	}
+	if _, ok := ParseGitState("hello\n"); ok {
+		t.Error("expected output without a commit to be rejected")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	f := Fingerprint{{Name: "os", Value: "linux/amd64"}, {Name: "python3", Value: "Python 3.12.3"}, {Name: "node"}}
+	out := f.String()
+	if out != "os: linux/amd64\npython3: Python 3.12.3\nnode:\n" {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	parsed := ParseFingerprint(out)
+	if len(parsed) != len(f) {
+		t.Fatalf("expected %v, got %v", f, parsed)
+	}
+	for i := range f {
+		if parsed[i] != f[i] {
+			t.Errorf("item %d: expected %+v, got %+v", i, f[i], parsed[i])
+		}
+	}
+	if v, ok := parsed.Get("python3"); !ok || v != "Python 3.12.3" {
+		t.Errorf("Get(python3) = %q, %v", v, ok)
+	}
+}
+
+func TestLangs(t *testing.T) {
+	blocks := []markdown.Block{
+		markdown.CodeBlock{Lang: "bash", Code: "echo 1"},
+		markdown.CodeBlock{Lang: "python3", Code: "print(1)"},
+		markdown.CodeBlock{Lang: "bash", Code: "showboat env", Role: markdown.RoleEnv},
+		markdown.CodeBlock{Lang: "bash", Code: "echo 2"},
+		markdown.CodeBlock{Lang: "node", Code: "shot.png", IsImage: true},
+	}
+	if got := strings.Join(Langs(blocks), ","); got != "bash,python3" {
+		t.Errorf("expected bash,python3, got %s", got)
+	}
+}
@@ -0,0 +1,266 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// EntryOptions controls Exec and Image.
+type EntryOptions struct {
+	// Workdir is the directory code runs in. Empty means Options.Workdir.
+	Workdir string
+
+	// Provenance records the start time, duration, exit code, hostname,
+	// working directory and interpreter version in the entry marker.
+	Provenance bool
+
+	// Role marks an Exec entry as markdown.RoleSetup or
+	// markdown.RoleTeardown. Empty means an ordinary step.
+	Role string
+
+	// Timeout is how long StartService waits for a service to become
+	// ready. Zero means execpkg.DefaultServiceTimeout.
+	Timeout time.Duration
+
+	// Needs lists the IDs of earlier code entries that an Exec entry
+	// depends on. Verify skips the entry if one of them fails.
+	Needs []string
+
+	// ID is the ID to give the new entry, such as when replaying the
+	// commands printed by "showboat extract". Empty means a new random ID.
+	ID string
+}
+
+// ExecResult is the outcome of Exec.
+type ExecResult struct {
+	EntryID  string
+	Output   string
+	ExitCode int
+}
+
+// NewEntryID returns a short random ID for a new entry.
+func NewEntryID() string {
+	return uuid.New().String()[:8]
+}
+
+var entryIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// entryID returns the ID for a new entry: opts.ID if it is set and not
+// already used in the document, or a new random ID.
+func (d *Document) entryID(opts EntryOptions) (string, error) {
+	if opts.ID == "" {
+		return NewEntryID(), nil
+	}
+	if !entryIDRe.MatchString(opts.ID) {
+		return "", fmt.Errorf("invalid entry ID %q: use letters, digits, '_' and '-'", opts.ID)
+	}
+	if _, ok := markdown.FindEntry(d.blocks, opts.ID); ok {
+		return "", fmt.Errorf("the document already has an entry %s", opts.ID)
+	}
+	return opts.ID, nil
+}
+
+// appendEntry chains a new entry to the end of the document and returns the
+// blocks as added.
+func (d *Document) appendEntry(entry []markdown.Block) []markdown.Block {
+	entry = markdown.ChainEntry(d.blocks, entry)
+	d.blocks = append(d.blocks[:len(d.blocks):len(d.blocks)], entry...)
+	return entry
+}
+
+func (d *Document) ensureUnsealed() error {
+	if d.Sealed() {
+		return ErrSealed
+	}
+	return nil
+}
+
+// AppendNote appends a commentary entry and returns its entry ID.
+func (d *Document) AppendNote(ctx context.Context, text string) (string, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return "", err
+	}
+	id := NewEntryID()
+	entry := d.appendEntry([]markdown.Block{markdown.CommentaryBlock{Text: text, ID: id}})
+	d.send(ctx, Event{Command: "note", EntryID: id, Blocks: entry})
+	return id, nil
+}
+
+// Exec runs code and appends it and its output as a new entry. A non-zero
+// exit code is recorded and returned, not treated as an error. If ctx is
+// cancelled while the code runs, nothing is appended.
+func (d *Document) Exec(ctx context.Context, lang, code string, opts EntryOptions) (ExecResult, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return ExecResult{}, err
+	}
+	id, err := d.entryID(opts)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	if opts.Role != "" && opts.Role != markdown.RoleSetup && opts.Role != markdown.RoleTeardown {
+		return ExecResult{}, fmt.Errorf("invalid role %q for an exec entry", opts.Role)
+	}
+	if err := d.checkNeeds(opts.Needs); err != nil {
+		return ExecResult{}, err
+	}
+	workdir := d.workdir(opts.Workdir)
+
+	start := d.opts.now()
+	output, exitCode, err := d.opts.executor().Run(ctx, lang, code, workdir)
+	if err != nil {
+		return ExecResult{Output: output, ExitCode: exitCode}, fmt.Errorf("running code: %w", err)
+	}
+	duration := d.opts.now().Sub(start)
+
+	codeBlock := markdown.CodeBlock{Lang: lang, Code: code, Role: opts.Role, Needs: strings.Join(opts.Needs, ","), ID: id}
+	if opts.Provenance {
+		codeBlock.Provenance = collectProvenance(ctx, lang, workdir, start, duration, exitCode)
+	}
+	entry := d.appendEntry([]markdown.Block{codeBlock, markdown.OutputBlock{Content: output}})
+	d.send(ctx, Event{Command: "exec", EntryID: id, Blocks: entry})
+	return ExecResult{EntryID: id, Output: output, ExitCode: exitCode}, nil
+}
+
+// checkNeeds returns an error unless every ID in needs is that of a code
+// entry in the document.
+func (d *Document) checkNeeds(needs []string) error {
+	for _, id := range needs {
+		e, ok := markdown.FindEntry(d.blocks, id)
+		if !ok {
+			return fmt.Errorf("needs entry %s, which is not in the document", id)
+		}
+		if _, ok := e.Blocks[0].(markdown.CodeBlock); !ok {
+			return fmt.Errorf("needs entry %s, which is not a code entry", id)
+		}
+	}
+	return nil
+}
+
+// AppendEntry appends an entry that Exec, Image, StartService, AppendEnv or
+// AppendGitState added to another copy of the document, chaining it to the
+// end of this one. This lets code run on a copy read without holding the
+// file's lock, with the lock taken only to read the file again and add the
+// result. It returns an error if the document is sealed, already has an
+// entry with the same ID or no longer has an entry the new one needs.
+func (d *Document) AppendEntry(ctx context.Context, entry []markdown.Block) error {
+	if err := d.ensureUnsealed(); err != nil {
+		return err
+	}
+	cb, ok := entry[0].(markdown.CodeBlock)
+	if !ok {
+		return fmt.Errorf("not a code entry")
+	}
+	if _, ok := markdown.FindEntry(d.blocks, cb.ID); ok {
+		return fmt.Errorf("the document already has an entry %s", cb.ID)
+	}
+	if err := d.checkNeeds(cb.NeedsList()); err != nil {
+		return err
+	}
+	entry = d.appendEntry(entry)
+	e := Event{Command: "exec", EntryID: cb.ID, Blocks: entry}
+	if img, ok := entry[len(entry)-1].(markdown.ImageOutputBlock); ok && cb.IsImage {
+		e.Command = "image"
+		e.ImagePath = filepath.Join(filepath.Dir(d.path), img.Filename)
+	}
+	d.send(ctx, e)
+	return nil
+}
+
+// Image copies an image into the document's directory and appends an entry
+// referencing it, returning the entry ID. input is a path to the image or a
+// markdown image reference of the form ![alt text](path); without alt text
+// it is derived from the generated filename.
+func (d *Document) Image(ctx context.Context, input string, opts EntryOptions) (string, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return "", err
+	}
+	id, err := d.entryID(opts)
+	if err != nil {
+		return "", err
+	}
+	workdir := d.workdir(opts.Workdir)
+
+	imgPath, altText := ParseImageInput(input)
+
+	destDir := filepath.Dir(d.path)
+	start := d.opts.now()
+	filename, err := execpkg.CopyImage(imgPath, destDir)
+	if err != nil {
+		return "", err
+	}
+	duration := d.opts.now().Sub(start)
+
+	if altText == "" {
+		// Derive alt text from the filename without UUID prefix and date
+		altText = strings.TrimSuffix(filename, filepath.Ext(filename))
+	}
+
+	codeBlock := markdown.CodeBlock{Lang: "bash", Code: input, IsImage: true, ID: id}
+	if opts.Provenance {
+		// No interpreter runs for an image entry; the file is copied directly.
+		codeBlock.Provenance = collectProvenance(ctx, "", workdir, start, duration, 0)
+	}
+	entry := d.appendEntry([]markdown.Block{codeBlock, markdown.ImageOutputBlock{AltText: altText, Filename: filename}})
+	d.send(ctx, Event{Command: "image", EntryID: id, Blocks: entry, ImagePath: filepath.Join(destDir, filename)})
+	return id, nil
+}
+
+// Pop removes the most recent entry: a commentary block, or a code block
+// together with its output. It returns the removed entry's ID, which is ""
+// for entries recorded without one. The title cannot be removed.
+func (d *Document) Pop(ctx context.Context) (string, error) {
+	if len(d.blocks) == 0 {
+		return "", fmt.Errorf("document is empty")
+	}
+	if err := d.ensureUnsealed(); err != nil {
+		return "", err
+	}
+	entries := markdown.Entries(d.blocks)
+	if len(entries) == 0 {
+		return "", fmt.Errorf("nothing to pop: document only contains a title")
+	}
+
+	last := entries[len(entries)-1]
+	d.blocks = d.blocks[:last.Start:last.Start]
+	d.rewriteFrom(last.Start)
+	d.send(ctx, Event{Command: "pop", EntryID: last.ID()})
+	return last.ID(), nil
+}
+
+func (d *Document) workdir(dir string) string {
+	if dir != "" {
+		return dir
+	}
+	return d.opts.Workdir
+}
+
+// ParseImageInput checks whether input is a markdown image reference
+// (![alt](path)) or a plain file path. It returns the image path and any
+// extracted alt text (empty when the input is a plain path).
+// It also handles the common case where the shell escapes "!" to "\!".
+func ParseImageInput(input string) (path, altText string) {
+	trimmed := strings.TrimSpace(input)
+	// Some shells escape "!" to "\!", so strip the leading backslash.
+	if strings.HasPrefix(trimmed, `\![`) {
+		trimmed = trimmed[1:]
+	}
+	if strings.HasPrefix(trimmed, "![") && strings.HasSuffix(trimmed, ")") {
+		// Extract alt text between ![ and ]
+		rest := trimmed[2:]
+		closeBracket := strings.Index(rest, "](")
+		if closeBracket != -1 {
+			altText = rest[:closeBracket]
+			path = rest[closeBracket+2 : len(rest)-1]
+			return path, altText
+		}
+	}
+	return trimmed, ""
+}
@@ -0,0 +1,114 @@
+package document
+
+import (
+	"context"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// Fingerprint describes the environment code ran in: the OS, the kernel and
+// the version of each interpreter, in the order they are recorded. It is
+// recorded as the output of a markdown.RoleEnv code block, one "name: value"
+// line per item.
+type Fingerprint []FingerprintItem
+
+// FingerprintItem is one line of a Fingerprint. Name is "os", "kernel" or
+// the language of a code block; Value is empty if the version is unknown.
+type FingerprintItem struct {
+	Name  string
+	Value string
+}
+
+// String returns the fingerprint as recorded in a document:
+//
+//	os: linux/amd64
+//	kernel: Linux 6.8.0-45-generic
+//	bash: GNU bash, version 5.2.21(1)-release (x86_64-pc-linux-gnu)
+//	python3: Python 3.12.3
+func (f Fingerprint) String() string {
+	var sb strings.Builder
+	for _, item := range f {
+		sb.WriteString(strings.TrimRight(item.Name+": "+item.Value, " ") + "\n")
+	}
+	return sb.String()
+}
+
+// Get returns the value recorded for name and whether it was recorded.
+func (f Fingerprint) Get(name string) (string, bool) {
+	for _, item := range f {
+		if item.Name == name {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+// ParseFingerprint parses the output of an env entry. Lines that are not of
+// the form "name: value" are ignored.
+func ParseFingerprint(output string) Fingerprint {
+	var f Fingerprint
+	for _, line := range strings.Split(output, "\n") {
+		name, value, ok := strings.Cut(line, ": ")
+		if !ok && strings.HasSuffix(line, ":") {
+			name, ok = strings.TrimSuffix(line, ":"), true
+		}
+		if ok && name != "" && !strings.ContainsAny(name, " \t") {
+			f = append(f, FingerprintItem{Name: name, Value: value})
+		}
+	}
+	return f
+}
+
+// CaptureFingerprint returns the fingerprint of the current environment with
+// the versions of the interpreters for langs, as printed by
+// "<lang> --version".
+func CaptureFingerprint(ctx context.Context, langs []string) Fingerprint {
+	f := Fingerprint{{Name: "os", Value: runtime.GOOS + "/" + runtime.GOARCH}}
+	if runtime.GOOS != "windows" {
+		if out, err := exec.CommandContext(ctx, "uname", "-sr").Output(); err == nil {
+			f = append(f, FingerprintItem{Name: "kernel", Value: strings.TrimSpace(string(out))})
+		}
+	}
+	for _, lang := range langs {
+		f = append(f, FingerprintItem{Name: lang, Value: interpreterVersion(ctx, lang)})
+	}
+	return f
+}
+
+// Langs returns the languages of the code blocks in blocks that verify
+// re-runs, each once, in order of first use.
+func Langs(blocks []markdown.Block) []string {
+	seen := map[string]bool{}
+	var langs []string
+	for _, b := range blocks {
+		cb, ok := b.(markdown.CodeBlock)
+		if !ok || cb.IsImage || cb.IsRecord() || cb.Lang == "" || seen[cb.Lang] {
+			continue
+		}
+		seen[cb.Lang] = true
+		langs = append(langs, cb.Lang)
+	}
+	return langs
+}
+
+// AppendEnv records the fingerprint of the environment as a new entry,
+// returning the entry ID. The fingerprint includes the interpreter of every
+// language used by the document's code blocks so far. See Fingerprint.
+func (d *Document) AppendEnv(ctx context.Context, opts EntryOptions) (string, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return "", err
+	}
+	id, err := d.entryID(opts)
+	if err != nil {
+		return "", err
+	}
+	f := CaptureFingerprint(ctx, Langs(d.blocks))
+
+	codeBlock := markdown.CodeBlock{Lang: "bash", Code: "showboat env", Role: markdown.RoleEnv, ID: id}
+	entry := d.appendEntry([]markdown.Block{codeBlock, markdown.OutputBlock{Content: f.String()}})
+	d.send(ctx, Event{Command: "exec", EntryID: id, Blocks: entry})
+	return id, nil
+}
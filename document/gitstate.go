@@ -0,0 +1,211 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/simonw/showboat/internal/lockedfile"
+	"github.com/simonw/showboat/markdown"
+)
+
+// GitState is the state of a git working tree: the commit checked out, the
+// branch, and whether there are uncommitted changes. It is recorded as the
+// output of a markdown.RoleGitState code block.
+type GitState struct {
+	Commit string
+	Branch string // empty for a detached HEAD
+	Dirty  bool
+
+	// Changes is the diffstat of uncommitted changes to tracked files,
+	// followed by a "?? <path>" line for each untracked file.
+	Changes string
+}
+
+// String returns the state as recorded in a document:
+//
+//	commit: 9f1c2e7d...
+//	branch: main
+//	dirty: yes
+//	 cmd/init.go | 4 ++--
+//	 1 file changed, 2 insertions(+), 2 deletions(-)
+func (g GitState) String() string {
+	dirty := "no"
+	if g.Dirty {
+		dirty = "yes"
+	}
+	s := fmt.Sprintf("commit: %s\nbranch: %s\ndirty: %s\n", g.Commit, g.Branch, dirty)
+	s = strings.Replace(s, "branch: \n", "branch:\n", 1)
+	if g.Changes != "" {
+		s += strings.TrimRight(g.Changes, "\n") + "\n"
+	}
+	return s
+}
+
+// ParseGitState parses the output of a git state entry. It returns false if
+// the output does not record a commit.
+func ParseGitState(output string) (GitState, bool) {
+	var g GitState
+	lines := strings.Split(strings.TrimRight(output, "\n"), "\n")
+	for i, line := range lines {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok && strings.HasSuffix(line, ":") {
+			key, ok = strings.TrimSuffix(line, ":"), true
+		}
+		switch {
+		case ok && key == "commit":
+			g.Commit = value
+		case ok && key == "branch":
+			g.Branch = value
+		case ok && key == "dirty":
+			g.Dirty = value == "yes"
+		default:
+			g.Changes = strings.Join(lines[i:], "\n") + "\n"
+			return g, g.Commit != ""
+		}
+	}
+	return g, g.Commit != ""
+}
+
+// CaptureGitState returns the state of the git working tree containing dir,
+// or the current directory if dir is empty. Changes to the files in ignore,
+// such as the document being written, are left out.
+func CaptureGitState(ctx context.Context, dir string, ignore ...string) (GitState, error) {
+	commit, err := git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return GitState{}, fmt.Errorf("reading git state: %w", err)
+	}
+	g := GitState{Commit: strings.TrimSpace(commit)}
+	branch, _ := git(ctx, dir, "branch", "--show-current")
+	g.Branch = strings.TrimSpace(branch)
+
+	spec := pathspec(ctx, dir, ignore)
+	status, err := git(ctx, dir, append([]string{"status", "--porcelain", "--untracked-files=all"}, spec...)...)
+	if err != nil {
+		return GitState{}, fmt.Errorf("reading git state: %w", err)
+	}
+	g.Dirty = strings.TrimSpace(status) != ""
+	if g.Dirty {
+		stat, _ := git(ctx, dir, append([]string{"diff", "--stat", "HEAD"}, spec...)...)
+		g.Changes = stat
+		for _, line := range strings.Split(status, "\n") {
+			if strings.HasPrefix(line, "?? ") {
+				g.Changes += line + "\n"
+			}
+		}
+	}
+	return g, nil
+}
+
+// GitChangedFiles returns the files in the working tree containing dir that
+// differ from commit, or from HEAD if commit is empty, including untracked
+// files, relative to the top of the repository. Files in ignore are left
+// out.
+func GitChangedFiles(ctx context.Context, dir, commit string, ignore ...string) ([]string, error) {
+	if commit == "" {
+		commit = "HEAD"
+	}
+	spec := pathspec(ctx, dir, ignore)
+	changed, err := git(ctx, dir, append([]string{"diff", "--name-only", commit}, spec...)...)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(ctx, dir, append([]string{"ls-files", "--others", "--exclude-standard", "--full-name"}, spec...)...)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, f := range strings.Split(changed+untracked, "\n") {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+// pathspec returns git arguments limiting a command to the whole repository
+// containing dir except the files in ignore.
+func pathspec(ctx context.Context, dir string, ignore []string) []string {
+	spec := []string{"--", ":(top)"}
+	top, err := git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return spec
+	}
+	top = strings.TrimSpace(top)
+	for _, p := range ignore {
+		if rel, ok := repoPath(top, p); ok {
+			spec = append(spec, ":(top,exclude,literal)"+rel)
+		}
+	}
+	return spec
+}
+
+// repoPath returns path relative to the repository root top, resolving
+// symbolic links in its directory. path need not exist.
+func repoPath(top, path string) (string, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		abs = filepath.Join(dir, filepath.Base(abs))
+	}
+	if resolved, err := filepath.EvalSymlinks(top); err == nil {
+		top = resolved
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// git runs git in dir and returns its standard output. The error includes
+// what git printed to standard error.
+func git(ctx context.Context, dir string, args ...string) (string, error) {
+	c := exec.CommandContext(ctx, "git", args...)
+	c.Dir = dir
+	out, err := c.Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && len(ee.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(ee.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// OwnFiles returns the files showboat keeps for the document at path, which
+// git state does not count as changes: the document itself, its .journal
+// file, its service directory and the record of an append in progress.
+func OwnFiles(path string) []string {
+	return []string{path, path + ".journal", ServiceDir(path), lockedfile.AppendRecord(path)}
+}
+
+// AppendGitState records the state of the git working tree that code runs
+// in as a new entry, returning the entry ID. Changes to the document's own
+// files (see OwnFiles) are not counted. See GitState.
+func (d *Document) AppendGitState(ctx context.Context, opts EntryOptions) (string, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return "", err
+	}
+	id, err := d.entryID(opts)
+	if err != nil {
+		return "", err
+	}
+	var ignore []string
+	if d.path != "" {
+		ignore = OwnFiles(d.path)
+	}
+	g, err := CaptureGitState(ctx, d.workdir(opts.Workdir), ignore...)
+	if err != nil {
+		return "", err
+	}
+
+	codeBlock := markdown.CodeBlock{Lang: "bash", Code: "showboat git-state", Role: markdown.RoleGitState, ID: id}
+	entry := d.appendEntry([]markdown.Block{codeBlock, markdown.OutputBlock{Content: g.String()}})
+	d.send(ctx, Event{Command: "exec", EntryID: id, Blocks: entry})
+	return id, nil
+}
@@ -0,0 +1,53 @@
+package document
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// collectProvenance describes a run of lang that started at start and took
+// duration. lang may be empty when no interpreter was involved.
+func collectProvenance(ctx context.Context, lang, workdir string, start time.Time, duration time.Duration, exitCode int) *markdown.Provenance {
+	p := &markdown.Provenance{
+		Start:    start.UTC().Format("2006-01-02T15:04:05.000Z07:00"),
+		Duration: duration.Round(time.Millisecond).String(),
+		ExitCode: exitCode,
+	}
+	if host, err := os.Hostname(); err == nil {
+		p.Host = host
+	}
+	dir := workdir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	if abs, err := filepath.Abs(dir); err == nil {
+		p.Dir = abs
+	}
+	if lang != "" {
+		p.Interpreter = interpreterVersion(ctx, lang)
+	}
+	return p
+}
+
+// interpreterVersion returns the first line printed by "<lang> --version",
+// or "" if it cannot be determined within a few seconds.
+func interpreterVersion(ctx context.Context, lang string) string {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, lang, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	execpkg "github.com/simonw/showboat/exec"
+	"github.com/simonw/showboat/markdown"
+)
+
+// ServiceDir returns the directory holding the log and pid files of the
+// services started for the document at path: "<path>.services" next to it.
+func ServiceDir(path string) string {
+	return path + ".services"
+}
+
+// StartService starts code as a background service, waits until it passes
+// the readiness check svc.Ready, and appends an entry recording it, returning
+// the entry ID and the line recorded as its output. The service keeps
+// running after the document is saved; see execpkg.StartService. A service
+// that fails to start or become ready is stopped and not recorded.
+func (d *Document) StartService(ctx context.Context, svc markdown.Service, lang, code string, opts EntryOptions) (ExecResult, error) {
+	if err := d.ensureUnsealed(); err != nil {
+		return ExecResult{}, err
+	}
+	if d.path == "" {
+		return ExecResult{}, fmt.Errorf("services need a document saved to a file")
+	}
+	for _, b := range d.blocks {
+		if cb, ok := b.(markdown.CodeBlock); ok && cb.Service != nil && cb.Service.Name == svc.Name {
+			return ExecResult{}, fmt.Errorf("the document already starts a service named %s", svc.Name)
+		}
+	}
+	id, err := d.entryID(opts)
+	if err != nil {
+		return ExecResult{}, err
+	}
+	line, err := execpkg.StartService(ctx, ServiceDir(d.path), svc.Name, lang, code, d.workdir(opts.Workdir), svc.Ready, opts.Timeout)
+	if err != nil {
+		return ExecResult{}, err
+	}
+
+	codeBlock := markdown.CodeBlock{Lang: lang, Code: code, Role: markdown.RoleService, Service: &svc, ID: id}
+	output := line + "\n"
+	entry := d.appendEntry([]markdown.Block{codeBlock, markdown.OutputBlock{Content: output}})
+	d.send(ctx, Event{Command: "exec", EntryID: id, Blocks: entry})
+	return ExecResult{EntryID: id, Output: output}, nil
+}
+
+// verifyServices starts and stops the services of one run of Verify. They
+// use a temporary state directory, so that they do not clash with services
+// started while the document was written.
+type verifyServices struct {
+	dir     string
+	started []string
+}
+
+// start starts the service of cb and returns the line it records, or a
+// description of the failure.
+func (s *verifyServices) start(ctx context.Context, cb markdown.CodeBlock, workdir string) string {
+	if s.dir == "" {
+		dir, err := os.MkdirTemp("", "showboat-services-")
+		if err != nil {
+			return err.Error() + "\n"
+		}
+		s.dir = dir
+	}
+	name := cb.Service.Name
+	line, err := execpkg.StartService(ctx, s.dir, name, cb.Lang, cb.Code, workdir, cb.Service.Ready, 0)
+	if err != nil {
+		return err.Error() + "\n"
+	}
+	s.started = append(s.started, name)
+	return line + "\n"
+}
+
+// stopAll stops every service started, in reverse order.
+func (s *verifyServices) stopAll() {
+	for i := len(s.started) - 1; i >= 0; i-- {
+		execpkg.StopService(s.dir, s.started[i])
+	}
+	if s.dir != "" {
+		os.RemoveAll(s.dir)
+	}
+}
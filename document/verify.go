@@ -0,0 +1,190 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/simonw/showboat/markdown"
+)
+
+// VerifyOptions controls Verify.
+type VerifyOptions struct {
+	// Workdir is the directory code runs in. Empty means Options.Workdir.
+	Workdir string
+
+	// FailFast stops at the first block whose output differs, except that
+	// teardown blocks still run. The blocks after it have no Result.
+	FailFast bool
+
+	// Chain makes every block depend on all the blocks before it, so that
+	// after the first failure the rest are skipped.
+	Chain bool
+
+	// Each, if set, is called with the Result of every block in turn, and
+	// a function that runs the block and fills in the rest of the Result.
+	// Setup, service and teardown blocks have already run when Each is
+	// called; any other block runs only if Each calls run, and is left out
+	// of the results otherwise. run does nothing for a skipped block and
+	// returns the same error if called again.
+	Each func(r *Result, run func() error)
+}
+
+// Result is the outcome of re-running one code block.
+type Result struct {
+	BlockIndex int
+	EntryID    string
+	Lang       string
+	Code       string
+	Expected   string
+	Actual     string
+	ExitCode   int
+
+	// Skipped says why the block was not run, such as "needs entry
+	// 8b41d07a, which failed". Actual is empty for a skipped block.
+	Skipped string
+}
+
+// Passed reports whether the block ran and produced its recorded output.
+func (r Result) Passed() bool {
+	return r.Skipped == "" && r.Actual == r.Expected
+}
+
+// Verify re-runs every code block that has a recorded output, skipping
+// code blocks with no output block after them, image blocks and entries
+// that record the environment, such as git state, and returns one Result
+// per block in the order they ran: setup blocks first, teardown blocks last
+// and the rest in document order (see markdown.RunOrder). Service blocks
+// start their service in the background with the setup blocks, recording
+// the readiness line or the failure as their output, and every service is
+// stopped at the end.
+//
+// A block is skipped rather than run when a block it depends on failed or
+// was skipped: every block depends on the setup and service blocks, on the
+// entries listed in its Needs and, with opts.Chain, on every block before
+// it. Teardown blocks never depend on anything and run even if an earlier
+// block could not be run or ctx was cancelled.
+//
+// Verify does not change the document. A sealed document whose content no
+// longer matches its seal is rejected before anything runs.
+func (d *Document) Verify(ctx context.Context, opts VerifyOptions) ([]Result, error) {
+	if idx := SealIndex(d.blocks); idx != -1 {
+		seal := d.blocks[idx].(markdown.SealBlock)
+		if markdown.ContentHash(d.blocks[:idx]) != seal.Hash {
+			return nil, fmt.Errorf("document was modified after it was sealed")
+		}
+	}
+	workdir := d.workdir(opts.Workdir)
+
+	var results []Result
+	var failed error
+	var services verifyServices
+	defer services.stopAll()
+
+	// notPassed maps the ID of each entry that failed or was skipped to
+	// "failed" or "was skipped". setupFailed and chainFailed describe the
+	// first setup or service block, and the first block of any kind, that
+	// did not pass.
+	notPassed := map[string]string{}
+	var setupFailed, chainFailed string
+	stopped := false
+	for _, i := range markdown.RunOrder(d.blocks) {
+		cb := d.blocks[i].(markdown.CodeBlock)
+		runCtx := ctx
+		if cb.Role == markdown.RoleTeardown {
+			// Clean up even after a failure or cancellation.
+			runCtx = context.WithoutCancel(ctx)
+		} else if failed != nil || stopped {
+			continue
+		}
+
+		r := Result{
+			BlockIndex: i,
+			EntryID:    cb.ID,
+			Lang:       cb.Lang,
+			Code:       cb.Code,
+			Expected:   d.blocks[i+1].(markdown.OutputBlock).Content,
+		}
+		if cb.Role != markdown.RoleTeardown {
+			r.Skipped = skipReason(cb, notPassed, setupFailed, chainFailed, opts.Chain)
+		}
+		ran := false
+		var err error
+		run := func() error {
+			if ran || r.Skipped != "" {
+				return err
+			}
+			ran = true
+			if cb.Role == markdown.RoleService && cb.Service != nil {
+				r.Actual = services.start(runCtx, cb, workdir)
+			} else {
+				r.Actual, r.ExitCode, err = d.opts.executor().Run(runCtx, cb.Lang, cb.Code, workdir)
+			}
+			if err != nil {
+				err = fmt.Errorf("executing block %d: %w", i, err)
+			}
+			return err
+		}
+		if opts.Each == nil || cb.Role != "" {
+			run()
+		}
+		if opts.Each != nil {
+			opts.Each(&r, run)
+		}
+		if err != nil {
+			failed = errors.Join(failed, err)
+			continue
+		}
+		if !ran && r.Skipped == "" {
+			continue
+		}
+		results = append(results, r)
+
+		if r.Passed() {
+			continue
+		}
+		label := entryLabel(i, cb.ID)
+		if cb.ID != "" {
+			notPassed[cb.ID] = "failed"
+			if r.Skipped != "" {
+				notPassed[cb.ID] = "was skipped"
+			}
+		}
+		if (cb.Role == markdown.RoleSetup || cb.Role == markdown.RoleService) && setupFailed == "" {
+			setupFailed = label
+		}
+		if chainFailed == "" {
+			chainFailed = label
+		}
+		if opts.FailFast && cb.Role != markdown.RoleTeardown {
+			stopped = true
+		}
+	}
+	return results, failed
+}
+
+// skipReason returns why cb should not run given the blocks that did not
+// pass before it, or "" if it should run.
+func skipReason(cb markdown.CodeBlock, notPassed map[string]string, setupFailed, chainFailed string, chain bool) string {
+	for _, id := range cb.NeedsList() {
+		if what, ok := notPassed[id]; ok {
+			return fmt.Sprintf("needs entry %s, which %s", id, what)
+		}
+	}
+	if setupFailed != "" {
+		return fmt.Sprintf("setup %s failed", setupFailed)
+	}
+	if chain && chainFailed != "" {
+		return fmt.Sprintf("%s failed before it", chainFailed)
+	}
+	return ""
+}
+
+// entryLabel names a block in messages: "entry <id>", or "block <index>"
+// for blocks recorded without an ID.
+func entryLabel(index int, id string) string {
+	if id != "" {
+		return "entry " + id
+	}
+	return fmt.Sprintf("block %d", index)
+}
@@ -2,6 +2,7 @@ package exec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 )
@@ -12,7 +13,13 @@ import (
 // captured and returned alongside the exit code.
 // If workdir is empty, the current directory is used.
 func Run(lang, code, workdir string) (string, int, error) {
-	cmd := exec.Command(lang, "-c", code)
+	return RunContext(context.Background(), lang, code, workdir)
+}
+
+// RunContext is Run with a context. If ctx is cancelled before the code
+// finishes, the process is killed and ctx.Err() is returned.
+func RunContext(ctx context.Context, lang, code, workdir string) (string, int, error) {
+	cmd := exec.CommandContext(ctx, lang, "-c", code)
 
 	if workdir != "" {
 		cmd.Dir = workdir
@@ -23,6 +30,9 @@ func Run(lang, code, workdir string) (string, int, error) {
 	cmd.Stderr = &buf
 
 	err := cmd.Run()
+	if ctx.Err() != nil {
+		return buf.String(), 1, ctx.Err()
+	}
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			return buf.String(), exitErr.ExitCode(), nil
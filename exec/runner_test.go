@@ -1,8 +1,11 @@
 package exec
 
 import (
+	"context"
+	"errors"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestRunBash(t *testing.T) {
@@ -77,3 +80,12 @@ func TestRunStderrCaptured(t *testing.T) {
 		t.Errorf("expected both 'out' and 'err' in output, got %q", output)
 	}
 }
+
+func TestRunContextCancelled(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := RunContext(ctx, "bash", "sleep 5", "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+}
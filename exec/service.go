@@ -0,0 +1,288 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Services are background processes started by StartService. Each one has
+// a log file holding its output and a pid file in a state directory, so that
+// a later showboat command can stop it or read its output:
+//
+//	<dir>/<name>.log
+//	<dir>/<name>.pid
+//
+// On systems with process groups a service runs in a group of its own, and
+// stopping it stops any processes it started too.
+
+// DefaultServiceTimeout is how long StartService waits for a service to
+// become ready when no timeout is given.
+const DefaultServiceTimeout = 30 * time.Second
+
+// ErrServiceNotRunning is returned by StopService for a service that is not
+// running.
+var ErrServiceNotRunning = errors.New("service is not running")
+
+var serviceNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// CheckServiceName returns an error if name cannot be used as a service
+// name: names are letters, digits, ".", "_" and "-".
+func CheckServiceName(name string) error {
+	if !serviceNameRe.MatchString(name) {
+		return fmt.Errorf("invalid service name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// CheckReady returns an error if ready is not a valid readiness check: ""
+// (none), "port:<port>", "log:<text>" or "http:<url>" with a localhost URL.
+func CheckReady(ready string) error {
+	if ready == "" {
+		return nil
+	}
+	kind, value, _ := strings.Cut(ready, ":")
+	switch kind {
+	case "port":
+		if p, err := strconv.Atoi(value); err != nil || p < 1 || p > 65535 {
+			return fmt.Errorf("invalid port %q", value)
+		}
+		return nil
+	case "log":
+		if value == "" {
+			return fmt.Errorf("empty log text to wait for")
+		}
+		return nil
+	case "http":
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid URL %q", value)
+		}
+		switch u.Hostname() {
+		case "localhost", "127.0.0.1", "::1":
+			return nil
+		}
+		return fmt.Errorf("readiness URL %q is not on localhost", value)
+	}
+	return fmt.Errorf("invalid readiness check %q (want port:, log: or http:)", ready)
+}
+
+// DescribeReady returns the line recorded when the service name passed the
+// readiness check ready.
+func DescribeReady(name, ready string) string {
+	kind, value, _ := strings.Cut(ready, ":")
+	switch kind {
+	case "port":
+		return fmt.Sprintf("%s is listening on port %s", name, value)
+	case "log":
+		return fmt.Sprintf("%s logged %q", name, value)
+	case "http":
+		return fmt.Sprintf("%s returned 200 for %s", name, value)
+	}
+	return fmt.Sprintf("%s started", name)
+}
+
+// StartService runs code with lang in the background in workdir and waits
+// until it passes the readiness check ready (see CheckReady), at most
+// timeout or DefaultServiceTimeout if timeout is zero. It returns
+// DescribeReady's line. If the service exits or is not ready in time, it is
+// stopped and the error includes the end of its output.
+func StartService(ctx context.Context, dir, name, lang, code, workdir, ready string, timeout time.Duration) (string, error) {
+	if err := CheckServiceName(name); err != nil {
+		return "", err
+	}
+	if err := CheckReady(ready); err != nil {
+		return "", err
+	}
+	if timeout == 0 {
+		timeout = DefaultServiceTimeout
+	}
+	if pid, err := readPID(dir, name); err == nil && processAlive(pid) {
+		return "", fmt.Errorf("service %s is already running (pid %d)", name, pid)
+	}
+	// Another process already answering would make the check pass at once.
+	if kind, value, _ := strings.Cut(ready, ":"); (kind == "port" || kind == "http") && isReady(ctx, ready, "") {
+		if kind == "port" {
+			value = "port " + value
+		}
+		return "", fmt.Errorf("service %s: %s is already answering; stop whatever is using it first", name, value)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("creating service directory: %w", err)
+	}
+	logPath := filepath.Join(dir, name+".log")
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return "", fmt.Errorf("creating service log: %w", err)
+	}
+	defer logFile.Close()
+
+	cmd := exec.Command(lang, "-c", code)
+	cmd.Dir = workdir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("starting service %s: %w", name, err)
+	}
+	pidPath := filepath.Join(dir, name+".pid")
+	if err := os.WriteFile(pidPath, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		stopProcess(cmd.Process.Pid)
+		return "", fmt.Errorf("writing service pid: %w", err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	fail := func(reason string) (string, error) {
+		stopProcess(cmd.Process.Pid)
+		os.Remove(pidPath)
+		return "", fmt.Errorf("service %s %s%s", name, reason, logTail(logPath))
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case err := <-exited:
+			if err == nil {
+				return fail("exited before it was ready")
+			}
+			return fail(fmt.Sprintf("exited before it was ready (%v)", err))
+		default:
+		}
+		if isReady(ctx, ready, logPath) {
+			return DescribeReady(name, ready), nil
+		}
+		if err := ctx.Err(); err != nil {
+			stopProcess(cmd.Process.Pid)
+			os.Remove(pidPath)
+			return "", err
+		}
+		if time.Now().After(deadline) {
+			return fail(fmt.Sprintf("was not ready after %s", timeout))
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// isReady reports whether the readiness check currently passes.
+func isReady(ctx context.Context, ready, logPath string) bool {
+	kind, value, _ := strings.Cut(ready, ":")
+	switch kind {
+	case "port":
+		conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", value), 500*time.Millisecond)
+		if err != nil {
+			return false
+		}
+		conn.Close()
+		return true
+	case "log":
+		data, err := os.ReadFile(logPath)
+		return err == nil && strings.Contains(string(data), value)
+	case "http":
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, "GET", value, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}
+	return true
+}
+
+// logTail returns the last lines of the log at path, indented under a
+// colon, or "" if it is empty.
+func logTail(path string) string {
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return ""
+	}
+	if len(lines) > 10 {
+		lines = lines[len(lines)-10:]
+	}
+	return ":\n  " + strings.Join(lines, "\n  ")
+}
+
+// StopService stops the service name started with state directory dir and
+// waits for it to exit. It returns ErrServiceNotRunning if it is not
+// running.
+func StopService(dir, name string) error {
+	if err := CheckServiceName(name); err != nil {
+		return err
+	}
+	pid, err := readPID(dir, name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, ErrServiceNotRunning)
+	}
+	defer os.Remove(filepath.Join(dir, name+".pid"))
+	if !processAlive(pid) {
+		return fmt.Errorf("%s: %w", name, ErrServiceNotRunning)
+	}
+	stopProcess(pid)
+	return nil
+}
+
+// ServiceLog returns the output of the service name so far.
+func ServiceLog(dir, name string) (string, error) {
+	if err := CheckServiceName(name); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".log"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("no log for service %s", name)
+		}
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RunningServices returns the names of the services in dir that are still
+// running.
+func RunningServices(dir string) []string {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.pid"))
+	var names []string
+	for _, p := range paths {
+		name := strings.TrimSuffix(filepath.Base(p), ".pid")
+		if pid, err := readPID(dir, name); err == nil && processAlive(pid) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func readPID(dir, name string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name+".pid"))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// stopProcess asks the process to exit, then kills it if it is still
+// running after five seconds.
+func stopProcess(pid int) {
+	terminate(pid)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if !processAlive(pid) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	kill(pid)
+}
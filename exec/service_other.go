@@ -0,0 +1,32 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package exec
+
+import (
+	"os"
+	"os/exec"
+)
+
+// detach does nothing on systems without process groups. Processes started
+// by a service are not stopped with it.
+func detach(cmd *exec.Cmd) {}
+
+// processAlive reports whether a process with the given pid can be found.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
+
+// terminate kills the process, as there is no portable way to ask it to
+// exit.
+func terminate(pid int) { kill(pid) }
+
+func kill(pid int) {
+	if p, err := os.FindProcess(pid); err == nil {
+		p.Kill()
+	}
+}
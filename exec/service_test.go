@@ -0,0 +1,87 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartService(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	line, err := StartService(ctx, dir, "api", "bash", "echo booting; sleep 0.2; echo ready; sleep 60", "", "log:ready", 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if line != `api logged "ready"` {
+		t.Errorf("unexpected line %q", line)
+	}
+	if got := RunningServices(dir); len(got) != 1 || got[0] != "api" {
+		t.Errorf("expected api to be running, got %v", got)
+	}
+	if _, err := StartService(ctx, dir, "api", "bash", "sleep 60", "", "", 0); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("expected a second start to be refused, got %v", err)
+	}
+	if log, err := ServiceLog(dir, "api"); err != nil || log != "booting\nready\n" {
+		t.Errorf("unexpected log %q, %v", log, err)
+	}
+
+	if err := StopService(dir, "api"); err != nil {
+		t.Fatal(err)
+	}
+	if got := RunningServices(dir); len(got) != 0 {
+		t.Errorf("expected no running services, got %v", got)
+	}
+	if err := StopService(dir, "api"); !errors.Is(err, ErrServiceNotRunning) {
+		t.Errorf("expected ErrServiceNotRunning, got %v", err)
+	}
+}
+
+func TestStartServiceFailures(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	_, err := StartService(ctx, dir, "crash", "bash", "echo no config; exit 2", "", "log:never", 5*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "exited before it was ready") || !strings.Contains(err.Error(), "no config") {
+		t.Errorf("expected the exit and its output to be reported, got %v", err)
+	}
+
+	_, err = StartService(ctx, dir, "slow", "bash", "sleep 60", "", "log:never", 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "was not ready after 300ms") {
+		t.Errorf("expected a timeout, got %v", err)
+	}
+	if got := RunningServices(dir); len(got) != 0 {
+		t.Errorf("expected failed services to be stopped, got %v", got)
+	}
+
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	port := l.Addr().(*net.TCPAddr).Port
+	_, err = StartService(ctx, dir, "dup", "bash", "sleep 60", "", "port:"+strconv.Itoa(port), 0)
+	if err == nil || !strings.Contains(err.Error(), "already answering") {
+		t.Errorf("expected a port in use to be reported, got %v", err)
+	}
+}
+
+func TestCheckReady(t *testing.T) {
+	for _, ok := range []string{"", "port:8080", "log:Listening on", "http:http://localhost:8080/health", "http:http://127.0.0.1/"} {
+		if err := CheckReady(ok); err != nil {
+			t.Errorf("CheckReady(%q): %v", ok, err)
+		}
+	}
+	for _, bad := range []string{"port:0", "port:http", "log:", "http:http://example.com/", "tcp:80"} {
+		if err := CheckReady(bad); err == nil {
+			t.Errorf("CheckReady(%q): expected an error", bad)
+		}
+	}
+	if err := CheckServiceName("../x"); err == nil {
+		t.Error("expected a path to be rejected as a service name")
+	}
+}
@@ -0,0 +1,25 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package exec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detach starts cmd in a process group of its own, so that it is not
+// stopped by signals sent to showboat's terminal and so that stopping it
+// stops everything it started.
+func detach(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// processAlive reports whether any process in the group of pid is running.
+func processAlive(pid int) bool {
+	err := syscall.Kill(-pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func terminate(pid int) { syscall.Kill(-pid, syscall.SIGTERM) }
+
+func kill(pid int) { syscall.Kill(-pid, syscall.SIGKILL) }
@@ -106,6 +106,46 @@ func TestFullWorkflow(t *testing.T) {
 	}
 }
 
+func TestFlagLikeText(t *testing.T) {
+	tmpBin := filepath.Join(t.TempDir(), "showboat")
+	build := exec.Command("go", "build", "-o", tmpBin, ".")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build failed: %s\n%s", err, out)
+	}
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "demo.md")
+	run(t, tmpBin, "init", file, "Flags")
+
+	// Flags are read up to "--"; after it, text that looks like a flag is
+	// kept as it is. echo stands in for an interpreter so that the code is
+	// printed back.
+	run(t, tmpBin, "note", file, "--", "--workdir")
+	out := runOutput(t, tmpBin, "exec", file, "echo", "--setup", "--", "--needs")
+	if out != "-c --needs\n" {
+		t.Errorf("expected the code to be run as it is, got %q", out)
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"--workdir\n", "```echo {setup}\n--needs\n```"} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("expected %q in document, got:\n%s", want, content)
+		}
+	}
+
+	// Extract puts such text after "--", so replaying it gives the same
+	// document.
+	out = runOutput(t, tmpBin, "extract", file)
+	for _, want := range []string{"showboat note " + file + " -- --workdir", "showboat exec " + file + " echo --setup -- --needs"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in extracted commands, got:\n%s", want, out)
+		}
+	}
+}
+
 func run(t *testing.T, bin string, args ...string) {
 	t.Helper()
 	cmd := exec.Command(bin, args...)
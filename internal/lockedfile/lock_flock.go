@@ -0,0 +1,70 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package lockedfile
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Lock waits for an exclusive advisory lock on the existing file at path and
+// returns a function that releases it. The lock is held on the file itself,
+// so no lock file is left behind. As WriteFile replaces the file rather than
+// rewriting it, Lock checks after waiting that path still names the file it
+// locked, and locks the replacement if not. Once locked, it truncates
+// anything left by an Append that did not finish.
+func Lock(path string) (unlock func(), err error) {
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(f); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %s: %w", path, err)
+		}
+
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		if os.SameFile(locked, current) {
+			if err := recoverAppend(path); err != nil {
+				f.Close()
+				return nil, err
+			}
+			// Closing the file releases the lock.
+			return func() { f.Close() }, nil
+		}
+		f.Close()
+	}
+}
+
+func flock(f *os.File) error {
+	for {
+		err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// syncDir syncs a directory so that a rename in it survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing %s: %w", dir, err)
+	}
+	return nil
+}
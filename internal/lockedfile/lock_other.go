@@ -0,0 +1,26 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package lockedfile
+
+import "os"
+
+// Lock checks that path exists and returns a no-op unlock function. Advisory
+// locks are only taken on systems with flock; elsewhere, including Windows,
+// concurrent writers are not excluded, although WriteFile still never leaves
+// a partly written file. Like the flock version, it truncates anything left
+// by an Append that did not finish.
+func Lock(path string) (unlock func(), err error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	if err := recoverAppend(path); err != nil {
+		return nil, err
+	}
+	return func() {}, nil
+}
+
+// syncDir does nothing, as directories cannot be opened and synced on every
+// system. The rename itself is still atomic.
+func syncDir(dir string) error {
+	return nil
+}
@@ -0,0 +1,207 @@
+// Package lockedfile reads and writes files that several showboat processes
+// may change at once.
+//
+// Lock takes an advisory lock that other showboat processes respect, and
+// WriteFile replaces a file atomically, so that a reader or a crash never
+// sees a partly written document. Append adds to the end of a file without
+// rewriting what is already there, and ReadFile and Lock see to it that an
+// Append cut short by a crash is never seen either.
+package lockedfile
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// WriteFile writes data to a temporary file in the same directory as path,
+// syncs it to disk and renames it over path. An existing file keeps its
+// permissions; a new file is created with perm.
+func WriteFile(path string, data []byte, perm os.FileMode) error {
+	if fi, err := os.Stat(path); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	// Removing the temporary file fails harmlessly once it has been renamed.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("syncing %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("replacing %s: %w", path, err)
+	}
+	return syncDir(dir)
+}
+
+// ErrChanged is returned by Append when the file is not the expected length
+// or does not end with the expected bytes.
+var ErrChanged = errors.New("file has changed")
+
+// Append writes data to the end of the file at path, provided the file is
+// still size bytes long and ends with tail, and syncs it to disk. Otherwise
+// it writes nothing and returns ErrChanged.
+//
+// Before writing, Append records size and a hash of the file so far in a
+// file next to path (see AppendRecord), and it removes the record once data
+// is safely on disk. If showboat crashes in between, ReadFile ignores
+// whatever was appended and the next Lock truncates it, so a crash leaves
+// the old file as WriteFile would. A record whose hash no longer matches
+// the start of the file, such as one left next to a document that was
+// deleted and created again, is ignored.
+func Append(path string, size int64, tail, data []byte) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	if fi.Size() != size {
+		return ErrChanged
+	}
+	prefix, err := io.ReadAll(io.NewSectionReader(f, 0, size))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	if !bytes.HasSuffix(prefix, tail) {
+		return ErrChanged
+	}
+
+	if err := WriteFile(AppendRecord(path), appendRecordData(prefix), 0644); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(data, size); err != nil {
+		return errors.Join(fmt.Errorf("writing %s: %w", path, err), truncate(f, path))
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("syncing %s: %w", path, err), truncate(f, path))
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("writing %s: %w", path, err)
+	}
+	return os.Remove(AppendRecord(path))
+}
+
+// AppendRecord returns the path of the file in which Append records the
+// length of the file at path while it appends to it.
+func AppendRecord(path string) string {
+	return path + ".append"
+}
+
+// appendRecordData returns what Append records before appending to a file
+// whose content so far is prefix: its length and SHA-256 hash.
+func appendRecordData(prefix []byte) []byte {
+	sum := sha256.Sum256(prefix)
+	return []byte(strconv.Itoa(len(prefix)) + " " + hex.EncodeToString(sum[:]))
+}
+
+// appendedSize returns the length the file at path had before an Append
+// that has not finished, given the file's current content, or -1 if there
+// is none. stale reports a record that does not match content, which
+// belongs to a file that has since been replaced.
+func appendedSize(path string, content []byte) (size int64, stale bool, err error) {
+	data, err := os.ReadFile(AppendRecord(path))
+	if errors.Is(err, fs.ErrNotExist) {
+		return -1, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	n, _, _ := strings.Cut(string(data), " ")
+	size, err = strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("reading %s: %w", AppendRecord(path), err)
+	}
+	if size < 0 || size > int64(len(content)) || !bytes.Equal(appendRecordData(content[:size]), data) {
+		return -1, true, nil
+	}
+	return size, false, nil
+}
+
+// truncate cuts the file back to the length recorded by an unfinished
+// Append, and removes the record.
+func truncate(f *os.File, path string) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	content, err := io.ReadAll(io.NewSectionReader(f, 0, fi.Size()))
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", path, err)
+	}
+	size, stale, err := appendedSize(path, content)
+	if err != nil {
+		return err
+	}
+	if stale {
+		return os.Remove(AppendRecord(path))
+	}
+	if size < 0 {
+		return nil
+	}
+	if err := f.Truncate(size); err != nil {
+		return fmt.Errorf("truncating %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("syncing %s: %w", path, err)
+	}
+	return os.Remove(AppendRecord(path))
+}
+
+// recoverAppend undoes an Append to the file at path that did not finish,
+// such as because showboat crashed. It must only be called with the file
+// locked, so that it cannot undo an Append still in progress.
+func recoverAppend(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+	defer f.Close()
+	return truncate(f, path)
+}
+
+// ReadFile reads the file at path like os.ReadFile, except that it leaves
+// out anything added by an Append that has not finished.
+func ReadFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	size, _, err := appendedSize(path, data)
+	if err != nil {
+		return nil, err
+	}
+	if size >= 0 && size < int64(len(data)) {
+		data = data[:size]
+	}
+	return data, nil
+}
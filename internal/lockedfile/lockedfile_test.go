@@ -0,0 +1,196 @@
+package lockedfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "doc.md")
+
+	if err := WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "two\n" {
+		t.Errorf("expected new content, got %q", data)
+	}
+	if runtime.GOOS != "windows" {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != 0600 {
+			t.Errorf("expected permissions to be kept, got %v", fi.Mode().Perm())
+		}
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected no temporary files left behind, got %v", entries)
+	}
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Append(path, 4, []byte("ne\n"), []byte("two\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := Append(path, 4, []byte("ne\n"), []byte("three\n")); !errors.Is(err, ErrChanged) {
+		t.Errorf("expected ErrChanged for the wrong size, got %v", err)
+	}
+	if err := Append(path, 8, []byte("one\n"), []byte("three\n")); !errors.Is(err, ErrChanged) {
+		t.Errorf("expected ErrChanged for the wrong tail, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\ntwo\n" {
+		t.Errorf("expected one append, got %q", data)
+	}
+	if _, err := os.Stat(AppendRecord(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the append record to be removed, got %v", err)
+	}
+}
+
+func TestAppendCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	// What a crash part way through Append leaves behind.
+	if err := os.WriteFile(path, []byte("one\ntw"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(AppendRecord(path), appendRecordData([]byte("one\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\n" {
+		t.Errorf("expected ReadFile to leave out the partial append, got %q", data)
+	}
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "one\n" {
+		t.Errorf("expected Lock to truncate the partial append, got %q", data)
+	}
+	if _, err := os.Stat(AppendRecord(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the append record to be removed, got %v", err)
+	}
+}
+
+func TestAppendStaleRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "doc.md")
+	// A record left by a crash next to a document that was then deleted
+	// and created again does not apply to the new one.
+	if err := os.WriteFile(AppendRecord(path), appendRecordData([]byte("old")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("new document\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new document\n" {
+		t.Errorf("expected ReadFile to ignore the stale record, got %q", data)
+	}
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "new document\n" {
+		t.Errorf("expected Lock to leave the file alone, got %q", data)
+	}
+	if _, err := os.Stat(AppendRecord(path)); !os.IsNotExist(err) {
+		t.Errorf("expected the stale record to be removed, got %v", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	switch runtime.GOOS {
+	case "darwin", "dragonfly", "freebsd", "linux", "netbsd", "openbsd":
+	default:
+		t.Skip("no advisory locks on " + runtime.GOOS)
+	}
+	path := filepath.Join(t.TempDir(), "doc.md")
+	if err := os.WriteFile(path, []byte("one\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := Lock(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		unlock2, err := Lock(path)
+		if err != nil {
+			t.Error(err)
+		} else {
+			unlock2()
+		}
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the second Lock to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Replace the file while the lock is held, as a command does; the
+	// waiter must end up holding a lock on the new file.
+	if err := WriteFile(path, []byte("two\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the second Lock to succeed after unlock")
+	}
+
+	if _, err := Lock(filepath.Join(t.TempDir(), "missing.md")); err == nil {
+		t.Error("expected error locking a missing file")
+	}
+}
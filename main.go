@@ -5,8 +5,12 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/simonw/showboat/cmd"
+	"github.com/simonw/showboat/markdown"
 )
 
 //go:embed help.txt
@@ -29,18 +33,129 @@ func main() {
 
 	switch args[0] {
 	case "init":
+		args, template := extractValue(args, "--template")
+		args, metaArgs := extractValues(args, "--meta")
+		args, gitState := extractFlag(args, "--git-state")
+		args = positional(args)
 		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: showboat init <file> <title>")
+			fmt.Fprintln(os.Stderr, "usage: showboat init <file> <title> [--template <name|path>] [--meta <key>=<value>]... [--git-state]")
 			os.Exit(1)
 		}
-		if err := cmd.Init(args[1], args[2], version); err != nil {
+		var meta markdown.Metadata
+		for _, kv := range metaArgs {
+			key, value, _ := strings.Cut(kv, "=")
+			if err := meta.Set(key, value); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := cmd.InitWithOptions(args[1], args[2], version, cmd.InitOptions{Template: template, Workdir: workdir, Metadata: meta, GitState: gitState}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "meta":
+		args = positional(args)
+		switch {
+		case len(args) == 2:
+			meta, err := cmd.Meta(args[1])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, key := range markdown.MetadataKeys {
+				if v, _ := meta.Get(key); v != "" {
+					fmt.Printf("%s=%s\n", key, v)
+				}
+			}
+		case len(args) == 4 && args[1] == "get":
+			value, err := cmd.MetaGet(args[2], args[3])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Println(value)
+		case len(args) == 5 && args[1] == "set":
+			if err := cmd.MetaSet(args[2], args[3], args[4]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "usage: showboat meta <file> | meta get <file> <key> | meta set <file> <key> <value>")
+			os.Exit(1)
+		}
+
+	case "service":
+		args, region := extractValue(args, "--region")
+		args, port := extractValue(args, "--port")
+		args, logText := extractValue(args, "--log")
+		args, httpURL := extractValue(args, "--http")
+		args, timeoutFlag := extractValue(args, "--timeout")
+		args, entryID := extractValue(args, "--id")
+		args = positional(args)
+		switch {
+		case len(args) >= 4 && args[1] == "start":
+			code, err := getTextArg(args[4:])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			var timeout time.Duration
+			if timeoutFlag != "" {
+				if timeout, err = time.ParseDuration(timeoutFlag); err != nil {
+					fmt.Fprintf(os.Stderr, "error: invalid --timeout: %v\n", err)
+					os.Exit(1)
+				}
+			}
+			opts := cmd.ServiceOptions{Port: port, Log: logText, HTTP: httpURL, Timeout: timeout, Region: region, ID: entryID}
+			output, err := cmd.ServiceStartWithOptions(args[2], args[3], code, workdir, opts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(output)
+		case len(args) == 4 && args[1] == "stop":
+			if err := cmd.ServiceStop(args[2], args[3]); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		case len(args) == 4 && args[1] == "logs":
+			logs, err := cmd.ServiceLogs(args[2], args[3])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(logs)
+		case len(args) == 3 && args[1] == "list":
+			for _, name := range cmd.Services(args[2]) {
+				fmt.Println(name)
+			}
+		default:
+			fmt.Fprintln(os.Stderr, "usage: showboat service start <file> <name> [command] [--port <port>|--log <text>|--http <url>] [--timeout <duration>] [--id <id>]")
+			fmt.Fprintln(os.Stderr, "       showboat service stop|logs <file> <name>")
+			fmt.Fprintln(os.Stderr, "       showboat service list <file>")
+			os.Exit(1)
+		}
+
+	case "templates":
+		dir := "."
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		templates, err := cmd.Templates(dir)
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		for _, t := range templates {
+			fmt.Printf("%s\t%s\n", t.Name, t.Path)
+		}
 
 	case "note":
+		args, region := extractValue(args, "--region")
+		args = positional(args)
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat note <file> [text]")
+			fmt.Fprintln(os.Stderr, "usage: showboat note <file> [text] [--region <id>]")
 			os.Exit(1)
 		}
 		text, err := getTextArg(args[2:])
@@ -48,22 +163,44 @@ func main() {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		if err := cmd.Note(args[1], text); err != nil {
+		if err := cmd.NoteWithOptions(args[1], text, cmd.EntryOptions{Region: region}); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "exec":
-		if len(args) < 3 {
-			fmt.Fprintln(os.Stderr, "usage: showboat exec <file> <lang> [code]")
+		args, provenance := extractFlag(args, "--provenance")
+		args, region := extractValue(args, "--region")
+		args, setup := extractFlag(args, "--setup")
+		args, teardown := extractFlag(args, "--teardown")
+		args, needs := extractValues(args, "--needs")
+		args, entryID := extractValue(args, "--id")
+		args = positional(args)
+		if len(args) < 3 || (setup && teardown) {
+			fmt.Fprintln(os.Stderr, "usage: showboat exec <file> <lang> [code] [--setup|--teardown] [--needs <id>[,<id>...]] [--id <id>] [--provenance] [--region <id>]")
 			os.Exit(1)
 		}
+		role := ""
+		if setup {
+			role = "setup"
+		} else if teardown {
+			role = "teardown"
+		}
 		code, err := getTextArg(args[3:])
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		output, exitCode, err := cmd.Exec(args[1], args[2], code, workdir)
+		var needIDs []string
+		for _, n := range needs {
+			for _, id := range strings.Split(n, ",") {
+				if id = strings.TrimSpace(id); id != "" {
+					needIDs = append(needIDs, id)
+				}
+			}
+		}
+		opts := cmd.EntryOptions{Provenance: provenance, Region: region, Role: role, Needs: needIDs, ID: entryID}
+		output, exitCode, err := cmd.ExecWithOptions(args[1], args[2], code, workdir, opts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
@@ -74,8 +211,12 @@ func main() {
 		}
 
 	case "image":
+		args, provenance := extractFlag(args, "--provenance")
+		args, region := extractValue(args, "--region")
+		args, entryID := extractValue(args, "--id")
+		args = positional(args)
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat image <file> <image|![alt](image)>")
+			fmt.Fprintln(os.Stderr, "usage: showboat image <file> <image|![alt](image)> [--id <id>] [--provenance] [--region <id>]")
 			os.Exit(1)
 		}
 		input, err := getTextArg(args[2:])
@@ -83,14 +224,18 @@ func main() {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
-		if err := cmd.Image(args[1], input, workdir); err != nil {
+		opts := cmd.EntryOptions{Provenance: provenance, Region: region, ID: entryID}
+		if err := cmd.ImageWithOptions(args[1], input, workdir, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "verify":
+		args, region := extractValue(args, "--region")
+		args, failFast := extractFlag(args, "--fail-fast")
+		args, chain := extractFlag(args, "--chain")
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat verify <file> [--output <new>]")
+			fmt.Fprintln(os.Stderr, "usage: showboat verify <file> [--output <new>] [--fail-fast] [--chain] [--region <id>]")
 			os.Exit(1)
 		}
 		file := args[1]
@@ -102,41 +247,376 @@ func main() {
 				i++
 			}
 		}
-		diffs, err := cmd.Verify(file, outputFile, workdir)
+		verifyOpts := cmd.VerifyOptions{Region: region, FailFast: failFast, Chain: chain}
+		problems, err := cmd.IntegrityWithOptions(file, verifyOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, p := range problems {
+			fmt.Println(p.String())
+		}
+		warnings, err := cmd.CheckGitState(file, workdir, verifyOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, w := range warnings {
+			fmt.Println(w.String())
+		}
+		diffs, err := cmd.VerifyWithOptions(file, outputFile, workdir, verifyOpts)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 		if len(diffs) > 0 {
-			for _, d := range diffs {
+			// Differences in interpreter versions explain most changed output.
+			drift, err := cmd.CheckEnv(file, verifyOpts)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			for _, d := range drift {
 				fmt.Println(d.String())
 			}
+		}
+		for _, d := range diffs {
+			fmt.Println(d.String())
+		}
+		if len(problems) > 0 || len(diffs) > 0 {
+			os.Exit(1)
+		}
+
+	case "git-state":
+		args, region := extractValue(args, "--region")
+		args, entryID := extractValue(args, "--id")
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat git-state <file> [--id <id>] [--region <id>]")
+			os.Exit(1)
+		}
+		if err := cmd.GitStateWithOptions(args[1], workdir, cmd.EntryOptions{Region: region, ID: entryID}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "env":
+		args, region := extractValue(args, "--region")
+		args, entryID := extractValue(args, "--id")
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat env <file> [--id <id>] [--region <id>]")
+			os.Exit(1)
+		}
+		if err := cmd.EnvWithOptions(args[1], workdir, cmd.EntryOptions{Region: region, ID: entryID}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
 
 	case "pop":
+		args, region := extractValue(args, "--region")
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat pop <file> [--region <id>]")
+			os.Exit(1)
+		}
+		if err := cmd.PopWithOptions(args[1], cmd.EntryOptions{Region: region}); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "undo":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat undo <file>")
+			os.Exit(1)
+		}
+		if err := cmd.Undo(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "redo":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat redo <file>")
+			os.Exit(1)
+		}
+		if err := cmd.Redo(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "log":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat pop <file>")
+			fmt.Fprintln(os.Stderr, "usage: showboat log <file>")
 			os.Exit(1)
 		}
-		if err := cmd.Pop(args[1]); err != nil {
+		records, err := cmd.Log(args[1])
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+		for _, r := range records {
+			fmt.Println(r.String())
+		}
+
+	case "seal":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat seal <file>")
+			os.Exit(1)
+		}
+		if err := cmd.Seal(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "unseal":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat unseal <file>")
+			os.Exit(1)
+		}
+		if err := cmd.Unseal(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "keygen":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat keygen <keyfile>")
+			os.Exit(1)
+		}
+		if err := cmd.Keygen(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "sign":
+		if len(args) < 4 || args[2] != "--key" {
+			fmt.Fprintln(os.Stderr, "usage: showboat sign <file> --key <keyfile>")
+			os.Exit(1)
+		}
+		if err := cmd.Sign(args[1], args[3]); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "check-signature":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat check-signature <file> [--key <keyfile>]")
+			os.Exit(1)
+		}
+		keyFile := ""
+		for i := 2; i < len(args); i++ {
+			if args[i] == "--key" && i+1 < len(args) {
+				keyFile = args[i+1]
+				i++
+			}
+		}
+		fingerprint, err := cmd.CheckSignature(args[1], keyFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("signature OK: signed by %s\n", fingerprint)
+
+	case "timeline":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat timeline <file>")
+			os.Exit(1)
+		}
+		entries, err := cmd.Timeline(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if err := cmd.WriteTimeline(os.Stdout, entries); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "export":
+		args, html := extractFlag(args, "--html")
+		args, ipynb := extractFlag(args, "--ipynb")
+		args, jsonFormat := extractFlag(args, "--json")
+		args, goTest := extractFlag(args, "--go-test")
+		args, verify := extractFlag(args, "--verify")
+		args, fixturesFlag := extractValue(args, "--fixtures")
+		format, formats := "", 0
+		for _, f := range []struct {
+			set  bool
+			name string
+		}{{html, "html"}, {ipynb, "ipynb"}, {jsonFormat, "json"}, {goTest, "go-test"}} {
+			if f.set {
+				format = f.name
+				formats++
+			}
+		}
+		if len(args) < 2 || formats != 1 {
+			fmt.Fprintln(os.Stderr, "usage: showboat export <file> --html|--ipynb|--json|--go-test [--verify] [--fixtures show|collapse|hide] [--package <name>] [--output <path>]")
+			os.Exit(1)
+		}
+		exportOutput := ""
+		exportPackage := ""
+		exportRemaining := args[2:]
+		for i := 0; i < len(exportRemaining); i++ {
+			if exportRemaining[i] == "--output" && i+1 < len(exportRemaining) {
+				exportOutput = exportRemaining[i+1]
+				i++
+			} else if exportRemaining[i] == "--package" && i+1 < len(exportRemaining) {
+				exportPackage = exportRemaining[i+1]
+				i++
+			}
+		}
+		var out io.Writer = os.Stdout
+		if exportOutput != "" {
+			f, err := os.Create(exportOutput)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+			defer f.Close()
+			out = f
+		}
+		opts := cmd.ExportOptions{Verify: verify, Workdir: workdir, Package: exportPackage, Fixtures: fixturesFlag}
+		if err := cmd.Export(out, args[1], format, opts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "import":
+		args, _ = extractFlag(args, "--ipynb")
+		args, jsonFormat := extractFlag(args, "--json")
+		args, transcript := extractFlag(args, "--transcript")
+		args, execute := extractFlag(args, "--execute")
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat import <notebook.ipynb> | --json <doc.json> | --transcript <file.txt> [--execute] [--output <file>]")
+			os.Exit(1)
+		}
+		src := args[1]
+		format := "ipynb"
+		if jsonFormat {
+			format = "json"
+		} else if transcript {
+			format = "transcript"
+		}
+		importOutput := strings.TrimSuffix(src, filepath.Ext(src)) + ".md"
+		importRemaining := args[2:]
+		for i := 0; i < len(importRemaining); i++ {
+			if importRemaining[i] == "--output" && i+1 < len(importRemaining) {
+				importOutput = importRemaining[i+1]
+				i++
+			}
+		}
+		importOpts := cmd.ImportOptions{Execute: execute, Workdir: workdir}
+		if err := cmd.ImportWithOptions(src, importOutput, format, version, importOpts); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "diff":
+		args, jsonOutput := extractFlag(args, "--json")
+		if len(args) < 3 {
+			fmt.Fprintln(os.Stderr, "usage: showboat diff <old> <new> [--json]")
+			os.Exit(1)
+		}
+		changes, err := cmd.DiffDocuments(args[1], args[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		if jsonOutput {
+			if err := cmd.WriteDiffJSON(os.Stdout, args[1], args[2], changes); err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
+			}
+		} else {
+			for _, c := range changes {
+				fmt.Println(c.String())
+			}
+		}
+		if len(changes) > 0 {
+			os.Exit(1)
+		}
+
+	case "merge":
+		if len(args) < 4 {
+			fmt.Fprintln(os.Stderr, "usage: showboat merge <base> <ours> <theirs> [--output <file>]")
+			os.Exit(1)
+		}
+		mergeOutput := args[2]
+		mergeRemaining := args[4:]
+		for i := 0; i < len(mergeRemaining); i++ {
+			if mergeRemaining[i] == "--output" && i+1 < len(mergeRemaining) {
+				mergeOutput = mergeRemaining[i+1]
+				i++
+			}
+		}
+		conflicts, err := cmd.Merge(args[1], args[2], args[3], mergeOutput)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		for _, c := range conflicts {
+			fmt.Println(c.String())
+		}
+		if len(conflicts) > 0 {
+			os.Exit(1)
+		}
+
+	case "adopt":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, "usage: showboat adopt <file> [--lang <lang>]... [--replace-samples]")
+			os.Exit(1)
+		}
+		var langs []string
+		var adoptOpts cmd.AdoptOptions
+		adoptRemaining := args[2:]
+		for i := 0; i < len(adoptRemaining); i++ {
+			switch {
+			case adoptRemaining[i] == "--lang" && i+1 < len(adoptRemaining):
+				langs = append(langs, strings.Split(adoptRemaining[i+1], ",")...)
+				i++
+			case adoptRemaining[i] == "--replace-samples":
+				adoptOpts.ReplaceSamples = true
+			}
+		}
+		if len(langs) == 0 {
+			langs = []string{"bash"}
+		}
+		n, err := cmd.AdoptWithOptions(args[1], langs, workdir, adoptOpts)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("recorded output for %d code blocks\n", n)
 
 	case "extract":
 		if len(args) < 2 {
-			fmt.Fprintln(os.Stderr, "usage: showboat extract <file> [--filename <name>]")
+			fmt.Fprintln(os.Stderr, "usage: showboat extract <file> [--filename <name>] [--format commands|script]")
 			os.Exit(1)
 		}
 		extractFile := args[1]
 		extractOutput := ""
+		extractFormat := "commands"
 		extractRemaining := args[2:]
 		for i := 0; i < len(extractRemaining); i++ {
 			if extractRemaining[i] == "--filename" && i+1 < len(extractRemaining) {
 				extractOutput = extractRemaining[i+1]
 				i++
+			} else if extractRemaining[i] == "--format" && i+1 < len(extractRemaining) {
+				extractFormat = extractRemaining[i+1]
+				i++
+			}
+		}
+		switch extractFormat {
+		case "commands":
+		case "script":
+			script, err := cmd.ExtractScript(extractFile)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+				os.Exit(1)
 			}
+			fmt.Print(script)
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "error: unknown extract format: %s\n", extractFormat)
+			os.Exit(1)
 		}
 		commands, err := cmd.Extract(extractFile, extractOutput)
 		if err != nil {
@@ -159,10 +639,14 @@ func main() {
 }
 
 // parseGlobalFlags extracts global flags from args and returns the remaining
-// args, workdir value, and whether to show version.
+// args, workdir value, and whether to show version. Like the flags of each
+// command, global flags are not looked for after "--".
 func parseGlobalFlags(args []string) (remaining []string, workdir string, showVersion bool) {
 	for i := 0; i < len(args); i++ {
-		if args[i] == "--workdir" && i+1 < len(args) {
+		if args[i] == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		} else if args[i] == "--workdir" && i+1 < len(args) {
 			workdir = args[i+1]
 			i++ // skip value
 		} else if args[i] == "--version" {
@@ -174,6 +658,75 @@ func parseGlobalFlags(args []string) (remaining []string, workdir string, showVe
 	return remaining, workdir, showVersion
 }
 
+// extractValue removes flag and the value after it from args, returning the
+// remaining args and the value, or "" if the flag is absent. Arguments after
+// "--" are left alone, so that text such as code can look like a flag; see
+// positional.
+func extractValue(args []string, flag string) ([]string, string) {
+	var remaining []string
+	value := ""
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		} else if args[i] == flag && i+1 < len(args) {
+			value = args[i+1]
+			i++
+		} else {
+			remaining = append(remaining, args[i])
+		}
+	}
+	return remaining, value
+}
+
+// extractValues is extractValue for a flag that may be given more than once.
+func extractValues(args []string, flag string) ([]string, []string) {
+	var remaining, values []string
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		} else if args[i] == flag && i+1 < len(args) {
+			values = append(values, args[i+1])
+			i++
+		} else {
+			remaining = append(remaining, args[i])
+		}
+	}
+	return remaining, values
+}
+
+// extractFlag removes every occurrence of a boolean flag before "--" from
+// args and reports whether it was present.
+func extractFlag(args []string, flag string) ([]string, bool) {
+	var remaining []string
+	found := false
+	for i, a := range args {
+		if a == "--" {
+			remaining = append(remaining, args[i:]...)
+			break
+		} else if a == flag {
+			found = true
+		} else {
+			remaining = append(remaining, a)
+		}
+	}
+	return remaining, found
+}
+
+// positional removes the first "--" from args once every flag has been
+// extracted, leaving the positional arguments. Everything after "--" is
+// positional even if it looks like a flag, as in
+// "showboat exec demo.md bash --setup -- --version".
+func positional(args []string) []string {
+	for i, a := range args {
+		if a == "--" {
+			return append(append([]string{}, args[:i]...), args[i+1:]...)
+		}
+	}
+	return args
+}
+
 // getTextArg returns args[0] if present, otherwise reads all of stdin.
 func getTextArg(args []string) (string, error) {
 	if len(args) > 0 {
@@ -5,32 +5,111 @@ type Block interface {
 	Type() string
 }
 
-// TitleBlock is the document header: an H1 title and a timestamp.
+// TitleBlock is the document header: an H1 title and a timestamp, followed
+// by the document ID and any metadata in comments.
 type TitleBlock struct {
 	Title      string
 	Timestamp  string
 	Version    string
 	DocumentID string
+	Metadata   Metadata
 }
 
 func (b TitleBlock) Type() string { return "title" }
 
 // CommentaryBlock is free-form markdown prose.
+// ID is the stable entry ID and Hash the entry's link in the document's hash
+// chain; both are recorded in an entry marker comment.
 type CommentaryBlock struct {
 	Text string
+	ID   string
+	Hash string
 }
 
 func (b CommentaryBlock) Type() string { return "commentary" }
 
 // CodeBlock is an executable fenced code block.
+// ID is the stable entry ID shared with the output that follows it, and Hash
+// is the entry's link in the document's hash chain.
+// Provenance is optional and describes the run that produced the output.
+// Service is set for blocks that start a background service (RoleService).
+// Needs lists the IDs of earlier entries that must pass before verify runs
+// the block, comma-separated; see NeedsList.
+// Role marks a block that is not an ordinary step of the demo, such as
+// RoleGitState; it is written after the language as "{role}".
 type CodeBlock struct {
-	Lang    string
-	Code    string
-	IsImage bool
+	Lang       string
+	Code       string
+	IsImage    bool
+	Role       string
+	ID         string
+	Provenance *Provenance
+	Service    *Service
+	Needs      string
+	Hash       string
 }
 
+// Roles of code blocks whose output records the conditions a demo was run
+// in rather than the result of a step. Verify does not re-run them.
+const (
+	RoleGitState = "git-state" // the git repository's commit and changes
+	RoleEnv      = "env"       // the OS and interpreter versions
+)
+
+// Roles of code blocks that prepare for the demo or clean up after it.
+// Verify runs setup blocks before all other blocks and teardown blocks after
+// them, wherever they are in the document.
+const (
+	RoleSetup    = "setup"
+	RoleTeardown = "teardown"
+)
+
+// RoleService marks a code block whose code is a long-running process that
+// later blocks depend on, such as a web server. Verify starts it with the
+// setup blocks and stops it after the teardown blocks.
+const RoleService = "service"
+
 func (b CodeBlock) Type() string { return "code" }
 
+// IsRecord reports whether the block records the conditions the demo ran
+// in, such as its git state, rather than being a step to run.
+func (b CodeBlock) IsRecord() bool {
+	return b.Role == RoleGitState || b.Role == RoleEnv
+}
+
+// NeedsList returns the entry IDs in Needs.
+func (b CodeBlock) NeedsList() []string {
+	return splitTags(b.Needs)
+}
+
+// IsFixture reports whether the block is a setup or teardown block.
+func (b CodeBlock) IsFixture() bool {
+	return b.Role == RoleSetup || b.Role == RoleTeardown
+}
+
+// Provenance records when, where and how an entry was produced. It is stored
+// in the entry marker comment and is not rendered.
+type Provenance struct {
+	Start       string // RFC 3339 start time
+	Duration    string // as formatted by time.Duration.String
+	ExitCode    int
+	Host        string
+	Dir         string
+	Interpreter string // first line of "<lang> --version"
+}
+
+// Service names a background service and how to tell that it is ready. It is
+// stored in the entry marker comment.
+type Service struct {
+	Name string
+
+	// Ready is the readiness check: "port:<port>" for a TCP port on
+	// localhost accepting connections, "log:<text>" for text appearing in the
+	// service's output, or "http:<url>" for a localhost URL returning 200.
+	// Empty means the service is ready as soon as it has started.
+	Ready string
+}
+
 // OutputBlock is captured text output from a code block.
 type OutputBlock struct {
 	Content string
@@ -45,3 +124,21 @@ type ImageOutputBlock struct {
 }
 
 func (b ImageOutputBlock) Type() string { return "output-image" }
+
+// SignatureBlock is an ed25519 signature over everything in the document
+// that precedes it. PublicKey and Signature are unpadded base64.
+type SignatureBlock struct {
+	PublicKey string
+	Signature string
+}
+
+func (b SignatureBlock) Type() string { return "signature" }
+
+// SealBlock marks a document as final. Hash is the hash of everything in the
+// document that precedes it; showboat refuses to change a sealed document.
+type SealBlock struct {
+	Hash      string
+	Timestamp string
+}
+
+func (b SealBlock) Type() string { return "seal" }
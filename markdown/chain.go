@@ -0,0 +1,176 @@
+package markdown
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+// Each entry's Hash covers the entry's markdown (including its marker
+// attributes other than the hash itself) and the hash of the entry before it.
+// The first entry chains to a hash of the title block, which holds the
+// title, its timestamp, the document ID and the metadata, so editing the
+// title or editing, inserting or removing any entry breaks every link that
+// follows it.
+//
+// Documents chained by older versions of showboat chain the first entry to
+// the document ID alone. They are still checked that way, which leaves
+// their title outside the chain, until Rechain chains them afresh.
+
+// HashEntry returns the chain hash for the blocks of one entry. prev is the
+// hash of the previous entry, or the chain anchor for the first entry.
+func HashEntry(prev string, entry []Block) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", prev)
+	for _, b := range entry {
+		writeBlock(h, withHash(b, ""))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// withHash returns b with its chain hash replaced. Blocks that do not carry a
+// hash are returned unchanged.
+func withHash(b Block, hash string) Block {
+	switch blk := b.(type) {
+	case CommentaryBlock:
+		blk.Hash = hash
+		return blk
+	case CodeBlock:
+		blk.Hash = hash
+		return blk
+	}
+	return b
+}
+
+// entryHash returns the hash recorded on the first block of e.
+func entryHash(e Entry) string {
+	switch b := e.Blocks[0].(type) {
+	case CommentaryBlock:
+		return b.Hash
+	case CodeBlock:
+		return b.Hash
+	}
+	return ""
+}
+
+// titleAnchor returns the value the first entry of a new chain chains to: a
+// hash of the title block, or "" for blocks without one, such as a region.
+func titleAnchor(blocks []Block) string {
+	if len(blocks) == 0 {
+		return ""
+	}
+	tb, ok := blocks[0].(TitleBlock)
+	if !ok {
+		return ""
+	}
+	h := sha256.New()
+	writeBlock(h, tb)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// chainAnchor returns the value the first entry of blocks chains to: the
+// title anchor, or the document ID if the first hashed entry was chained
+// to that by an older version of showboat.
+func chainAnchor(blocks []Block) string {
+	anchor := titleAnchor(blocks)
+	if anchor == "" {
+		return ""
+	}
+	legacy := blocks[0].(TitleBlock).DocumentID
+	prev, prevLegacy := anchor, legacy
+	for _, e := range Entries(blocks) {
+		if h := entryHash(e); h != "" {
+			if h != HashEntry(prev, e.Blocks) && h == HashEntry(prevLegacy, e.Blocks) {
+				return legacy
+			}
+			return anchor
+		}
+		prev, prevLegacy = HashEntry(prev, e.Blocks), HashEntry(prevLegacy, e.Blocks)
+	}
+	return anchor
+}
+
+// ChainHead returns the hash that the next entry appended to blocks should
+// chain to: the recorded hash of the last entry when it has one, otherwise
+// the hash computed from its content.
+func ChainHead(blocks []Block) string {
+	prev := chainAnchor(blocks)
+	for _, e := range Entries(blocks) {
+		if h := entryHash(e); h != "" {
+			prev = h
+		} else {
+			prev = HashEntry(prev, e.Blocks)
+		}
+	}
+	return prev
+}
+
+// ChainEntry returns the blocks of a new entry with the first block's Hash
+// set so that it chains to the end of blocks.
+func ChainEntry(blocks []Block, entry []Block) []Block {
+	out := append([]Block{}, entry...)
+	out[0] = withHash(out[0], HashEntry(ChainHead(blocks), entry))
+	return out
+}
+
+// Rechain recomputes the hash of every entry that records one, for use after
+// a deliberate change such as replacing outputs or changing the title.
+// Entries before the first hashed entry are left without hashes. The chain
+// always starts from the title anchor, even in a document that was chained
+// to its document ID.
+func Rechain(blocks []Block) []Block {
+	out := append([]Block{}, blocks...)
+	prev := titleAnchor(out)
+	for _, e := range Entries(out) {
+		if h := entryHash(e); h != "" {
+			h = HashEntry(prev, e.Blocks)
+			out[e.Start] = withHash(out[e.Start], h)
+			prev = h
+		} else {
+			prev = HashEntry(prev, e.Blocks)
+		}
+	}
+	return out
+}
+
+// ChainError describes an entry whose recorded hash does not match the
+// document.
+type ChainError struct {
+	Entry  Entry
+	Reason string
+}
+
+// CheckChain returns an error for every entry whose recorded hash does not
+// match its content and the entry before it. Once an entry with a hash has
+// been seen, later entries without one are errors too, since stripping a hash
+// must not hide an edit.
+func CheckChain(blocks []Block) []ChainError {
+	var errs []ChainError
+	prev := chainAnchor(blocks)
+	chained := false
+	for _, e := range Entries(blocks) {
+		computed := HashEntry(prev, e.Blocks)
+		recorded := entryHash(e)
+		switch {
+		case recorded == "" && chained:
+			errs = append(errs, ChainError{Entry: e, Reason: "missing hash"})
+		case recorded != "" && recorded != computed:
+			errs = append(errs, ChainError{Entry: e, Reason: "hash does not match content"})
+		}
+		if recorded != "" {
+			chained = true
+			prev = recorded
+		} else {
+			prev = computed
+		}
+	}
+	return errs
+}
+
+// ContentHash returns a hash of the markdown that Write produces for blocks.
+// Seals and the journal use it to identify a document's exact content.
+func ContentHash(blocks []Block) string {
+	h := sha256.New()
+	Write(h, blocks)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,120 @@
+package markdown
+
+import "testing"
+
+func chainedDocument() []Block {
+	blocks := []Block{TitleBlock{Title: "Demo", DocumentID: "doc-uuid"}}
+	blocks = append(blocks, ChainEntry(blocks, []Block{CommentaryBlock{Text: "Intro", ID: "aaaa1111"}})...)
+	blocks = append(blocks, ChainEntry(blocks, []Block{
+		CodeBlock{Lang: "bash", Code: "echo hi", ID: "bbbb2222"},
+		OutputBlock{Content: "hi\n"},
+	})...)
+	return blocks
+}
+
+func TestChainEntry(t *testing.T) {
+	blocks := chainedDocument()
+	first := blocks[1].(CommentaryBlock)
+	if first.Hash != HashEntry(titleAnchor(blocks), []Block{CommentaryBlock{Text: "Intro", ID: "aaaa1111"}}) {
+		t.Errorf("expected first entry to chain to the title block, got %q", first.Hash)
+	}
+	second := blocks[2].(CodeBlock)
+	if second.Hash != HashEntry(first.Hash, blocks[2:4]) {
+		t.Errorf("expected second entry to chain to the first, got %q", second.Hash)
+	}
+	if ChainHead(blocks) != second.Hash {
+		t.Errorf("expected chain head to be the last entry's hash")
+	}
+	if errs := CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected intact chain, got %+v", errs)
+	}
+}
+
+func TestCheckChainDetectsEdits(t *testing.T) {
+	blocks := chainedDocument()
+	blocks[3] = OutputBlock{Content: "forged\n"}
+	errs := CheckChain(blocks)
+	if len(errs) != 1 || errs[0].Entry.ID() != "bbbb2222" {
+		t.Fatalf("expected one error for the edited entry, got %+v", errs)
+	}
+}
+
+func TestCheckChainDetectsTitleEdits(t *testing.T) {
+	for _, edit := range []func(*TitleBlock){
+		func(tb *TitleBlock) { tb.Title = "Forged" },
+		func(tb *TitleBlock) { tb.Timestamp = "2020-01-01T00:00:00Z" },
+		func(tb *TitleBlock) { tb.Metadata.Author = "someone else" },
+	} {
+		blocks := chainedDocument()
+		tb := blocks[0].(TitleBlock)
+		edit(&tb)
+		blocks[0] = tb
+		errs := CheckChain(blocks)
+		if len(errs) == 0 || errs[0].Entry.ID() != "aaaa1111" {
+			t.Errorf("expected the first entry to fail after editing the title block, got %+v", errs)
+		}
+	}
+}
+
+func TestCheckChainLegacyAnchor(t *testing.T) {
+	// Documents chained before the title block was covered start from the
+	// document ID alone.
+	blocks := []Block{TitleBlock{Title: "Demo", DocumentID: "doc-uuid"}}
+	intro := CommentaryBlock{Text: "Intro", ID: "aaaa1111"}
+	intro.Hash = HashEntry("doc-uuid", []Block{intro})
+	blocks = append(blocks, intro)
+	if errs := CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a chain anchored to the document ID to be intact, got %+v", errs)
+	}
+	blocks = append(blocks, ChainEntry(blocks, []Block{CommentaryBlock{Text: "More", ID: "bbbb2222"}})...)
+	if errs := CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected an entry appended to a legacy chain to be intact, got %+v", errs)
+	}
+	if errs := CheckChain(Rechain(blocks)); len(errs) != 0 || Rechain(blocks)[1].(CommentaryBlock).Hash == intro.Hash {
+		t.Errorf("expected rechaining to move the chain to the title anchor, got %+v", errs)
+	}
+}
+
+func TestCheckChainDetectsRemovedEntry(t *testing.T) {
+	blocks := chainedDocument()
+	blocks = append(blocks[:1], blocks[2:]...)
+	errs := CheckChain(blocks)
+	if len(errs) != 1 || errs[0].Entry.ID() != "bbbb2222" {
+		t.Fatalf("expected the entry after the removed one to fail, got %+v", errs)
+	}
+}
+
+func TestCheckChainDetectsStrippedHash(t *testing.T) {
+	blocks := chainedDocument()
+	code := blocks[2].(CodeBlock)
+	code.Hash = ""
+	blocks[2] = code
+	errs := CheckChain(blocks)
+	if len(errs) != 1 || errs[0].Reason != "missing hash" {
+		t.Fatalf("expected a missing hash error, got %+v", errs)
+	}
+}
+
+func TestCheckChainIgnoresUnhashedDocuments(t *testing.T) {
+	blocks := []Block{
+		TitleBlock{Title: "Demo"},
+		CommentaryBlock{Text: "Intro"},
+		CodeBlock{Lang: "bash", Code: "echo hi"},
+		OutputBlock{Content: "hi\n"},
+	}
+	if errs := CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected no errors for a document without hashes, got %+v", errs)
+	}
+}
+
+func TestRechain(t *testing.T) {
+	blocks := chainedDocument()
+	blocks[3] = OutputBlock{Content: "new output\n"}
+	rechained := Rechain(blocks)
+	if errs := CheckChain(rechained); len(errs) != 0 {
+		t.Errorf("expected rechained document to be intact, got %+v", errs)
+	}
+	if rechained[1].(CommentaryBlock).Hash != blocks[1].(CommentaryBlock).Hash {
+		t.Error("expected unchanged entries to keep their hashes")
+	}
+}
@@ -0,0 +1,85 @@
+package markdown
+
+// Entry is a group of blocks appended to a document by a single command:
+// a commentary block on its own, or a code block followed by its output.
+type Entry struct {
+	// Start is the index of the entry's first block in the document.
+	Start  int
+	Blocks []Block
+}
+
+// ID returns the stable ID of the entry, or "" for entries written before
+// IDs were recorded.
+func (e Entry) ID() string {
+	if len(e.Blocks) == 0 {
+		return ""
+	}
+	switch b := e.Blocks[0].(type) {
+	case CommentaryBlock:
+		return b.ID
+	case CodeBlock:
+		return b.ID
+	}
+	return ""
+}
+
+// Entries groups blocks into entries. The title, seal and signature blocks
+// are not part of any entry.
+func Entries(blocks []Block) []Entry {
+	var entries []Entry
+	for i := 0; i < len(blocks); i++ {
+		switch blocks[i].(type) {
+		case TitleBlock, SealBlock, SignatureBlock:
+			continue
+		case CodeBlock:
+			if i+1 < len(blocks) {
+				switch blocks[i+1].(type) {
+				case OutputBlock, ImageOutputBlock:
+					entries = append(entries, Entry{Start: i, Blocks: blocks[i : i+2 : i+2]})
+					i++
+					continue
+				}
+			}
+		}
+		entries = append(entries, Entry{Start: i, Blocks: blocks[i : i+1 : i+1]})
+	}
+	return entries
+}
+
+// FindEntry returns the entry with the given ID.
+func FindEntry(blocks []Block, id string) (Entry, bool) {
+	for _, e := range Entries(blocks) {
+		if id != "" && e.ID() == id {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// RunOrder returns the indexes of the code blocks that verify re-runs, in
+// the order it runs them: setup and service blocks, then the other blocks,
+// then teardown blocks, each in document order. Image blocks, blocks that
+// record the environment and code blocks without a recorded output are
+// left out, so that examples which were never meant to run, such as the
+// JSON samples in an adopted README, do not make verify fail.
+func RunOrder(blocks []Block) []int {
+	var setup, steps, teardown []int
+	for i, b := range blocks {
+		cb, ok := b.(CodeBlock)
+		if !ok || cb.IsImage || cb.IsRecord() || i+1 >= len(blocks) {
+			continue
+		}
+		if _, ok := blocks[i+1].(OutputBlock); !ok {
+			continue
+		}
+		switch cb.Role {
+		case RoleSetup, RoleService:
+			setup = append(setup, i)
+		case RoleTeardown:
+			teardown = append(teardown, i)
+		default:
+			steps = append(steps, i)
+		}
+	}
+	return append(append(setup, steps...), teardown...)
+}
@@ -0,0 +1,62 @@
+package markdown
+
+import "testing"
+
+func TestEntries(t *testing.T) {
+	blocks := []Block{
+		TitleBlock{Title: "Demo"},
+		CommentaryBlock{Text: "Intro", ID: "aaaa1111"},
+		CodeBlock{Lang: "bash", Code: "echo hi", ID: "bbbb2222"},
+		OutputBlock{Content: "hi\n"},
+		CodeBlock{Lang: "bash", Code: "shot.png", IsImage: true, ID: "cccc3333"},
+		ImageOutputBlock{AltText: "shot", Filename: "shot.png"},
+		CommentaryBlock{Text: "Legacy note"},
+	}
+	entries := Entries(blocks)
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d: %+v", len(entries), entries)
+	}
+	wantStarts := []int{1, 2, 4, 6}
+	wantIDs := []string{"aaaa1111", "bbbb2222", "cccc3333", ""}
+	wantLens := []int{1, 2, 2, 1}
+	for i, e := range entries {
+		if e.Start != wantStarts[i] || e.ID() != wantIDs[i] || len(e.Blocks) != wantLens[i] {
+			t.Errorf("entry %d: got start=%d id=%q len=%d", i, e.Start, e.ID(), len(e.Blocks))
+		}
+	}
+
+	e, ok := FindEntry(blocks, "cccc3333")
+	if !ok || e.Start != 4 {
+		t.Errorf("expected to find entry cccc3333 at 4, got %+v %v", e, ok)
+	}
+	if _, ok := FindEntry(blocks, ""); ok {
+		t.Error("expected empty ID not to match legacy entries")
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	blocks := []Block{
+		TitleBlock{Title: "Demo"},
+		CodeBlock{Lang: "bash", Code: "stop", Role: RoleTeardown},
+		OutputBlock{},
+		CodeBlock{Lang: "bash", Code: "step"},
+		OutputBlock{Content: "ok\n"},
+		CodeBlock{Lang: "bash", Code: "showboat env", Role: RoleEnv},
+		OutputBlock{Content: "os: linux/amd64\n"},
+		CodeBlock{Lang: "bash", Code: "start", Role: RoleSetup},
+		OutputBlock{},
+		CodeBlock{Lang: "bash", Code: "shot.png", IsImage: true},
+		ImageOutputBlock{Filename: "shot.png"},
+		CodeBlock{Lang: "python3", Code: "example()"},
+	}
+	got := RunOrder(blocks)
+	want := []int{7, 3, 1}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+}
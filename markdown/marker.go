@@ -0,0 +1,222 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markers are single-line HTML comments holding a name and key=value
+// attributes. They are invisible when the markdown is rendered.
+//
+// Entry markers are written on the line directly above the first block of an
+// entry and carry the entry's attributes:
+//
+//	<!-- showboat-entry id=3f2a9c1e -->
+const (
+	entryMarker     = "showboat-entry"
+	signatureMarker = "showboat-signature"
+	sealMarker      = "showboat-seal"
+)
+
+// attr is a single key=value pair in a marker comment.
+type attr struct {
+	Key   string
+	Value string
+}
+
+// formatMarker renders a marker line (without newline).
+func formatMarker(name string, attrs []attr) string {
+	var sb strings.Builder
+	sb.WriteString("<!-- ")
+	sb.WriteString(name)
+	for _, a := range attrs {
+		sb.WriteString(" ")
+		sb.WriteString(a.Key)
+		sb.WriteString("=")
+		sb.WriteString(quoteAttr(a.Value))
+	}
+	sb.WriteString(" -->")
+	return sb.String()
+}
+
+// parseMarker parses a marker line with the given name. It returns false if
+// the line is not a well-formed marker.
+func parseMarker(name, line string) ([]attr, bool) {
+	prefix := "<!-- " + name + " "
+	if line == prefix+"-->" {
+		return []attr{}, true
+	}
+	if len(line) < len(prefix)+len(" -->") || !strings.HasPrefix(line, prefix) || !strings.HasSuffix(line, " -->") {
+		return nil, false
+	}
+	rest := line[len(prefix) : len(line)-len(" -->")]
+	var attrs []attr
+	for {
+		rest = strings.TrimLeft(rest, " ")
+		if rest == "" {
+			return attrs, true
+		}
+		eq := strings.Index(rest, "=")
+		if eq <= 0 || strings.Contains(rest[:eq], " ") {
+			return nil, false
+		}
+		key := rest[:eq]
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			quoted, err := strconv.QuotedPrefix(rest)
+			if err != nil {
+				return nil, false
+			}
+			value, err = strconv.Unquote(quoted)
+			if err != nil {
+				return nil, false
+			}
+			rest = rest[len(quoted):]
+		} else {
+			end := strings.Index(rest, " ")
+			if end == -1 {
+				end = len(rest)
+			}
+			value = rest[:end]
+			rest = rest[end:]
+		}
+		attrs = append(attrs, attr{Key: key, Value: value})
+	}
+}
+
+// isMarker reports whether line is a marker of any kind the parser knows.
+func isMarker(line string) bool {
+	for _, name := range []string{entryMarker, signatureMarker, sealMarker} {
+		if _, ok := parseMarker(name, line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// quoteAttr returns value as-is when it is a simple token, otherwise as a Go
+// quoted string. Runs of "--" are escaped so a value can never terminate the
+// surrounding HTML comment.
+func quoteAttr(value string) string {
+	simple := value != ""
+	for _, c := range value {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+			strings.ContainsRune("._:/@+,", c) || c == '-') {
+			simple = false
+			break
+		}
+	}
+	if simple && !strings.Contains(value, "--") {
+		return value
+	}
+	return strings.ReplaceAll(strconv.Quote(value), "--", `\x2d\x2d`)
+}
+
+// entryAttrs returns the marker attributes recorded for b, or nil when b
+// carries none.
+func entryAttrs(b Block) []attr {
+	var attrs []attr
+	switch blk := b.(type) {
+	case CommentaryBlock:
+		if blk.ID != "" {
+			attrs = append(attrs, attr{Key: "id", Value: blk.ID})
+		}
+		if blk.Hash != "" {
+			attrs = append(attrs, attr{Key: "hash", Value: blk.Hash})
+		}
+	case CodeBlock:
+		if blk.ID != "" {
+			attrs = append(attrs, attr{Key: "id", Value: blk.ID})
+		}
+		if p := blk.Provenance; p != nil {
+			attrs = append(attrs,
+				attr{Key: "start", Value: p.Start},
+				attr{Key: "duration", Value: p.Duration},
+				attr{Key: "exit", Value: strconv.Itoa(p.ExitCode)},
+			)
+			if p.Host != "" {
+				attrs = append(attrs, attr{Key: "host", Value: p.Host})
+			}
+			if p.Dir != "" {
+				attrs = append(attrs, attr{Key: "dir", Value: p.Dir})
+			}
+			if p.Interpreter != "" {
+				attrs = append(attrs, attr{Key: "interpreter", Value: p.Interpreter})
+			}
+		}
+		if blk.Needs != "" {
+			attrs = append(attrs, attr{Key: "needs", Value: blk.Needs})
+		}
+		if s := blk.Service; s != nil {
+			attrs = append(attrs, attr{Key: "service", Value: s.Name})
+			if s.Ready != "" {
+				attrs = append(attrs, attr{Key: "ready", Value: s.Ready})
+			}
+		}
+		if blk.Hash != "" {
+			attrs = append(attrs, attr{Key: "hash", Value: blk.Hash})
+		}
+	}
+	return attrs
+}
+
+// applyEntryAttrs returns b with the marker attributes applied. Unknown keys
+// are ignored so that documents written by newer versions still parse.
+func applyEntryAttrs(b Block, attrs []attr) Block {
+	switch blk := b.(type) {
+	case CommentaryBlock:
+		for _, a := range attrs {
+			switch a.Key {
+			case "id":
+				blk.ID = a.Value
+			case "hash":
+				blk.Hash = a.Value
+			}
+		}
+		return blk
+	case CodeBlock:
+		// provenance and service return blk.Provenance and blk.Service,
+		// allocating them on first use.
+		provenance := func() *Provenance {
+			if blk.Provenance == nil {
+				blk.Provenance = &Provenance{}
+			}
+			return blk.Provenance
+		}
+		service := func() *Service {
+			if blk.Service == nil {
+				blk.Service = &Service{}
+			}
+			return blk.Service
+		}
+		for _, a := range attrs {
+			switch a.Key {
+			case "id":
+				blk.ID = a.Value
+			case "needs":
+				blk.Needs = a.Value
+			case "service":
+				service().Name = a.Value
+			case "ready":
+				service().Ready = a.Value
+			case "start":
+				provenance().Start = a.Value
+			case "duration":
+				provenance().Duration = a.Value
+			case "exit":
+				provenance().ExitCode, _ = strconv.Atoi(a.Value)
+			case "host":
+				provenance().Host = a.Value
+			case "dir":
+				provenance().Dir = a.Value
+			case "interpreter":
+				provenance().Interpreter = a.Value
+			case "hash":
+				blk.Hash = a.Value
+			}
+		}
+		return blk
+	}
+	return b
+}
@@ -0,0 +1,118 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+)
+
+// metaMarker is written on the line after the document ID and holds the
+// document's metadata:
+//
+//	<!-- showboat-meta author="Ada Lovelace" agent=builder tags=parser,demo -->
+const metaMarker = "showboat-meta"
+
+// Metadata describes a document as a whole: who or what wrote it, for which
+// task, and against which source tree. Every field is optional.
+type Metadata struct {
+	Author string // person responsible for the document
+	Agent  string // name of the agent that wrote it
+	Model  string // model the agent ran on
+	Task   string // task or ticket reference
+	Tags   string // comma-separated, see TagList
+	Repo   string // repository URL or path
+	Commit string // commit SHA the document was written against
+}
+
+// MetadataKeys are the keys of the Metadata fields, in the order they are
+// written.
+var MetadataKeys = []string{"author", "agent", "model", "task", "tags", "repo", "commit"}
+
+func (m *Metadata) field(key string) *string {
+	switch key {
+	case "author":
+		return &m.Author
+	case "agent":
+		return &m.Agent
+	case "model":
+		return &m.Model
+	case "task":
+		return &m.Task
+	case "tags":
+		return &m.Tags
+	case "repo":
+		return &m.Repo
+	case "commit":
+		return &m.Commit
+	}
+	return nil
+}
+
+// Get returns the value of the field with the given key.
+func (m Metadata) Get(key string) (string, error) {
+	f := m.field(key)
+	if f == nil {
+		return "", unknownMetadataKey(key)
+	}
+	return *f, nil
+}
+
+// Set sets the field with the given key; an empty value clears it. Tags are
+// normalised to a comma-separated list without spaces or empty tags.
+func (m *Metadata) Set(key, value string) error {
+	f := m.field(key)
+	if f == nil {
+		return unknownMetadataKey(key)
+	}
+	if key == "tags" {
+		value = strings.Join(splitTags(value), ",")
+	}
+	*f = strings.TrimSpace(value)
+	return nil
+}
+
+func unknownMetadataKey(key string) error {
+	return fmt.Errorf("unknown metadata key %q (want one of %s)", key, strings.Join(MetadataKeys, ", "))
+}
+
+// TagList returns the tags as a slice.
+func (m Metadata) TagList() []string {
+	return splitTags(m.Tags)
+}
+
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// IsZero reports whether no field is set.
+func (m Metadata) IsZero() bool {
+	return m == Metadata{}
+}
+
+// metadataAttrs returns the set fields of m as marker attributes.
+func metadataAttrs(m Metadata) []attr {
+	var attrs []attr
+	for _, key := range MetadataKeys {
+		if v := *m.field(key); v != "" {
+			attrs = append(attrs, attr{Key: key, Value: v})
+		}
+	}
+	return attrs
+}
+
+// applyMetadataAttrs returns the metadata in attrs. Unknown keys are
+// ignored so that documents written by newer versions still parse.
+func applyMetadataAttrs(attrs []attr) Metadata {
+	var m Metadata
+	for _, a := range attrs {
+		if m.field(a.Key) != nil {
+			m.Set(a.Key, a.Value)
+		}
+	}
+	return m
+}
@@ -3,23 +3,58 @@ package markdown
 import (
 	"bufio"
 	"io"
+	"regexp"
 	"strings"
 )
 
+// roleSuffixRe matches the "{role}" suffix of a code block's info string.
+var roleSuffixRe = regexp.MustCompile(` \{([a-z][a-z-]*)\}$`)
+
 // Parse reads markdown from r and returns a slice of Blocks.
 // The input is expected to be in the format produced by Write.
 func Parse(r io.Reader) ([]Block, error) {
+	blocks, _, err := ParseWithLines(r)
+	return blocks, err
+}
+
+// ParseWithLines is like Parse but also returns the 1-based line number on
+// which each block starts. For a block with an entry marker this is the line
+// of the marker.
+func ParseWithLines(r io.Reader) ([]Block, []int, error) {
+	return parse(r, true)
+}
+
+// parse implements ParseWithLines. When title is false a heading on the
+// first line is read as commentary rather than as the document's title.
+func parse(r io.Reader, title bool) ([]Block, []int, error) {
 	scanner := bufio.NewScanner(r)
 	var lines []string
 	for scanner.Scan() {
 		lines = append(lines, scanner.Text())
 	}
 	if err := scanner.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var blocks []Block
+	var starts []int
 	i := 0
+	start := 0
+
+	// pending holds the attributes of an entry marker until the block it
+	// annotates has been parsed, and pendingStart the marker's line.
+	var pending []attr
+	pendingStart := 0
+	appendBlock := func(b Block) {
+		line := start
+		if pending != nil {
+			b = applyEntryAttrs(b, pending)
+			line = pendingStart
+			pending = nil
+		}
+		blocks = append(blocks, b)
+		starts = append(starts, line+1)
+	}
 
 	// skipSeparator consumes a single blank line between blocks.
 	skipSeparator := func() {
@@ -29,8 +64,11 @@ func Parse(r io.Reader) ([]Block, error) {
 	}
 
 	for i < len(lines) {
-		// Title block: only at the very beginning of the document.
-		if len(blocks) == 0 && strings.HasPrefix(lines[i], "# ") {
+		start = i
+
+		// Title block: only at the very beginning of the document. A heading
+		// directly below an entry marker is commentary.
+		if title && len(blocks) == 0 && pending == nil && strings.HasPrefix(lines[i], "# ") {
 			title := lines[i][2:]
 			i++ // past "# ..." line
 			// Skip blank line between title and timestamp
@@ -57,7 +95,56 @@ func Parse(r io.Reader) ([]Block, error) {
 				docID = strings.TrimSuffix(docID, " -->")
 				i++
 			}
-			blocks = append(blocks, TitleBlock{Title: title, Timestamp: ts, Version: ver, DocumentID: docID})
+			var meta Metadata
+			if i < len(lines) {
+				if attrs, ok := parseMarker(metaMarker, lines[i]); ok {
+					meta = applyMetadataAttrs(attrs)
+					i++
+				}
+			}
+			appendBlock(TitleBlock{Title: title, Timestamp: ts, Version: ver, DocumentID: docID, Metadata: meta})
+			skipSeparator()
+			continue
+		}
+
+		// Entry marker: applies to the block on the following line.
+		if attrs, ok := parseMarker(entryMarker, lines[i]); ok {
+			pending = attrs
+			pendingStart = i
+			i++
+			continue
+		}
+
+		// Signature marker: a block of its own.
+		if attrs, ok := parseMarker(signatureMarker, lines[i]); ok {
+			sig := SignatureBlock{}
+			for _, a := range attrs {
+				switch a.Key {
+				case "key":
+					sig.PublicKey = a.Value
+				case "sig":
+					sig.Signature = a.Value
+				}
+			}
+			i++
+			appendBlock(sig)
+			skipSeparator()
+			continue
+		}
+
+		// Seal marker: a block of its own.
+		if attrs, ok := parseMarker(sealMarker, lines[i]); ok {
+			seal := SealBlock{}
+			for _, a := range attrs {
+				switch a.Key {
+				case "hash":
+					seal.Hash = a.Value
+				case "at":
+					seal.Timestamp = a.Value
+				}
+			}
+			i++
+			appendBlock(seal)
 			skipSeparator()
 			continue
 		}
@@ -86,12 +173,17 @@ func Parse(r io.Reader) ([]Block, error) {
 					i++
 				}
 				i++ // past closing fence
-				blocks = append(blocks, OutputBlock{Content: content.String()})
+				appendBlock(OutputBlock{Content: content.String()})
 
 			default:
-				// Code block. Check for {image} suffix.
+				// Code block. Check for {image} or {role} suffixes.
 				lang := info
 				isImage := false
+				role := ""
+				if m := roleSuffixRe.FindStringSubmatch(lang); m != nil && m[1] != "image" {
+					lang = strings.TrimSuffix(lang, m[0])
+					role = m[1]
+				}
 				if strings.HasSuffix(lang, " {image}") {
 					lang = strings.TrimSuffix(lang, " {image}")
 					isImage = true
@@ -102,10 +194,11 @@ func Parse(r io.Reader) ([]Block, error) {
 					i++
 				}
 				i++ // past closing fence
-				blocks = append(blocks, CodeBlock{
+				appendBlock(CodeBlock{
 					Lang:    lang,
 					Code:    strings.Join(codeLines, "\n"),
 					IsImage: isImage,
+					Role:    role,
 				})
 			}
 
@@ -118,18 +211,22 @@ func Parse(r io.Reader) ([]Block, error) {
 			alt, filename := parseImageRef(lines[i])
 			if filename != "" {
 				i++
-				blocks = append(blocks, ImageOutputBlock{AltText: alt, Filename: filename})
+				appendBlock(ImageOutputBlock{AltText: alt, Filename: filename})
 				skipSeparator()
 				continue
 			}
 		}
 
-		// Commentary block: accumulate lines until a fence, image output, or EOF.
+		// Commentary block: accumulate lines until a fence, entry marker,
+		// image output, or EOF.
 		var textLines []string
 		for i < len(lines) {
 			if strings.HasPrefix(lines[i], "```") {
 				break
 			}
+			if isMarker(lines[i]) {
+				break
+			}
 			if strings.HasPrefix(lines[i], "![") {
 				if _, fn := parseImageRef(lines[i]); fn != "" {
 					break
@@ -143,11 +240,11 @@ func Parse(r io.Reader) ([]Block, error) {
 			textLines = textLines[:len(textLines)-1]
 		}
 		if len(textLines) > 0 {
-			blocks = append(blocks, CommentaryBlock{Text: strings.Join(textLines, "\n")})
+			appendBlock(CommentaryBlock{Text: strings.Join(textLines, "\n")})
 		}
 	}
 
-	return blocks, nil
+	return blocks, starts, nil
 }
 
 // parseImageRef extracts the alt text and filename from a markdown image
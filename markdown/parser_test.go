@@ -257,6 +257,106 @@ func TestRoundTripWithDocumentID(t *testing.T) {
 	}
 }
 
+func TestRoundTripWithMetadata(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z by Showboat v0.3.0*\n<!-- showboat-id: test-uuid-456 -->\n<!-- showboat-meta author=\"Ada Lovelace\" model=gpt-5 tags=parser,demo commit=abc123 -->\n\nLet's begin.\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb := blocks[0].(TitleBlock)
+	want := Metadata{Author: "Ada Lovelace", Model: "gpt-5", Tags: "parser,demo", Commit: "abc123"}
+	if tb.Metadata != want {
+		t.Errorf("expected metadata %+v, got %+v", want, tb.Metadata)
+	}
+	if tags := tb.Metadata.TagList(); len(tags) != 2 || tags[1] != "demo" {
+		t.Errorf("unexpected tag list %v", tags)
+	}
+	if len(blocks) != 2 {
+		t.Errorf("expected the commentary after the metadata to be kept, got %d blocks", len(blocks))
+	}
+
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestMetadataSet(t *testing.T) {
+	var m Metadata
+	if err := m.Set("tags", " a, ,b "); err != nil {
+		t.Fatal(err)
+	}
+	if m.Tags != "a,b" {
+		t.Errorf("expected normalised tags, got %q", m.Tags)
+	}
+	if err := m.Set("colour", "red"); err == nil {
+		t.Error("expected an error for an unknown key")
+	}
+}
+
+func TestRoundTripWithRole(t *testing.T) {
+	input := "<!-- showboat-entry id=aaaa1111 -->\n```bash {git-state}\nshowboat git-state\n```\n\n```output\ncommit: abc\n```\n\n```bash {image}\nshot.png\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := blocks[0].(CodeBlock)
+	if cb.Lang != "bash" || cb.Role != RoleGitState || cb.IsImage {
+		t.Errorf("unexpected code block %+v", cb)
+	}
+	if img := blocks[2].(CodeBlock); !img.IsImage || img.Role != "" {
+		t.Errorf("expected {image} not to be read as a role, got %+v", img)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestRoundTripWithService(t *testing.T) {
+	input := "<!-- showboat-entry id=aaaa1111 service=web ready=\"log:Listening on\" -->\n```bash {service}\npython3 -m http.server 8000\n```\n\n```output\nweb logged \"Listening on\"\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := blocks[0].(CodeBlock)
+	if cb.Role != RoleService || cb.Service == nil || *cb.Service != (Service{Name: "web", Ready: "log:Listening on"}) {
+		t.Errorf("unexpected code block %+v", cb)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestRoundTripWithNeeds(t *testing.T) {
+	input := "<!-- showboat-entry id=bbbb2222 needs=aaaa1111,cccc3333 -->\n```bash\ncurl localhost:8000\n```\n\n```output\nok\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cb := blocks[0].(CodeBlock)
+	if got := strings.Join(cb.NeedsList(), " "); got != "aaaa1111 cccc3333" {
+		t.Errorf("expected two needed entries, got %q", got)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
 func TestRoundTrip(t *testing.T) {
 	input := "# Demo\n\n*2026-02-06T00:00:00Z by Showboat v0.3.0*\n\nLet's begin.\n\n```bash\necho hi\n```\n\n```output\nhi\n```\n\nDone.\n"
 	blocks, err := Parse(strings.NewReader(input))
@@ -272,3 +372,154 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
 	}
 }
+
+func TestParseEntryIDs(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n\n<!-- showboat-entry id=aaaa1111 -->\nLet's begin.\n\n<!-- showboat-entry id=bbbb2222 -->\n```bash\necho hi\n```\n\n```output\nhi\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 4 {
+		t.Fatalf("expected 4 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	cb, ok := blocks[1].(CommentaryBlock)
+	if !ok {
+		t.Fatalf("expected CommentaryBlock, got %T", blocks[1])
+	}
+	if cb.ID != "aaaa1111" || cb.Text != "Let's begin." {
+		t.Errorf("unexpected commentary: %+v", cb)
+	}
+	code, ok := blocks[2].(CodeBlock)
+	if !ok {
+		t.Fatalf("expected CodeBlock, got %T", blocks[2])
+	}
+	if code.ID != "bbbb2222" {
+		t.Errorf("expected ID 'bbbb2222', got %q", code.ID)
+	}
+}
+
+func TestParseEntryMarkerEndsCommentary(t *testing.T) {
+	input := "First note.\n\n<!-- showboat-entry id=bbbb2222 -->\nSecond note.\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	if cb := blocks[0].(CommentaryBlock); cb.Text != "First note." || cb.ID != "" {
+		t.Errorf("unexpected first block: %+v", cb)
+	}
+	if cb := blocks[1].(CommentaryBlock); cb.Text != "Second note." || cb.ID != "bbbb2222" {
+		t.Errorf("unexpected second block: %+v", cb)
+	}
+}
+
+func TestRoundTripWithEntryIDs(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z by Showboat v0.3.0*\n<!-- showboat-id: test-uuid-456 -->\n\n<!-- showboat-entry id=aaaa1111 -->\nLet's begin.\n\n<!-- showboat-entry id=bbbb2222 -->\n```bash\necho hi\n```\n\n```output\nhi\n```\n\n<!-- showboat-entry id=cccc3333 -->\n```bash {image}\nshot.png\n```\n\n![shot](shot.png)\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseMarkerQuotedValues(t *testing.T) {
+	attrs, ok := parseMarker(entryMarker, `<!-- showboat-entry id=abc note="two words" dashes="a\x2d\x2d>b" -->`)
+	if !ok {
+		t.Fatal("expected marker to parse")
+	}
+	want := []attr{{"id", "abc"}, {"note", "two words"}, {"dashes", "a-->b"}}
+	if len(attrs) != len(want) {
+		t.Fatalf("expected %d attrs, got %+v", len(want), attrs)
+	}
+	for i := range want {
+		if attrs[i] != want[i] {
+			t.Errorf("attr %d: expected %+v, got %+v", i, want[i], attrs[i])
+		}
+	}
+	if got := formatMarker(entryMarker, want); got != `<!-- showboat-entry id=abc note="two words" dashes="a\x2d\x2d>b" -->` {
+		t.Errorf("unexpected formatted marker: %s", got)
+	}
+}
+
+func TestRoundTripWithProvenance(t *testing.T) {
+	input := "<!-- showboat-entry id=bbbb2222 start=2026-02-06T15:30:09.510Z duration=1.204s exit=3 host=build-01 dir=\"/home/agent/my project\" interpreter=\"Python 3.12.1\" -->\n```python3\nprint(1)\n```\n\n```output\n1\n```\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, ok := blocks[0].(CodeBlock)
+	if !ok {
+		t.Fatalf("expected CodeBlock, got %T", blocks[0])
+	}
+	want := Provenance{
+		Start:       "2026-02-06T15:30:09.510Z",
+		Duration:    "1.204s",
+		ExitCode:    3,
+		Host:        "build-01",
+		Dir:         "/home/agent/my project",
+		Interpreter: "Python 3.12.1",
+	}
+	if code.Provenance == nil || *code.Provenance != want {
+		t.Errorf("expected provenance %+v, got %+v", want, code.Provenance)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestRoundTripWithHashAndSignature(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n<!-- showboat-id: doc-uuid -->\n\n<!-- showboat-entry id=aaaa1111 hash=sha256:abc123 -->\nLet's begin.\n\n<!-- showboat-signature key=cHVibGlj sig=c2lnbmF0dXJl -->\n"
+	blocks, err := Parse(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d: %+v", len(blocks), blocks)
+	}
+	if cb := blocks[1].(CommentaryBlock); cb.Hash != "sha256:abc123" {
+		t.Errorf("expected hash to be parsed, got %q", cb.Hash)
+	}
+	sig, ok := blocks[2].(SignatureBlock)
+	if !ok {
+		t.Fatalf("expected SignatureBlock, got %T", blocks[2])
+	}
+	if sig.PublicKey != "cHVibGlj" || sig.Signature != "c2lnbmF0dXJl" {
+		t.Errorf("unexpected signature block: %+v", sig)
+	}
+	var buf strings.Builder
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != input {
+		t.Errorf("round trip mismatch.\nexpected:\n%s\ngot:\n%s", input, buf.String())
+	}
+}
+
+func TestParseWithLines(t *testing.T) {
+	input := "# Demo\n\n*2026-02-06T00:00:00Z*\n\nIntro.\n\n<!-- showboat-entry id=bbbb2222 -->\n```bash\necho hi\n```\n\n```output\nhi\n```\n"
+	blocks, lines, err := ParseWithLines(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 5, 7, 12}
+	if len(blocks) != len(want) || len(lines) != len(want) {
+		t.Fatalf("expected %d blocks and lines, got %d and %v", len(want), len(blocks), lines)
+	}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("block %d: expected line %d, got %d", i, want[i], lines[i])
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A region is a showboat document embedded in a larger markdown file,
+// between a pair of marker lines:
+//
+//	<!-- showboat:begin id=setup -->
+//	...
+//	<!-- showboat:end -->
+//
+// A region has no title block. Everything outside its markers belongs to the
+// surrounding file and is never parsed or rewritten.
+const (
+	regionBeginMarker = "showboat:begin"
+	regionEndMarker   = "showboat:end"
+)
+
+// findRegion returns the byte offsets of the start and end of the content of
+// the region with the given ID: the line after its begin marker and the start
+// of its end marker line.
+func findRegion(data []byte, id string) (start, end int, err error) {
+	start = -1
+	for pos := 0; pos < len(data); {
+		next := bytes.IndexByte(data[pos:], '\n') + 1
+		if next == 0 {
+			next = len(data) - pos
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(string(data[pos:pos+next]), "\n"), "\r")
+		if start == -1 {
+			if attrs, ok := parseMarker(regionBeginMarker, line); ok && regionID(attrs) == id {
+				start = pos + next
+			}
+		} else if _, ok := parseMarker(regionEndMarker, line); ok {
+			return start, pos, nil
+		}
+		pos += next
+	}
+	if start == -1 {
+		return 0, 0, fmt.Errorf("region %q not found", id)
+	}
+	return 0, 0, fmt.Errorf("region %q has no end marker", id)
+}
+
+func regionID(attrs []attr) string {
+	for _, a := range attrs {
+		if a.Key == "id" {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// ParseRegion returns the blocks of the region with the given ID in data.
+// Since a region has no title block, a heading at its start is commentary.
+func ParseRegion(data []byte, id string) ([]Block, error) {
+	start, end, err := findRegion(data, id)
+	if err != nil {
+		return nil, err
+	}
+	blocks, _, err := parse(bytes.NewReader(data[start:end]), false)
+	return blocks, err
+}
+
+// ReplaceRegion returns a copy of data with the content of the region with
+// the given ID replaced by blocks. The bytes outside the region, including
+// its marker lines, are unchanged, and the blocks are written directly
+// between the markers so that parsing and replacing a region is stable.
+func ReplaceRegion(data []byte, id string, blocks []Block) ([]byte, error) {
+	start, end, err := findRegion(data, id)
+	if err != nil {
+		return nil, err
+	}
+	var content bytes.Buffer
+	if err := Write(&content, blocks); err != nil {
+		return nil, err
+	}
+
+	out := append([]byte{}, data[:start]...)
+	out = append(out, content.Bytes()...)
+	return append(out, data[end:]...), nil
+}
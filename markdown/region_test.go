@@ -0,0 +1,78 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegionRoundTrip(t *testing.T) {
+	data := []byte("# Guide\n\nIntro  with odd  spacing.\r\n\n<!-- showboat:begin id=other -->\n<!-- showboat:end -->\n\n" +
+		"<!-- showboat:begin id=setup -->\n<!-- showboat:end -->\n\n| a | b |\n")
+
+	blocks, err := ParseRegion(data, "setup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 0 {
+		t.Fatalf("expected empty region, got %#v", blocks)
+	}
+
+	entry := []Block{CodeBlock{Lang: "bash", Code: "echo hi", ID: "aaaa1111"}, OutputBlock{Content: "hi\n"}}
+	out, err := ReplaceRegion(data, "setup", ChainEntry(nil, entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(out)
+	if !strings.HasPrefix(s, "# Guide\n\nIntro  with odd  spacing.\r\n\n<!-- showboat:begin id=other -->\n<!-- showboat:end -->\n\n<!-- showboat:begin id=setup -->\n<!-- showboat-entry id=aaaa1111 ") {
+		t.Errorf("expected bytes before the region to be kept, got:\n%s", s)
+	}
+	if !strings.HasSuffix(s, "```output\nhi\n```\n<!-- showboat:end -->\n\n| a | b |\n") {
+		t.Errorf("expected bytes after the region to be kept, got:\n%s", s)
+	}
+
+	blocks, err = ParseRegion(out, "setup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 || blocks[0].(CodeBlock).Code != "echo hi" {
+		t.Fatalf("expected the entry back, got %#v", blocks)
+	}
+	if errs := CheckChain(blocks); len(errs) != 0 {
+		t.Errorf("expected a valid chain, got %+v", errs)
+	}
+
+	emptied, err := ReplaceRegion(out, "setup", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(emptied) != string(data) {
+		t.Errorf("expected removing every block to restore the file, got:\n%s", emptied)
+	}
+}
+
+func TestRegionErrors(t *testing.T) {
+	if _, err := ParseRegion([]byte("no regions here\n"), "setup"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+	if _, err := ParseRegion([]byte("<!-- showboat:begin id=setup -->\ntext\n"), "setup"); err == nil || !strings.Contains(err.Error(), "no end marker") {
+		t.Errorf("expected missing end marker error, got %v", err)
+	}
+}
+
+func TestRegionHeading(t *testing.T) {
+	data := []byte("# Guide\n\n<!-- showboat:begin id=r1 -->\n# Demo steps\n\nSome prose.\n<!-- showboat:end -->\n")
+	blocks, err := ParseRegion(data, "r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || blocks[0] != (CommentaryBlock{Text: "# Demo steps\n\nSome prose."}) {
+		t.Fatalf("expected the heading to be commentary, got %#v", blocks)
+	}
+	out, err := ReplaceRegion(data, "r1", blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(data) {
+		t.Errorf("expected replacing a region with its own blocks to change nothing, got:\n%s", out)
+	}
+}
@@ -22,6 +22,11 @@ func Write(w io.Writer, blocks []Block) error {
 }
 
 func writeBlock(w io.Writer, block Block) error {
+	if attrs := entryAttrs(block); attrs != nil {
+		if _, err := fmt.Fprintf(w, "%s\n", formatMarker(entryMarker, attrs)); err != nil {
+			return err
+		}
+	}
 	switch b := block.(type) {
 	case TitleBlock:
 		dateline := b.Timestamp
@@ -36,6 +41,11 @@ func writeBlock(w io.Writer, block Block) error {
 				return err
 			}
 		}
+		if !b.Metadata.IsZero() {
+			if _, err := fmt.Fprintf(w, "%s\n", formatMarker(metaMarker, metadataAttrs(b.Metadata))); err != nil {
+				return err
+			}
+		}
 		return nil
 	case CommentaryBlock:
 		_, err := fmt.Fprintf(w, "%s\n", b.Text)
@@ -45,6 +55,9 @@ func writeBlock(w io.Writer, block Block) error {
 		if b.IsImage {
 			lang += " {image}"
 		}
+		if b.Role != "" {
+			lang += " {" + b.Role + "}"
+		}
 		_, err := fmt.Fprintf(w, "```%s\n%s\n```\n", lang, b.Code)
 		return err
 	case OutputBlock:
@@ -54,6 +67,18 @@ func writeBlock(w io.Writer, block Block) error {
 	case ImageOutputBlock:
 		_, err := fmt.Fprintf(w, "![%s](%s)\n", b.AltText, b.Filename)
 		return err
+	case SealBlock:
+		_, err := fmt.Fprintf(w, "%s\n", formatMarker(sealMarker, []attr{
+			{Key: "hash", Value: b.Hash},
+			{Key: "at", Value: b.Timestamp},
+		}))
+		return err
+	case SignatureBlock:
+		_, err := fmt.Fprintf(w, "%s\n", formatMarker(signatureMarker, []attr{
+			{Key: "key", Value: b.PublicKey},
+			{Key: "sig", Value: b.Signature},
+		}))
+		return err
 	default:
 		return fmt.Errorf("unknown block type: %T", block)
 	}
@@ -176,3 +176,19 @@ func TestWriteFullDocument(t *testing.T) {
 		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
 	}
 }
+
+func TestWriteEntryIDs(t *testing.T) {
+	var buf strings.Builder
+	blocks := []Block{
+		CommentaryBlock{Text: "Let's begin.", ID: "aaaa1111"},
+		CodeBlock{Lang: "bash", Code: "echo hi", ID: "bbbb2222"},
+		OutputBlock{Content: "hi\n"},
+	}
+	if err := Write(&buf, blocks); err != nil {
+		t.Fatal(err)
+	}
+	expected := "<!-- showboat-entry id=aaaa1111 -->\nLet's begin.\n\n<!-- showboat-entry id=bbbb2222 -->\n```bash\necho hi\n```\n\n```output\nhi\n```\n"
+	if buf.String() != expected {
+		t.Errorf("expected:\n%q\ngot:\n%q", expected, buf.String())
+	}
+}
@@ -0,0 +1,92 @@
+// Package showboattest runs showboat documents as Go tests, so that demo
+// documents are verified by "go test" with the usual filtering and
+// reporting.
+//
+// A test that checks a document next to it looks like this:
+//
+//	func TestDemo(t *testing.T) {
+//		showboattest.Run(t, "demo.md")
+//	}
+//
+// "showboat export --go-test" generates such a file.
+package showboattest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/document"
+)
+
+// Options controls RunWithOptions.
+type Options struct {
+	// Workdir is the directory code blocks run in. Empty means the
+	// current directory, which for "go test" is the package directory.
+	Workdir string
+
+	// Chain makes every block depend on all the blocks before it, as
+	// "showboat verify --chain" does.
+	Chain bool
+}
+
+// Run verifies the document at file with document.Verify, the same code as
+// "showboat verify". Each code block becomes a subtest named after its
+// entry ID, or "block_<index>" for blocks recorded without one, in the
+// order verify runs them. A block whose output differs from the recorded
+// output fails, and a block that verify skips because a block it depends
+// on failed is skipped. Setup, service and teardown blocks run even when
+// "go test -run" leaves out their subtests; other blocks run only if their
+// subtest is selected.
+func Run(t *testing.T, file string) {
+	t.Helper()
+	RunWithOptions(t, file, Options{})
+}
+
+// RunWithOptions is Run with options.
+func RunWithOptions(t *testing.T, file string, opts Options) {
+	t.Helper()
+	doc, err := document.Open(file, document.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// reported records whether a subtest reported an error from running a
+	// block, which Verify also returns.
+	reported := false
+	each := func(r *document.Result, run func() error) {
+		name := r.EntryID
+		if name == "" {
+			name = fmt.Sprintf("block_%d", r.BlockIndex)
+		}
+		t.Run(name, func(t *testing.T) {
+			if r.Skipped != "" {
+				t.Skip(r.Skipped)
+			}
+			if err := run(); err != nil {
+				reported = true
+				t.Fatal(err)
+			}
+			if msg := mismatch(*r); msg != "" {
+				t.Error(msg)
+			}
+		})
+	}
+	verifyOpts := document.VerifyOptions{Workdir: opts.Workdir, Chain: opts.Chain, Each: each}
+	if _, err := doc.Verify(context.Background(), verifyOpts); err != nil && !reported {
+		t.Error(err)
+	}
+}
+
+// mismatch returns a description of how the output of a block that ran
+// differs from the recorded output, or "" if it matches.
+func mismatch(r document.Result) string {
+	if r.Passed() {
+		return ""
+	}
+	return fmt.Sprintf("block %d (%s) output differs:\n%s\n  expected: %s\n  actual:   %s",
+		r.BlockIndex, r.Lang, r.Code,
+		strings.TrimRight(r.Expected, "\n"),
+		strings.TrimRight(r.Actual, "\n"),
+	)
+}
@@ -0,0 +1,60 @@
+package showboattest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/simonw/showboat/document"
+	"github.com/simonw/showboat/markdown"
+)
+
+func writeDoc(t *testing.T, blocks []markdown.Block) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "demo.md")
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := markdown.Write(f, blocks); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestRun(t *testing.T) {
+	file := writeDoc(t, []markdown.Block{
+		markdown.TitleBlock{Title: "Demo", Timestamp: "2026-02-06T00:00:00Z"},
+		markdown.CommentaryBlock{Text: "Greeting"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo hello", ID: "aaaa1111"},
+		markdown.OutputBlock{Content: "hello\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo two", ID: "bbbb2222"},
+		markdown.OutputBlock{Content: "two\n"},
+	})
+	Run(t, file)
+}
+
+func TestRunFixturesAndNeeds(t *testing.T) {
+	file := writeDoc(t, []markdown.Block{
+		markdown.TitleBlock{Title: "Demo", Timestamp: "2026-02-06T00:00:00Z"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo step", ID: "bbbb2222", Needs: "aaaa1111"},
+		markdown.OutputBlock{Content: "step\n"},
+		markdown.CodeBlock{Lang: "bash", Code: "echo setup", Role: markdown.RoleSetup, ID: "aaaa1111"},
+		markdown.OutputBlock{Content: "setup\n"},
+	})
+	Run(t, file)
+}
+
+func TestMismatch(t *testing.T) {
+	r := document.Result{BlockIndex: 1, Lang: "bash", Code: "echo hello", Expected: "goodbye\n", Actual: "hello\n"}
+	msg := mismatch(r)
+	if !strings.Contains(msg, "block 1 (bash)") || !strings.Contains(msg, "expected: goodbye") || !strings.Contains(msg, "actual:   hello") {
+		t.Errorf("expected mismatch description, got %q", msg)
+	}
+	r.Actual = r.Expected
+	if msg := mismatch(r); msg != "" {
+		t.Errorf("expected no mismatch, got %q", msg)
+	}
+}